@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"pgcr-processing-service/internal/db"
+)
+
+// The host is filled from -host, the credentials by db.Connect
+var postgresUrl = "postgres://%%s:%%s@%s/postgres?sslmode=disable"
+
+// Verifies the stored player clear counts against the instances each player
+// is recorded in. Exits with a non-zero status when drift is left behind
+func main() {
+	fix := flag.Bool("fix", false, "recompute the counts of every drifted player")
+	host := flag.String("host", "postgres:5432", "postgres host and port, e.g. localhost:5432 outside of the compose network")
+	flag.Parse()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
+	defer cancel()
+
+	conn, err := db.Connect(ctx, fmt.Sprintf(postgresUrl, *host))
+	if err != nil {
+		slog.Error("Error happened while connecting to DB", "error", err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+
+	queries := db.New(conn)
+	drifted, err := queries.ListPlayerCountDrift(ctx)
+	if err != nil {
+		slog.Error("Failed to compare clear counts", "error", err)
+		os.Exit(1)
+	}
+
+	for _, d := range drifted {
+		fmt.Printf("%d\tclears %d -> %d\tfull clears %d -> %d\n", d.MembershipID, d.TotalClears, d.ExpectedClears, d.TotalFullClears, d.ExpectedFullClears)
+	}
+	slog.Info("Finished verifying clear counts", "drifted", len(drifted))
+
+	if len(drifted) == 0 {
+		return
+	}
+	if !*fix {
+		os.Exit(1)
+	}
+
+	for _, d := range drifted {
+		if err := queries.RecomputePlayerCounts(ctx, d.MembershipID); err != nil {
+			slog.Error("Failed to recompute clear counts", "membershipId", d.MembershipID, "error", err)
+			os.Exit(1)
+		}
+	}
+	slog.Info("Recomputed drifted clear counts", "players", len(drifted))
+}
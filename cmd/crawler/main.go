@@ -2,15 +2,21 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"flag"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"pgcr-processing-service/internal/crawling"
+	"pgcr-processing-service/internal/db"
 	"pgcr-processing-service/internal/rabbitmq"
 	"pgcr-processing-service/internal/transport"
 	"pgcr-processing-service/internal/types/net"
@@ -18,11 +24,36 @@ import (
 )
 
 var (
-	goroutines = 2
-	apiKey     = "27fd2725658c431992b1b0259682ad3c"
+	goroutines  = 2
+	postgresUrl = "postgres://%s:%s@postgres:5432/postgres?sslmode=disable"
+	// Instances read from the ledger at once when checking what was already ingested
+	ledgerWindow int64 = 1000
+	// Instances behind the live head scanned for gaps
+	backfillWindow int64 = 100_000
+	// Instances per range leased to a crawler
+	leaseSize int64 = 10_000
+	// Idle keep-alive connections kept to the upstream, i.e. the proxy
+	idleConns = 64
 )
 
 func main() {
+	walkHistory := flag.Bool("history", false, "walk the activity history of the players in destiny_player instead of crawling instance ids sequentially")
+	members := flag.String("members", "", "comma separated membership ids, or type:id pairs, whose activity history is walked once before exiting")
+	upstream := flag.String("upstream", os.Getenv(net.UPSTREAM_URL_ENV), "base url of the proxy, e.g. http://proxy:8081. Bungie is called directly when empty")
+	token := flag.String("token", os.Getenv(net.PROXY_TOKEN_ENV), "token authenticating the crawler to the proxy")
+	compressed := flag.Bool("compressed", false, "publish pgcrs as compressed by Bungie instead of decoded, the processor decodes them")
+	key := flag.String("api-key", os.Getenv(net.BUNGIE_API_KEY_ENV), "Bungie API key, only used without -upstream since the proxy injects its own")
+	flag.Parse()
+
+	apiKey := *key
+	switch {
+	case *upstream != "":
+		apiKey = ""
+	case apiKey == "":
+		slog.Error("-api-key or " + net.BUNGIE_API_KEY_ENV + " is required without -upstream")
+		os.Exit(2)
+	}
+
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGQUIT)
 	defer cancel()
 
@@ -33,9 +64,13 @@ func main() {
 	}
 	defer rabbitmq.Conn.Close()
 
+	pooled := &transport.TokenTransport{
+		Token: *token,
+		Base:  transport.NewPooledTransport(idleConns),
+	}
 	client := http.Client{
-		Transport: &transport.MaxSizeTransport{
-			Base:    http.DefaultTransport,
+		Transport: &transport.DecodingTransport{
+			Base:    pooled,
 			MaxSize: net.MAX_REQUEST_SIZE_KB,
 		},
 		Timeout: 10 * time.Second,
@@ -45,24 +80,93 @@ func main() {
 	tick := time.NewTicker(10 * time.Second)
 	defer tick.Stop()
 
-	wg.Add(1)
-	in := make(chan int64, 100)
-	go func(ctx context.Context, throttle *time.Ticker, start int64, in chan<- int64) {
-		defer wg.Done()
-		for {
-			select {
-			case <-ctx.Done():
-				slog.Info("Context cancelled. Exiting.")
-				close(in)
-				return
-			case <-throttle.C:
-				start += 1
-				in <- int64(start)
-			}
+	live := make(chan int64, 100)
+
+	var in <-chan int64 = live
+	var ledger crawling.Ledger
+	switch {
+	case *walkHistory || *members != "":
+		conn := connect(ctx)
+		defer conn.Close()
+		queries := db.New(conn)
+		ledger = crawling.NewPostgresLedger(queries, ledgerWindow)
+
+		// Activity history pages are way over the pgcr size limit. The walk's
+		// requests and the pgcrs it finds share the throttle of the sequential
+		// crawl, so walking doesn't add to the rate Bungie is called at
+		walker := crawling.NewHistoryWalker(queries, &http.Client{Transport: pooled, Timeout: 30 * time.Second}, apiKey)
+		walker.Throttle = tick.C
+		in = crawling.Throttled(ctx, tick.C, live)
+		if *upstream != "" {
+			walker.BaseUrl = *upstream
+		}
+		if *members == "" {
+			wg.Go(func() {
+				walker.Run(ctx, live)
+			})
+			break
 		}
-	}(ctx, tick, 1, in)
 
-	crawler := crawling.NewPgcrCrawler(rabbitmq, &client, in, net.MAX_REQUEST_SIZE_KB)
+		targets, err := parseMembers(ctx, queries, *members)
+		if err != nil {
+			slog.Error("Invalid -members", "error", err)
+			os.Exit(2)
+		}
+		wg.Go(func() {
+			if err := walker.WalkMembers(ctx, targets, live); err != nil {
+				slog.Error("Unable to walk activity history", "error", err)
+			}
+		})
+	case os.Getenv("POSTGRES_USERNAME") != "":
+		conn := connect(ctx)
+		defer conn.Close()
+		queries := db.New(conn)
+		ledger = crawling.NewPostgresLedger(queries, ledgerWindow)
+
+		// Ranges are shared with the other crawlers through leases
+		leaser := crawling.NewLeaser(queries, leaseSize)
+		wg.Go(func() {
+			leaser.Generate(ctx, tick.C, live)
+		})
+
+		// Only one crawler backfills at a time, and its backfill ids share the
+		// throttle of its live ids
+		backfiller := crawling.NewBackfiller(queries, backfillWindow)
+		backfiller.Owner = leaser.Owner
+		backfill := make(chan int64)
+		wg.Go(func() {
+			backfiller.Run(ctx, backfill)
+		})
+		in = crawling.Prioritize(ctx, tick.C, live, backfill, backfiller.Observe)
+	default:
+		// Without a database this is the only crawler, every instance from the
+		// start is crawled and no gaps are backfilled. The processor still
+		// refuses to ingest an instance twice
+		slog.Warn("POSTGRES_USERNAME not set, crawling without the ingestion ledger")
+
+		wg.Add(1)
+		go func(ctx context.Context, throttle *time.Ticker, start int64, in chan<- int64) {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					slog.Info("Context cancelled. Exiting.")
+					close(in)
+					return
+				case <-throttle.C:
+					start += 1
+					in <- int64(start)
+				}
+			}
+		}(ctx, tick, 1, live)
+	}
+
+	crawler := crawling.NewPgcrCrawler(rabbitmq, &client, in)
+	crawler.Ledger = ledger
+	crawler.PublishEncoded = *compressed
+	if *upstream != "" {
+		crawler.BaseUrl = *upstream
+	}
 	for i := range goroutines {
 		wg.Go(func() {
 			crawler.Crawl(ctx, int64(i), apiKey)
@@ -72,3 +176,50 @@ func main() {
 	wg.Wait()
 	slog.Info("All workers stopped, cleaning up resources")
 }
+
+func connect(ctx context.Context) *sql.DB {
+	conn, err := db.Connect(ctx, postgresUrl)
+	if err != nil {
+		slog.Error("Error happened while connecting to DB", "error", err)
+		os.Exit(1)
+	}
+	return conn
+}
+
+// Parses membership ids, optionally prefixed by their membership type. The type
+// of plain ids is looked up in destiny_player
+func parseMembers(ctx context.Context, queries *db.Queries, list string) ([]crawling.Member, error) {
+	members := []crawling.Member{}
+	for _, raw := range strings.Split(list, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+
+		rawType, rawId, typed := strings.Cut(raw, ":")
+		if !typed {
+			rawId = rawType
+		}
+
+		membershipId, err := strconv.ParseInt(rawId, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid membership id %q: %w", raw, err)
+		}
+
+		if typed {
+			membershipType, err := strconv.ParseInt(rawType, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid membership type %q: %w", raw, err)
+			}
+			members = append(members, crawling.Member{MembershipType: int32(membershipType), MembershipId: membershipId})
+			continue
+		}
+
+		player, err := queries.GetDestinyPlayer(ctx, membershipId)
+		if err != nil {
+			return nil, fmt.Errorf("membership type of %d unknown, pass it as type:id: %w", membershipId, err)
+		}
+		members = append(members, crawling.Member{MembershipType: player.MembershipType, MembershipId: membershipId})
+	}
+	return members, nil
+}
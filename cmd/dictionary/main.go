@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"pgcr-processing-service/internal/compress"
+	"pgcr-processing-service/internal/db"
+)
+
+var postgresUrl = "postgres://%s:%s@postgres:5432/postgres?sslmode=disable"
+
+// Trains a zstd dictionary on raw pgcrs, either sample files or the oldest
+// pgcrs in the pgcr table. A new dictionary is embedded in internal/compress
+// under a new codec, existing ones are never replaced
+func main() {
+	samples := flag.String("samples", "", "glob of raw pgcr json files to train on, the pgcr table is read when empty")
+	count := flag.Int("count", 10_000, "number of stored pgcrs to train on")
+	out := flag.String("out", "", "file the dictionary is written to")
+	id := flag.Uint("id", 0, "dictionary id written in every frame, random when 0")
+	size := flag.Int("size", 112_640, "max size of the dictionary in bytes")
+	flag.Parse()
+
+	if *out == "" {
+		slog.Error("-out is required")
+		os.Exit(2)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
+	defer cancel()
+
+	var raw [][]byte
+	var err error
+	if *samples != "" {
+		raw, err = readFiles(*samples)
+	} else {
+		raw, err = readStored(ctx, *count)
+	}
+	if err != nil {
+		slog.Error("Unable to read sample pgcrs", "error", err)
+		os.Exit(1)
+	}
+	if len(raw) == 0 {
+		slog.Error("No sample pgcrs to train on")
+		os.Exit(1)
+	}
+
+	dictionary, err := compress.TrainDictionary(raw, uint32(*id), *size)
+	if err != nil {
+		slog.Error("Unable to train dictionary", "error", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(*out, dictionary, 0o644); err != nil {
+		slog.Error("Unable to write dictionary", "out", *out, "error", err)
+		os.Exit(1)
+	}
+	slog.Info("Trained dictionary", "samples", len(raw), "bytes", len(dictionary), "out", *out)
+}
+
+func readFiles(glob string) ([][]byte, error) {
+	paths, err := filepath.Glob(glob)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make([][]byte, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		raw = append(raw, data)
+	}
+	return raw, nil
+}
+
+// Reads the oldest stored pgcrs, in instance id order, decompressed with their codec
+func readStored(ctx context.Context, count int) ([][]byte, error) {
+	conn, err := db.Connect(ctx, postgresUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	queries := db.New(conn)
+
+	params := db.ListPgcrBlobsParams{BatchSize: 500}
+	raw := make([][]byte, 0, count)
+	for len(raw) < count {
+		rows, err := queries.ListPgcrBlobs(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		for _, row := range rows {
+			params.AfterID = row.InstanceID
+			compressor, err := compress.ForCodec(compress.Codec(row.Codec))
+			if err != nil {
+				return nil, err
+			}
+			data, err := compressor.Decompress(row.Blob)
+			if err != nil {
+				slog.Warn("Skipping undecodable pgcr", "instanceId", row.InstanceID, "error", err)
+				continue
+			}
+			raw = append(raw, data)
+		}
+	}
+	return raw[:min(len(raw), count)], nil
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"pgcr-processing-service/internal/crawling"
+	"pgcr-processing-service/internal/db"
+	"pgcr-processing-service/internal/rabbitmq"
+	"pgcr-processing-service/internal/transport"
+	"pgcr-processing-service/internal/types/ledger"
+	"pgcr-processing-service/internal/types/net"
+	types "pgcr-processing-service/internal/types/rabbitmq"
+)
+
+var postgresUrl = "postgres://%s:%s@postgres:5432/postgres?sslmode=disable"
+
+const usage = `Usage: ledger <command> [flags]
+
+Commands:
+  list     list ingestion_log entries
+  reset    move errored, dead or leftover processing entries back to queued,
+           without publishing them. Use requeue to crawl them right away
+  requeue  crawl instances again and publish them for processing
+  stats    entry counts by status and processor version, and the most common errors
+  coverage share of instances crawled per range of ids
+
+Run ledger <command> -h for the flags of each command
+`
+
+// Filters shared by the commands that select entries from the ledger
+type filters struct {
+	status    string
+	source    string
+	errorLike string
+	olderThan time.Duration
+}
+
+func (f *filters) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.status, "status", "", "only entries with this status")
+	fs.StringVar(&f.source, "source", "", "only entries from this source, e.g. crawler or dataset")
+	fs.StringVar(&f.errorLike, "error", "", "only entries whose error contains this text, case insensitive")
+	fs.DurationVar(&f.olderThan, "older-than", 0, "only entries last attempted at least this long ago")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
+	defer cancel()
+
+	conn, err := db.Connect(ctx, postgresUrl)
+	if err != nil {
+		slog.Error("Error happened while connecting to DB", "error", err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+	queries := db.New(conn)
+
+	command, args := os.Args[1], os.Args[2:]
+	switch command {
+	case "list":
+		err = list(ctx, queries, args)
+	case "reset":
+		err = reset(ctx, queries, args)
+	case "requeue":
+		err = requeue(ctx, queries, args)
+	case "stats":
+		err = stats(ctx, queries, args)
+	case "coverage":
+		err = coverage(ctx, queries, args)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		slog.Error("Ledger command failed", "command", command, "error", err)
+		os.Exit(1)
+	}
+}
+
+func list(ctx context.Context, queries *db.Queries, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	var f filters
+	f.register(fs)
+	limit := fs.Int("limit", 100, "max number of entries to print")
+	version := fs.String("version", "", "only entries last processed or reprocessed by this processor version")
+	fs.Parse(args)
+
+	entries, err := queries.ListLogEntries(ctx, db.ListLogEntriesParams{
+		Status:           f.status,
+		Source:           f.source,
+		ErrorContains:    f.errorLike,
+		OlderThanSeconds: int32(f.olderThan.Seconds()),
+		ProcessorVersion: *version,
+		MaxRows:          int32(*limit),
+	})
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "INSTANCE\tSOURCE\tSTATUS\tATTEMPTS\tLAST ATTEMPT\tVERSION\tERROR")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\t%s\t%s\n", e.InstanceID, e.Source, e.Status, e.AttemptCount,
+			e.LastAttemptAt.Format(time.RFC3339), e.ProcessorVersion.String, e.Error.String)
+	}
+	return w.Flush()
+}
+
+// Only flips entries back to queued, nothing is published. The backfiller
+// crawls them again once they're stale and within its window, older instances
+// have to go through requeue
+func reset(ctx context.Context, queries *db.Queries, args []string) error {
+	fs := flag.NewFlagSet("reset", flag.ExitOnError)
+	var f filters
+	f.register(fs)
+	fs.Parse(args)
+
+	switch ledger.Status(f.status) {
+	// Claims are only committed with their outcome, processing entries were
+	// left behind by processors from before the ledger was transactional
+	case ledger.ERROR, ledger.DEAD, ledger.PROCESSING:
+	default:
+		return fmt.Errorf("-status must be one of %s, %s or %s", ledger.ERROR, ledger.DEAD, ledger.PROCESSING)
+	}
+
+	reset, err := queries.ResetLogEntries(ctx, db.ResetLogEntriesParams{
+		Status:           f.status,
+		Source:           f.source,
+		ErrorContains:    f.errorLike,
+		OlderThanSeconds: int32(f.olderThan.Seconds()),
+	})
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Reset ledger entries to queued, run requeue to crawl them right away", "entries", reset, "from", f.status)
+	return nil
+}
+
+func requeue(ctx context.Context, queries *db.Queries, args []string) error {
+	fs := flag.NewFlagSet("requeue", flag.ExitOnError)
+	var f filters
+	f.register(fs)
+	limit := fs.Int("limit", 100, "max number of entries selected through the filters")
+	apiKey := fs.String("api-key", os.Getenv(net.BUNGIE_API_KEY_ENV), "Bungie API key used to crawl the instances again, only used without -upstream")
+	maxSize := fs.Int64("max-size", net.MAX_REQUEST_SIZE_KB, "max size in bytes of a pgcr, raise it to requeue oversized instances")
+	upstream := fs.String("upstream", os.Getenv(net.UPSTREAM_URL_ENV), "base url of the proxy the instances are crawled through, Bungie is called directly when empty")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ledger requeue [flags] [instance id...]")
+		fmt.Fprintln(fs.Output(), "Instances are either given as arguments or selected through the filters")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	instanceIds := []int64{}
+	for _, arg := range fs.Args() {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid instance id %q: %w", arg, err)
+		}
+		instanceIds = append(instanceIds, id)
+	}
+
+	if len(instanceIds) == 0 {
+		if f.status == "" {
+			return fmt.Errorf("either instance ids or -status are required")
+		}
+		entries, err := queries.ListLogEntries(ctx, db.ListLogEntriesParams{
+			Status:           f.status,
+			Source:           f.source,
+			ErrorContains:    f.errorLike,
+			OlderThanSeconds: int32(f.olderThan.Seconds()),
+			MaxRows:          int32(*limit),
+		})
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			instanceIds = append(instanceIds, e.InstanceID)
+		}
+	}
+
+	queued := []int64{}
+	for _, id := range instanceIds {
+		rows, err := queries.QueueLogEntry(ctx, db.QueueLogEntryParams{InstanceID: id, Source: "crawler"})
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			slog.Warn("Instance was already processed successfully, use reprocess to rebuild it instead", "instanceId", id)
+			continue
+		}
+		queued = append(queued, id)
+	}
+	if len(queued) == 0 {
+		return nil
+	}
+
+	rabbitmq, err := rabbitmq.Connect(types.RabbitQueueName, types.RabbitMQUrl)
+	if err != nil {
+		return err
+	}
+	defer rabbitmq.Conn.Close()
+
+	client := http.Client{
+		Transport: &transport.DecodingTransport{
+			Base: &transport.TokenTransport{
+				Token: os.Getenv(net.PROXY_TOKEN_ENV),
+				Base:  http.DefaultTransport,
+			},
+			MaxSize: *maxSize,
+		},
+		Timeout: 10 * time.Second,
+	}
+
+	crawler := crawling.NewPgcrCrawler(rabbitmq, &client, nil)
+	// Instances still over the limit are parked as oversized again
+	crawler.Ledger = crawling.NewPostgresLedger(queries, 1)
+	// The proxy injects its own keys
+	if *upstream != "" {
+		crawler.BaseUrl = *upstream
+		*apiKey = ""
+	}
+	if err := crawler.Requeue(ctx, queued, *apiKey); err != nil {
+		return err
+	}
+
+	slog.Info("Requeued instances", "instances", len(queued))
+	return nil
+}
+
+func stats(ctx context.Context, queries *db.Queries, args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	top := fs.Int("errors", 20, "number of distinct error messages to print")
+	fs.Parse(args)
+
+	counts, err := queries.CountLogEntriesByStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tENTRIES")
+	for _, c := range counts {
+		fmt.Fprintf(w, "%s\t%d\n", c.Status, c.Entries)
+	}
+
+	versions, err := queries.CountLogEntriesByVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "\nVERSION\tSUCCESSFUL ENTRIES")
+	for _, v := range versions {
+		fmt.Fprintf(w, "%s\t%d\n", cmp.Or(v.ProcessorVersion, "unknown"), v.Entries)
+	}
+
+	failures, err := queries.CountLogErrors(ctx, int32(*top))
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "\nSTATUS\tENTRIES\tERROR")
+	for _, f := range failures {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", f.Status, f.Entries, nullString(f.Error))
+	}
+	return w.Flush()
+}
+
+func coverage(ctx context.Context, queries *db.Queries, args []string) error {
+	fs := flag.NewFlagSet("coverage", flag.ExitOnError)
+	from := fs.Int64("from", 1, "first instance id of the window")
+	to := fs.Int64("to", 0, "last instance id of the window")
+	bucket := fs.Int64("bucket", 10_000, "instance ids per reported range")
+	fs.Parse(args)
+
+	if *to < *from || *bucket < 1 {
+		return fmt.Errorf("-to must be at least -from and -bucket positive")
+	}
+
+	ranges, err := crawling.NewBackfiller(queries, *to-*from+1).Coverage(ctx, *from, *to, *bucket)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "FROM\tTO\tSEEN\tHANDLED\tCOVERAGE")
+	for _, r := range ranges {
+		fmt.Fprintf(w, "%d\t%d\t%d\t%d\t%.2f%%\n", r.Start, r.End, r.Seen, r.Handled, r.Percent())
+	}
+	return w.Flush()
+}
+
+func nullString(s sql.NullString) string {
+	if !s.Valid {
+		return "<none>"
+	}
+	return s.String
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"flag"
 	"log/slog"
 	"net/http"
 	"os"
@@ -12,11 +14,14 @@ import (
 
 	"pgcr-processing-service/internal/bungie"
 	"pgcr-processing-service/internal/cache"
+	"pgcr-processing-service/internal/compress"
 	"pgcr-processing-service/internal/db"
 	"pgcr-processing-service/internal/mapper"
 	"pgcr-processing-service/internal/processing"
 	"pgcr-processing-service/internal/rabbitmq"
+	"pgcr-processing-service/internal/transport"
 	"pgcr-processing-service/internal/types/manifest"
+	"pgcr-processing-service/internal/types/net"
 	rabbitmq1 "pgcr-processing-service/internal/types/rabbitmq"
 
 	"github.com/redis/go-redis/v9"
@@ -29,6 +34,20 @@ var (
 )
 
 func main() {
+	codecName := flag.String("codec", compress.DEFAULT_CODEC.String(), "codec new raw pgcrs are stored with, gzip or zstd-v1")
+	flag.Parse()
+
+	codec, err := compress.ParseCodec(*codecName)
+	if err != nil {
+		slog.Error("Invalid -codec", "error", err)
+		os.Exit(2)
+	}
+	compressor, err := compress.ForCodec(codec)
+	if err != nil {
+		slog.Error("Unable to create the pgcr compressor", "codec", codec, "error", err)
+		os.Exit(1)
+	}
+
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGQUIT)
 	defer cancel()
 
@@ -60,9 +79,15 @@ func main() {
 	})
 	defer redis.Close()
 
-	cacheService := cache.NewService(redis, 12*time.Hour, bungie.BungieManifestFetcher[manifest.ManifestEntry](http.DefaultClient, ""))
+	// Manifest requests go through the proxy too when one is configured
+	manifestClient := &http.Client{Transport: &transport.TokenTransport{
+		Token: os.Getenv(net.PROXY_TOKEN_ENV),
+		Base:  http.DefaultTransport,
+	}}
+	upstream := cmp.Or(os.Getenv(net.UPSTREAM_URL_ENV), net.BUNGIE_URL)
+	cacheService := cache.NewService(redis, 12*time.Hour, bungie.BungieManifestFetcher[manifest.ManifestEntry](manifestClient, upstream, ""))
 	mapper := mapper.New(cacheService)
-	processor := processing.NewProcessor(conn, queries, rabbitmq, mapper, cacheService)
+	processor := processing.NewProcessor(conn, queries, rabbitmq, mapper, cacheService, compressor)
 
 	var wg sync.WaitGroup
 	for i := range goroutines {
@@ -7,161 +7,136 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"net"
 	"net/http"
-	"net/http/httputil"
 	"net/netip"
-	"os"
-	"os/exec"
-	"strings"
-	"sync/atomic"
-	"time"
 
+	"pgcr-processing-service/internal/proxy"
 	"pgcr-processing-service/internal/utils"
-
-	"golang.org/x/time/rate"
 )
 
 var (
-	ipv6interface = flag.String("interface", "eth0", "Ipv6 interface to use")
-	ipv6n         = flag.Int("n", 16, "Number of sequential Ipv6 addresses")
-	port          = flag.Int("port", 8081, "Port to listen on")
-	printAddrs    = flag.Bool("print_addrs", false, "Print Ipv6 addresses")
+	configPath    = flag.String("config", "", "Proxy config file with the source address pools, see proxy.example.yaml")
+	ipv6interface = flag.String("interface", "eth0", "Ipv6 interface to use, without -config")
+	ipv6n         = flag.Int("n", 16, "Number of sequential Ipv6 addresses, without -config")
+	port          = flag.Int("port", 8081, "Port to listen on, without -config")
+	adminPort     = flag.Int("admin_port", 8082, "Port serving metrics and the admin endpoints, without -config")
+	printAddrs    = flag.Bool("print_addrs", false, "Print the ip commands for the addresses instead of plumbing them")
 	verbose       = flag.Bool("verbose", false, "Print logs")
 )
 
-var (
-	rateIntervalSeconds = 10
-	rateInterval        = time.Second * time.Duration(rateIntervalSeconds)
-)
-
-type transport struct {
-	nW      atomic.Int64
-	nS      atomic.Int64
-	rt      []http.RoundTripper
-	statsRl []*rate.Limiter
-	wwwRl   []*rate.Limiter
-}
-
-var (
-	proxyTransport        = &transport{}
-	statsDomain    string = "stats.bungie.net"
-	baseDomain     string = "www.bungie.net"
-	statsPath      string = "Destiny2/Stats/PostGameCarnageReport"
-)
-
-func ReadSecret(path string) (string, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return "", err
-	}
-	return strings.TrimSpace(string(data)), nil
-}
-
 func main() {
 	flag.Parse()
 
-	addressPath, err := utils.ReadSecret("INITIAL_ADDR")
+	config, err := loadConfig()
 	if err != nil {
-		log.Fatal("IPV6 env variable must be passed")
+		log.Fatalf("Invalid proxy config: %v", err)
+	}
+	if *printAddrs {
+		config.Plumb = proxy.PLUMB_DRY_RUN
 	}
+	config.Verbose = config.Verbose || *verbose
 
-	address, err := utils.ReadSecret(addressPath)
+	// Addresses that failed to plumb only fail the requests dialed from them
+	if err := proxy.PlumbAll(config); err != nil {
+		log.Printf("Failed to plumb some source addresses: %v", err)
+	}
+
+	addrs, err := config.Addresses()
 	if err != nil {
-		log.Fatalf("Error parsing IPv6 address from docker secret: %v", err)
+		log.Fatalf("Invalid proxy config: %v", err)
 	}
 
-	addr := netip.MustParseAddr(address)
+	transport := proxy.NewTransport(addrs, config.Limits)
+	transport.Verbose = config.Verbose
+	go transport.RunProbes(context.Background())
+	rp := proxy.NewReverseProxy(transport)
 
-	for range *ipv6n {
-		cmd := exec.Command("ip", "-6", "addr", "add", fmt.Sprintf("%s/64", addr.String()), "dev", *ipv6interface)
+	mux := http.NewServeMux()
+	admin := http.NewServeMux()
 
-		if output, err := cmd.CombinedOutput(); err != nil {
-			if *verbose {
-				log.Printf("Failed to add IP %s: %v | Output: %s", addr.String(), err, string(output))
-			}
-		} else if *verbose {
-			log.Printf("Successfully plumbed %s onto %s", addr.String(), *ipv6interface)
-		}
+	healthcheck := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, "Ok")
+	}
+	mux.HandleFunc("/healthcheck", healthcheck)
+	admin.HandleFunc("/healthcheck", healthcheck)
 
-		d := &net.Dialer{
-			LocalAddr: &net.TCPAddr{
-				IP: net.IP(addr.AsSlice()),
-			},
-			Timeout:   30 * time.Second,
-			KeepAlive: 30 * time.Second,
-		}
-		rt := http.DefaultTransport.(*http.Transport).Clone()
-		rt.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
-			conn, err := d.DialContext(ctx, network, addr)
-			if err != nil {
-				log.Fatalf("Something happened while building transport: %v", err)
-			}
-			return conn, err
-		}
+	admin.Handle("/admin/sources", proxy.StatusHandler(transport))
 
-		if *printAddrs {
-			fmt.Printf("sudo ip -6 addr add %s/64 dev %s\n", addr.String(), *ipv6interface)
+	var cache *proxy.Cache
+	var upstream http.Handler = rp
+	if config.Cache != nil {
+		store, err := proxy.NewCacheStore(config.Cache)
+		if err != nil {
+			log.Fatalf("Unable to open response cache: %v", err)
 		}
-
-		proxyTransport.statsRl = append(proxyTransport.statsRl, rate.NewLimiter(rate.Every(time.Second/40), 90))
-		proxyTransport.wwwRl = append(proxyTransport.wwwRl, rate.NewLimiter(rate.Every(time.Second/40), 90))
-		proxyTransport.rt = append(proxyTransport.rt, rt)
-		addr = addr.Next()
-	}
-
-	rp := &httputil.ReverseProxy{
-		Director: func(r *http.Request) {
-			if strings.Contains(r.URL.Path, statsPath) {
-				r.URL.Host = statsDomain
-			} else {
-				r.URL.Host = baseDomain
-			}
-			r.URL.Scheme = "https"
-			r.Header.Set("User-Agent", "rivenbot")
-			r.Header.Del("x-forwarded-for")
-		},
-		Transport: proxyTransport,
+		cache, err = proxy.NewCache(config.Cache, store)
+		if err != nil {
+			log.Fatalf("Invalid response cache config: %v", err)
+		}
+		upstream = cache.Handler(rp)
+		admin.Handle("/admin/cache", proxy.StatsHandler(cache))
 	}
 
-	mux := http.NewServeMux()
-
-	mux.HandleFunc("/healthcheck", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		io.WriteString(w, "Ok")
-	})
+	// Quotas apply to cache hits too, they're requests all the same
+	auth := proxy.NewAuth(config.ApiKeys, config.Clients)
+	upstream = auth.Handler(upstream)
+	admin.Handle("/admin/clients", proxy.ClientsHandler(auth))
+	admin.Handle("/metrics", proxy.MetricsHandler(transport, cache, auth))
 
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.Header.Get("x-betteruptime-probe") != "" {
 			io.WriteString(w, "Ok")
 			return
 		}
-		rp.ServeHTTP(w, r)
+		upstream.ServeHTTP(w, r)
 	})
 
-	log.Printf("Ready on port %d", *port)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", *port), mux))
+	go func() {
+		log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", config.AdminPort), admin))
+	}()
+
+	log.Printf("Ready on port %d with %d source addresses, %d api keys and %d clients, admin on port %d", config.Port, len(addrs), len(config.ApiKeys), len(config.Clients), config.AdminPort)
+	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", config.Port), mux))
 }
 
-func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
-	var rl *rate.Limiter
-	var n int64
-
-	if strings.Contains(r.URL.Path, statsPath) {
-		n = t.nS.Add(1)
-		r.Host = statsDomain
-		rl = t.statsRl[n%int64(len(t.statsRl))]
-	} else {
-		n = t.nW.Add(1)
-		r.Host = baseDomain
-		rl = t.wwwRl[n%int64(len(t.wwwRl))]
+// Without a config file a single pool of sequential addresses starting at the
+// one in the INITIAL_ADDR docker secret is plumbed onto the interface
+func loadConfig() (*proxy.Config, error) {
+	if *configPath != "" {
+		return proxy.LoadConfig(*configPath)
+	}
+
+	addressPath, err := utils.ReadSecret("INITIAL_ADDR")
+	if err != nil {
+		return nil, fmt.Errorf("either -config or the INITIAL_ADDR secret must be passed: %w", err)
+	}
+
+	address, err := utils.ReadSecret(addressPath)
+	if err != nil {
+		return nil, fmt.Errorf("parsing IPv6 address from docker secret: %w", err)
+	}
+
+	addr, err := netip.ParseAddr(address)
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := addr.Prefix(64)
+	if err != nil {
+		return nil, err
 	}
 
-	if *verbose {
-		log.Printf("Sending request: %s\n", r.URL.String())
-		log.Printf("Request headers: %s\n", r.Header)
+	config := &proxy.Config{
+		Port:      *port,
+		AdminPort: *adminPort,
+		Interface: *ipv6interface,
+		Plumb:     proxy.PLUMB_NETLINK,
+		Pools: []proxy.PoolConfig{{
+			Name:  "initial",
+			Cidr:  prefix.String(),
+			Start: addr.String(),
+			Count: *ipv6n,
+		}},
 	}
-	rt := t.rt[n%int64(len(t.rt))]
-	rl.Wait(r.Context())
-	return rt.RoundTrip(r)
+	return config, config.Validate()
 }
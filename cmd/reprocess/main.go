@@ -0,0 +1,122 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"pgcr-processing-service/internal/bungie"
+	"pgcr-processing-service/internal/cache"
+	"pgcr-processing-service/internal/compress"
+	"pgcr-processing-service/internal/db"
+	"pgcr-processing-service/internal/mapper"
+	"pgcr-processing-service/internal/processing"
+	"pgcr-processing-service/internal/transport"
+	"pgcr-processing-service/internal/types/manifest"
+	"pgcr-processing-service/internal/types/net"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	postgresUrl = "postgres://%s:%s@postgres:5432/postgres?sslmode=disable"
+	redisUrl    = "redis:6379"
+)
+
+// Rebuilds the derived tables from the raw pgcrs kept in the pgcr table using
+// the current mapper, e.g. after fixing a mapping bug
+func main() {
+	from := flag.Int64("from", 0, "first instance id to reprocess")
+	to := flag.Int64("to", 0, "last instance id to reprocess, 0 for no limit")
+	raid := flag.String("raid", "", "only reprocess instances of this raid, e.g. \"Last Wish\"")
+	status := flag.String("status", "", "only reprocess instances with this ingestion_log status")
+	batch := flag.Int("batch", 100, "number of pgcrs read from the db at a time")
+	dryRun := flag.Bool("dry-run", false, "roll back every change instead of committing it")
+	diff := flag.Bool("diff", false, "print the changed rows of every instance")
+	flag.Parse()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
+	defer cancel()
+
+	conn, err := db.Connect(ctx, postgresUrl)
+	if err != nil {
+		slog.Error("Error happened while connecting to DB", "error", err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+
+	queries, err := db.Prepare(ctx, conn)
+	if err != nil {
+		slog.Error("Error creating and preparing queries", "error", err)
+		os.Exit(1)
+	}
+
+	redis := redis.NewClient(&redis.Options{
+		Addr:     redisUrl,
+		Password: "",
+		DB:       0,
+		Protocol: 2,
+	})
+	defer redis.Close()
+
+	// Manifest requests go through the proxy too when one is configured
+	manifestClient := &http.Client{Transport: &transport.TokenTransport{
+		Token: os.Getenv(net.PROXY_TOKEN_ENV),
+		Base:  http.DefaultTransport,
+	}}
+	upstream := cmp.Or(os.Getenv(net.UPSTREAM_URL_ENV), net.BUNGIE_URL)
+	cacheService := cache.NewService(redis, 12*time.Hour, bungie.BungieManifestFetcher[manifest.ManifestEntry](manifestClient, upstream, ""))
+	processor := processing.NewProcessor(conn, queries, nil, mapper.New(cacheService), cacheService, nil)
+
+	params := db.ListPgcrBlobsParams{
+		AfterID:   *from - 1,
+		ToID:      *to,
+		Raid:      *raid,
+		Status:    *status,
+		BatchSize: int32(*batch),
+	}
+
+	var reprocessed, changed, failed int
+	for ctx.Err() == nil {
+		rows, err := queries.ListPgcrBlobs(ctx, params)
+		if err != nil {
+			slog.Error("Failed to read stored pgcrs", "afterId", params.AfterID, "error", err)
+			os.Exit(1)
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		for _, row := range rows {
+			params.AfterID = row.InstanceID
+
+			d, err := processor.Reprocess(ctx, row.InstanceID, compress.Codec(row.Codec), row.Blob, *dryRun)
+			if err != nil {
+				slog.Error("Failed to reprocess instance", "instanceId", row.InstanceID, "error", err)
+				failed++
+				continue
+			}
+
+			reprocessed++
+			if d == "" {
+				continue
+			}
+			changed++
+			if *diff {
+				fmt.Printf("instance %d (-before +after):\n%s\n", row.InstanceID, d)
+			}
+		}
+	}
+
+	slog.Info("Finished reprocessing", "reprocessed", reprocessed, "changed", changed, "failed", failed, "dryRun", *dryRun, "lastInstanceId", params.AfterID)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
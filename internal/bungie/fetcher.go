@@ -11,20 +11,24 @@ import (
 )
 
 var (
-	manifestUrl  = "https://www.bungie.net/Platform/Destiny2/Manifest/%s/%s/"
+	manifestPath = "/Platform/Destiny2/Manifest/%s/%s/"
 	apiKeyHeader = "x-api-key"
 )
 
-func BungieManifestFetcher[T any](client *http.Client, apiKey string) cache.Fetcher[T] {
+// BungieManifestFetcher fetches manifest entities from baseUrl, either Bungie or
+// the proxy in front of it
+func BungieManifestFetcher[T any](client *http.Client, baseUrl, apiKey string) cache.Fetcher[T] {
 	return func(ctx context.Context, entity, key string) (T, error) {
 		var zero T
 
-		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf(manifestUrl, entity, key), nil)
+		req, err := http.NewRequest(http.MethodGet, baseUrl+fmt.Sprintf(manifestPath, entity, key), nil)
 		if err != nil {
 			return zero, err
 		}
 
-		req.Header.Add(apiKeyHeader, apiKey)
+		if apiKey != "" {
+			req.Header.Add(apiKeyHeader, apiKey)
+		}
 		req.Header.Add("content-type", "application/json")
 
 		res, err := client.Do(req)
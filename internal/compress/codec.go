@@ -0,0 +1,83 @@
+package compress
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"pgcr-processing-service/internal/types/pgcr"
+)
+
+// Codec tags every stored pgcr blob with how it was compressed, so blobs stay
+// readable after the default codec or dictionary changes. Values are stored in
+// the pgcr table and must never be reused
+type Codec int16
+
+const (
+	CODEC_GZIP Codec = 1
+	// Zstandard with the dictionary trained on pgcrs in dictionaries/pgcr_v1.zstd
+	CODEC_ZSTD_V1 Codec = 2
+)
+
+var codecNames = map[Codec]string{
+	CODEC_GZIP:    "gzip",
+	CODEC_ZSTD_V1: "zstd-v1",
+}
+
+func (c Codec) String() string {
+	if name, ok := codecNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("codec(%d)", int16(c))
+}
+
+// PGCRCompressor compresses raw pgcrs as they came from Bungie, keeping every
+// field including the ones the processor doesn't model
+type PGCRCompressor interface {
+	Codec() Codec
+	Compress(raw []byte) ([]byte, error)
+	Decompress(blob []byte) ([]byte, error)
+}
+
+// DEFAULT_CODEC is what new pgcrs are stored with
+const DEFAULT_CODEC = CODEC_ZSTD_V1
+
+// ForCodec returns the compressor that reads and writes blobs of a codec
+func ForCodec(codec Codec) (PGCRCompressor, error) {
+	switch codec {
+	case CODEC_GZIP:
+		return gzipCompressor{}, nil
+	case CODEC_ZSTD_V1:
+		return zstdV1()
+	default:
+		return nil, fmt.Errorf("unknown pgcr codec %d", int16(codec))
+	}
+}
+
+// ParseCodec reads a codec by its name, e.g. from a flag
+func ParseCodec(name string) (Codec, error) {
+	for codec, n := range codecNames {
+		if n == name {
+			return codec, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown pgcr codec %q", name)
+}
+
+// Unpack decompresses a stored blob with its codec and decodes the pgcr in it
+func Unpack(codec Codec, blob []byte) (*pgcr.PostGameCarnageReportResponse, error) {
+	compressor, err := ForCodec(codec)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := compressor.Decompress(blob)
+	if err != nil {
+		return nil, err
+	}
+
+	var report pgcr.PostGameCarnageReportResponse
+	if err := json.Unmarshal(raw, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
@@ -0,0 +1,111 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"pgcr-processing-service/internal/types/pgcr"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Bungie fields the processor doesn't model have to survive a round trip
+var rawPgcr = []byte(`{"Response":{"period":"2020-11-22T04:32:36Z","startingPhaseIndex":2,"activityDetails":{"instanceId":"15934470341","mode":4},"notModeled":{"kept":true}},"ErrorCode":1}`)
+
+func TestCodecs_ShouldRoundTripRawPgcrs(t *testing.T) {
+	for _, codec := range []Codec{CODEC_GZIP, CODEC_ZSTD_V1} {
+		compressor, err := ForCodec(codec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if compressor.Codec() != codec {
+			t.Fatalf("Expected %s compressor, got %s", codec, compressor.Codec())
+		}
+
+		blob, err := compressor.Compress(rawPgcr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := compressor.Decompress(blob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(raw, rawPgcr) {
+			t.Fatalf("Raw pgcr changed after a %s round trip: %s", codec, raw)
+		}
+
+		decompressed, err := Unpack(codec, blob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decompressed.Response.ActivityDetails.InstanceId != "15934470341" || decompressed.Response.StartingPhaseIndex != 2 {
+			t.Fatalf("Pgcr changed after a %s round trip: %+v", codec, decompressed.Response)
+		}
+	}
+}
+
+// Frames record the id of the dictionary they were written with, a dictionary
+// trained with another id can't read them
+func TestPgcrV1Dictionary_ShouldCarryItsId(t *testing.T) {
+	dictionary, err := zstd.InspectDictionary(pgcrV1Dictionary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dictionary.ID() != PGCR_V1_DICTIONARY_ID {
+		t.Fatalf("Expected dictionary id %#x, got %#x", PGCR_V1_DICTIONARY_ID, dictionary.ID())
+	}
+}
+
+func TestUnpack_ShouldReadLegacyGzipBlobs(t *testing.T) {
+	// Blobs used to be the decoded pgcr marshalled again and gzipped
+	legacy := &pgcr.PostGameCarnageReportResponse{}
+	legacy.Response.ActivityDetails.InstanceId = "15934470341"
+	data, err := json.Marshal(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var blob bytes.Buffer
+	w := gzip.NewWriter(&blob)
+	w.Write(data)
+	w.Close()
+
+	decompressed, err := Unpack(CODEC_GZIP, blob.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decompressed.Response.ActivityDetails.InstanceId != "15934470341" {
+		t.Fatalf("Legacy pgcr not readable: %+v", decompressed.Response)
+	}
+}
+
+func TestParseCodec_ShouldRejectUnknownCodecs(t *testing.T) {
+	for codec, name := range codecNames {
+		parsed, err := ParseCodec(name)
+		if err != nil || parsed != codec {
+			t.Fatalf("Expected %s to parse, got %v and %v", name, parsed, err)
+		}
+	}
+	if _, err := ParseCodec("lz4"); err == nil {
+		t.Fatal("Expected an unknown codec name to fail")
+	}
+	if _, err := ForCodec(0); err == nil {
+		t.Fatal("Expected an unknown codec to fail")
+	}
+}
+
+func TestDecode_ShouldFailBodiesDecodingOverTheLimit(t *testing.T) {
+	var body bytes.Buffer
+	w := gzip.NewWriter(&body)
+	w.Write(bytes.Repeat([]byte("x"), 1000))
+	w.Close()
+
+	if decoded, err := Decode(ENCODING_GZIP, body.Bytes(), 1000); err != nil || len(decoded) != 1000 {
+		t.Fatalf("Expected the whole body at the limit, got %d bytes and %v", len(decoded), err)
+	}
+	if _, err := Decode(ENCODING_GZIP, body.Bytes(), 999); !errors.Is(err, ErrDecodedTooLarge) {
+		t.Fatalf("Expected ErrDecodedTooLarge, got %v", err)
+	}
+}
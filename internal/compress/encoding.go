@@ -0,0 +1,55 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Content encodings of Bungie responses and of the pgcrs published to the
+// processor, as in the Content-Encoding header
+const (
+	ENCODING_GZIP   = "gzip"
+	ENCODING_BROTLI = "br"
+)
+
+// NewDecoder decodes r as encoded with the given content encoding. Plain bodies
+// are read as is, the crawler used to mark them as utf-8
+func NewDecoder(encoding string, r io.Reader) (io.ReadCloser, error) {
+	switch encoding {
+	case "", "identity", "utf-8":
+		return io.NopCloser(r), nil
+	case ENCODING_GZIP:
+		return gzip.NewReader(r)
+	case ENCODING_BROTLI:
+		return io.NopCloser(brotli.NewReader(r)), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+}
+
+// ErrDecodedTooLarge is returned when a body decodes to more than allowed
+var ErrDecodedTooLarge = errors.New("decoded body too large")
+
+// Decode decodes a whole message body, failing once it decodes to more than
+// maxSize bytes so a small compressed body can't exhaust the memory
+func Decode(encoding string, data []byte, maxSize int64) ([]byte, error) {
+	r, err := NewDecoder(encoding, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	decoded, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(decoded)) > maxSize {
+		return nil, fmt.Errorf("%w: over the limit of %d bytes", ErrDecodedTooLarge, maxSize)
+	}
+	return decoded, nil
+}
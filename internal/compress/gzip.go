@@ -3,25 +3,22 @@ package compress
 import (
 	"bytes"
 	"compress/gzip"
-	"encoding/json"
-
-	"pgcr-processing-service/internal/types/pgcr"
+	"io"
 )
 
-type PGCRCompressor interface {
-	Compress(raw *pgcr.PostGameCarnageReportResponse) ([]byte, error)
-}
+// Gzip was the only codec before blobs were tagged with theirs, so untagged
+// blobs are gzipped pgcrs as re-marshalled by the processor back then
+type gzipCompressor struct{}
 
-func Gzip(raw *pgcr.PostGameCarnageReportResponse) ([]byte, error) {
-	jsonData, err := json.Marshal(raw)
-	if err != nil {
-		return nil, err
-	}
+func (gzipCompressor) Codec() Codec {
+	return CODEC_GZIP
+}
 
+func (gzipCompressor) Compress(raw []byte) ([]byte, error) {
 	var compressedBuffer bytes.Buffer
 	gzipWriter := gzip.NewWriter(&compressedBuffer)
 
-	_, err = gzipWriter.Write(jsonData)
+	_, err := gzipWriter.Write(raw)
 	if err != nil {
 		return nil, err
 	}
@@ -31,5 +28,15 @@ func Gzip(raw *pgcr.PostGameCarnageReportResponse) ([]byte, error) {
 		return nil, err
 	}
 
-	return compressedBuffer.Bytes(), err
+	return compressedBuffer.Bytes(), nil
+}
+
+func (gzipCompressor) Decompress(blob []byte) ([]byte, error) {
+	gzipReader, err := gzip.NewReader(bytes.NewReader(blob))
+	if err != nil {
+		return nil, err
+	}
+	defer gzipReader.Close()
+
+	return io.ReadAll(gzipReader)
 }
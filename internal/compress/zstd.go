@@ -0,0 +1,69 @@
+package compress
+
+import (
+	_ "embed"
+	"sync"
+
+	"github.com/klauspost/compress/dict"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Trained with cmd/dictionary on sample pgcrs, never to be retrained in place
+// since every CODEC_ZSTD_V1 blob needs it to be read. A new dictionary gets
+// its own file and codec
+//
+//go:embed dictionaries/pgcr_v1.zstd
+var pgcrV1Dictionary []byte
+
+// Ids of the pgcr dictionaries, written in the header of every frame
+const PGCR_V1_DICTIONARY_ID uint32 = 0x70676372
+
+// Pgcrs are written once and read rarely, so the space saved is worth the cpu
+const dictionaryLevel = zstd.SpeedBetterCompression
+
+// Encoders and decoders are safe for concurrent EncodeAll and DecodeAll
+// calls, so they're built once and shared
+var zstdV1 = sync.OnceValues(func() (PGCRCompressor, error) {
+	return newZstdCompressor(CODEC_ZSTD_V1, pgcrV1Dictionary)
+})
+
+type zstdCompressor struct {
+	codec   Codec
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+func newZstdCompressor(codec Codec, dictionary []byte) (*zstdCompressor, error) {
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderDict(dictionary), zstd.WithEncoderLevel(dictionaryLevel))
+	if err != nil {
+		return nil, err
+	}
+	decoder, err := zstd.NewReader(nil, zstd.WithDecoderDicts(dictionary), zstd.WithDecoderConcurrency(0))
+	if err != nil {
+		return nil, err
+	}
+	return &zstdCompressor{codec: codec, encoder: encoder, decoder: decoder}, nil
+}
+
+func (z *zstdCompressor) Codec() Codec {
+	return z.codec
+}
+
+func (z *zstdCompressor) Compress(raw []byte) ([]byte, error) {
+	return z.encoder.EncodeAll(raw, nil), nil
+}
+
+func (z *zstdCompressor) Decompress(blob []byte) ([]byte, error) {
+	return z.decoder.DecodeAll(blob, nil)
+}
+
+// TrainDictionary builds a zstd dictionary of at most maxSize bytes out of
+// sample raw pgcrs
+func TrainDictionary(samples [][]byte, id uint32, maxSize int) ([]byte, error) {
+	return dict.BuildZstdDict(samples, dict.Options{
+		MaxDictSize: maxSize,
+		HashBytes:   6,
+		ZstdDictID:  id,
+		ZstdLevel:   dictionaryLevel,
+	})
+}
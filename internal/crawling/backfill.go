@@ -0,0 +1,264 @@
+package crawling
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"pgcr-processing-service/internal/db"
+)
+
+// Gap is an inclusive range of instance ids the crawler never got to
+type Gap struct {
+	Start int64
+	End   int64
+}
+
+// RangeCoverage of an inclusive range of instance ids in the ingestion_log
+type RangeCoverage struct {
+	Start int64
+	End   int64
+	// Instances that made it past queued
+	Seen int64
+	// Instances that need no further crawling
+	Handled int64
+}
+
+func (r RangeCoverage) Percent() float64 {
+	return float64(r.Seen) * 100 / float64(r.End-r.Start+1)
+}
+
+// Role held by the one crawler that backfills, so gaps aren't crawled once per crawler
+const backfillRole = "backfill"
+
+// Backfiller looks for holes left behind the live crawl, e.g. by workers that
+// died or publishes that failed, and feeds them back to the crawler. Only the
+// crawler holding the backfill role in crawl_leader scans for them
+type Backfiller struct {
+	queries db.Querier
+	Owner   string
+	// How long the backfill role survives without being renewed
+	TTL time.Duration
+	// How far behind the live head gaps are looked for
+	Window int64
+	// Ids this close to the head may still be in flight and aren't gaps yet
+	Lag int64
+	// Queued entries older than this were lost on the way to the processor
+	StaleAfter time.Duration
+	// Max gaps fed back per scan, the rest is picked up by the next one
+	MaxGaps int32
+	// Size of the ranges coverage is reported for
+	BucketSize int64
+	Interval   time.Duration
+
+	head atomic.Int64
+}
+
+func NewBackfiller(queries db.Querier, window int64) *Backfiller {
+	return &Backfiller{
+		queries:    queries,
+		Owner:      defaultOwner(),
+		TTL:        5 * time.Minute,
+		Window:     window,
+		Lag:        1000,
+		StaleAfter: 10 * time.Minute,
+		MaxGaps:    100,
+		BucketSize: max(window/10, 1),
+		Interval:   time.Minute,
+	}
+}
+
+// Observe records the latest id handed out by the live crawl
+func (b *Backfiller) Observe(instanceId int64) {
+	for {
+		head := b.head.Load()
+		if instanceId <= head || b.head.CompareAndSwap(head, instanceId) {
+			return
+		}
+	}
+}
+
+// Run periodically scans the window behind the live head and sends every
+// missing id to out, until the context is cancelled. Scans are skipped while
+// another crawler holds the backfill role
+func (b *Backfiller) Run(ctx context.Context, out chan<- int64) {
+	defer close(out)
+
+	tick := time.NewTicker(b.Interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Context cancelled. Stopping backfill.")
+			return
+		case <-tick.C:
+		}
+
+		to := b.head.Load() - b.Lag
+		if to < 1 {
+			continue
+		}
+		from := max(to-b.Window+1, 1)
+
+		if !b.lead(ctx) {
+			continue
+		}
+		renewed := time.Now()
+
+		coverage, err := b.Coverage(ctx, from, to, b.BucketSize)
+		if err != nil {
+			slog.Error("Unable to compute crawl coverage", "from", from, "to", to, "error", err)
+			continue
+		}
+		for _, r := range coverage {
+			slog.Info("Crawl coverage", "from", r.Start, "to", r.End, "coverage", r.Percent(), "seen", r.Seen, "handled", r.Handled)
+		}
+
+		gaps, err := b.Gaps(ctx, from, to)
+		if err != nil {
+			slog.Error("Unable to look for gaps", "from", from, "to", to, "error", err)
+			continue
+		}
+
+	gaps:
+		for _, gap := range gaps {
+			slog.Info("Backfilling gap", "from", gap.Start, "to", gap.End)
+			for id := gap.Start; id <= gap.End; id++ {
+				// Sends are throttled, renew well before the role expires
+				if time.Since(renewed) > b.TTL/3 {
+					if !b.lead(ctx) {
+						break gaps
+					}
+					renewed = time.Now()
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case out <- id:
+				}
+			}
+		}
+	}
+}
+
+// Takes or renews the backfill role, false when another crawler holds it
+func (b *Backfiller) lead(ctx context.Context) bool {
+	rows, err := b.queries.ClaimLeadership(ctx, db.ClaimLeadershipParams{
+		Role:       backfillRole,
+		Owner:      b.Owner,
+		TtlSeconds: int32(b.TTL.Seconds()),
+	})
+	if err != nil {
+		slog.Error("Unable to claim the backfill role", "owner", b.Owner, "error", err)
+		return false
+	}
+	if rows == 0 {
+		slog.Debug("Another crawler is backfilling", "owner", b.Owner)
+		return false
+	}
+	return true
+}
+
+// Gaps returns the ranges of ids within [from, to] the crawler never got past queued
+func (b *Backfiller) Gaps(ctx context.Context, from, to int64) ([]Gap, error) {
+	rows, err := b.queries.ListLogGaps(ctx, db.ListLogGapsParams{
+		FromID:       from,
+		ToID:         to,
+		StaleSeconds: int32(b.StaleAfter.Seconds()),
+		MaxGaps:      b.MaxGaps,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	gaps := make([]Gap, 0, len(rows))
+	for _, row := range rows {
+		gaps = append(gaps, Gap{Start: row.GapStart, End: row.GapEnd})
+	}
+	return gaps, nil
+}
+
+// Coverage splits [from, to] in ranges of bucketSize ids, ranges without any
+// entry are reported with no coverage
+func (b *Backfiller) Coverage(ctx context.Context, from, to, bucketSize int64) ([]RangeCoverage, error) {
+	rows, err := b.queries.CountLogCoverage(ctx, db.CountLogCoverageParams{
+		FromID:     from,
+		BucketSize: bucketSize,
+		ToID:       to,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	counted := make(map[int64]db.CountLogCoverageRow, len(rows))
+	for _, row := range rows {
+		counted[row.RangeStart] = row
+	}
+
+	coverage := []RangeCoverage{}
+	for start := from; start <= to; start += bucketSize {
+		row := counted[start]
+		coverage = append(coverage, RangeCoverage{
+			Start:   start,
+			End:     min(start+bucketSize-1, to),
+			Seen:    row.Seen,
+			Handled: row.Handled,
+		})
+	}
+	return coverage, nil
+}
+
+// Prioritize merges the live and backfill ids into a single input for the
+// crawler. Backfill ids are only handed out while no live id is waiting, and
+// each waits for a tick of the throttle the live ids are generated on, so the
+// backfill doesn't add to the rate Bungie is called at.
+// The output is closed once the live input is
+func Prioritize(ctx context.Context, throttle <-chan time.Time, live, backfill <-chan int64, observe func(int64)) <-chan int64 {
+	out := make(chan int64)
+	go func() {
+		defer close(out)
+		for {
+			var next int64
+			var ok bool
+
+			select {
+			case next, ok = <-live:
+				if !ok {
+					return
+				}
+				observe(next)
+			default:
+				select {
+				case <-ctx.Done():
+					return
+				case next, ok = <-live:
+					if !ok {
+						return
+					}
+					observe(next)
+				case next, ok = <-backfill:
+					if !ok {
+						// Keep tailing without backfill
+						backfill = nil
+						continue
+					}
+					select {
+					case <-ctx.Done():
+						return
+					case <-throttle:
+					}
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case out <- next:
+			}
+		}
+	}()
+	return out
+}
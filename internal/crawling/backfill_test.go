@@ -0,0 +1,115 @@
+package crawling
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"pgcr-processing-service/internal/db"
+
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPrioritize_ShouldPreferLiveIds(t *testing.T) {
+	live := make(chan int64, 2)
+	backfill := make(chan int64, 2)
+	backfill <- 1
+	backfill <- 2
+	live <- 100
+	live <- 101
+
+	throttle := make(chan time.Time, 2)
+	throttle <- time.Now()
+	throttle <- time.Now()
+
+	var head int64
+	out := Prioritize(context.Background(), throttle, live, backfill, func(id int64) { head = id })
+
+	expected := []int64{100, 101, 1, 2}
+	for _, want := range expected {
+		if got := <-out; got != want {
+			t.Fatalf("Expected %d, got %d", want, got)
+		}
+	}
+	if head != 101 {
+		t.Fatalf("Expected live head 101, got %d", head)
+	}
+
+	close(live)
+	if _, ok := <-out; ok {
+		t.Fatal("Expected output to close with the live input")
+	}
+}
+
+func TestPrioritize_ShouldThrottleBackfillIds(t *testing.T) {
+	live := make(chan int64)
+	backfill := make(chan int64, 1)
+	backfill <- 1
+	throttle := make(chan time.Time)
+
+	out := Prioritize(context.Background(), throttle, live, backfill, func(int64) {})
+
+	select {
+	case id := <-out:
+		t.Fatalf("Expected backfill id %d to wait for the throttle", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	throttle <- time.Now()
+	if got := <-out; got != 1 {
+		t.Fatalf("Expected 1, got %d", got)
+	}
+	close(live)
+}
+
+func TestBackfiller_ShouldOnlyScanWhileLeading(t *testing.T) {
+	queries := &mockQuerier{}
+	queries.On("ClaimLeadership", mock.Anything, mock.MatchedBy(func(arg db.ClaimLeadershipParams) bool {
+		return arg.Role == backfillRole && arg.Owner == "crawler-2"
+	})).Return(int64(0), nil)
+
+	backfiller := NewBackfiller(queries, 100)
+	backfiller.Owner = "crawler-2"
+	backfiller.Interval = time.Millisecond
+	backfiller.Lag = 10
+	backfiller.Observe(500)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	out := make(chan int64)
+	go backfiller.Run(ctx, out)
+
+	if id, ok := <-out; ok {
+		t.Fatalf("Expected no backfill without the role, got %d", id)
+	}
+	queries.AssertCalled(t, "ClaimLeadership", mock.Anything, mock.Anything)
+	queries.AssertNotCalled(t, "CountLogCoverage", mock.Anything, mock.Anything)
+}
+
+func TestBackfiller_ShouldReportRangesWithoutEntries(t *testing.T) {
+	queries := &mockQuerier{}
+	queries.On("CountLogCoverage", mock.Anything, db.CountLogCoverageParams{FromID: 1, BucketSize: 10, ToID: 25}).
+		Return([]db.CountLogCoverageRow{{RangeStart: 11, Seen: 5, Handled: 4}}, nil)
+
+	coverage, err := NewBackfiller(queries, 25).Coverage(context.Background(), 1, 25, 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []RangeCoverage{
+		{Start: 1, End: 10},
+		{Start: 11, End: 20, Seen: 5, Handled: 4},
+		{Start: 21, End: 25},
+	}
+	if len(coverage) != len(expected) {
+		t.Fatalf("Expected %d ranges, got %v", len(expected), coverage)
+	}
+	for i := range expected {
+		if coverage[i] != expected[i] {
+			t.Fatalf("Expected %v, got %v", expected[i], coverage[i])
+		}
+	}
+	if coverage[1].Percent() != 50 {
+		t.Fatalf("Expected 50%% coverage, got %f", coverage[1].Percent())
+	}
+}
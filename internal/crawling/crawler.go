@@ -2,36 +2,52 @@ package crawling
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"strconv"
+	"time"
 
 	"pgcr-processing-service/internal/rabbitmq"
+	"pgcr-processing-service/internal/transport"
+	"pgcr-processing-service/internal/types/history"
+	"pgcr-processing-service/internal/types/net"
 
 	"github.com/rabbitmq/amqp091-go"
 )
 
+// Source recorded for crawled instances, both in the ledger and the amqp headers
+const crawlerSource = "crawler"
+
 var (
 	keyHeaderName = "x-api-key"
-	baseUrl       = "https://stats.bungie.net/Platform/Destiny2/Stats/PostGameCarnageReport/%d/"
+	pgcrPath      = "/Platform/Destiny2/Stats/PostGameCarnageReport/%d/"
 )
 
 type PgcrCrawler struct {
-	Offset   int64
-	MaxSize  int64
-	In       <-chan int64
+	// Bungie's stats domain, or the proxy in front of it
+	BaseUrl string
+	Offset  int64
+	In      <-chan int64
+	// Expected to fail oversized responses with transport.ErrResponseTooLarge
 	Client   *http.Client
 	Rabbitmq *rabbitmq.RabbitMQ
+	// Optional, every instance is crawled when unset
+	Ledger Ledger
+	// Publishes pgcrs still compressed as they came from Bungie, along with
+	// their content encoding, for the processor to decode
+	PublishEncoded bool
 }
 
-func NewPgcrCrawler(rabbitmq *rabbitmq.RabbitMQ, client *http.Client, gen <-chan int64, maxSize int64) *PgcrCrawler {
+func NewPgcrCrawler(rabbitmq *rabbitmq.RabbitMQ, client *http.Client, gen <-chan int64) *PgcrCrawler {
 	return &PgcrCrawler{
+		BaseUrl:  net.BUNGIE_STATS_URL,
 		Rabbitmq: rabbitmq,
 		Client:   client,
 		In:       gen,
-		MaxSize:  maxSize,
 	}
 }
 
@@ -52,50 +68,205 @@ func (c *PgcrCrawler) Crawl(ctx context.Context, id int64, apiKey string) {
 				slog.Info("Input channel closed. Exiting", "workerId", id)
 				return
 			}
-			slog.Info("Worker processing pgcr", "workerId", id, "pgcr", next)
-			url := fmt.Sprintf(baseUrl, next)
-			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-			if err != nil {
-				slog.Error("Worker unable to create requests. Exiting.", "workerId", id, "error", err)
-				return
-			}
+			if c.Ledger != nil {
+				// The ledger is an optimization, crawl anyway when it can't be reached
+				handled, err := c.Ledger.Handled(ctx, next)
+				if err != nil {
+					slog.Warn("Unable to check the ingestion ledger", "workerId", id, "pgcr", next, "error", err)
+				} else if handled {
+					slog.Debug("Pgcr already ingested, skipping", "workerId", id, "pgcr", next)
+					continue
+				}
 
-			req.Header.Add(keyHeaderName, apiKey)
-			res, err := c.Client.Do(req)
-			if err != nil {
-				slog.Error("Unable to get a response from Bungie. Exiting.", "workerId", id, "error", err)
-				return
+				if err := c.Ledger.Queued(ctx, next); err != nil {
+					slog.Warn("Unable to record queued pgcr", "workerId", id, "pgcr", next, "error", err)
+				}
 			}
 
-			// Stop if there's errors reading HTTP bodies from requests
-			data, err := io.ReadAll(res.Body)
-			res.Body.Close()
-			if err != nil {
-				slog.Error("Error reading response body", "error", err)
-				return
+			slog.Info("Worker processing pgcr", "workerId", id, "pgcr", next)
+			data, encoding, err := c.fetch(ctx, next, apiKey)
+			if errors.Is(err, transport.ErrResponseTooLarge) {
+				c.oversized(ctx, next, err)
+				continue
 			}
-
-			slog.Debug("Response raw data", "data", string(data))
-			if int64(len(data)) > c.MaxSize {
-				slog.Error(fmt.Sprintf("Response exceeded limit of %d bytes, refusing to process", c.MaxSize), "workerId", id, "pgcr", next)
+			// Nothing is published, the entry stays queued until the backfill
+			// picks it up again
+			if err != nil {
+				slog.Error("Unable to fetch pgcr from Bungie", "workerId", id, "pgcr", next, "error", err)
+				c.backoff(ctx, err)
 				continue
 			}
 
-			publishing := amqp091.Publishing{
-				MessageId: strconv.FormatInt(next, 10),
-				Headers: map[string]any{
-					"source": "Crawler",
-				},
-				ContentType:     "application/json",
-				ContentEncoding: "utf-8",
-				Body:            data,
+			if err := c.publish(ctx, ch, next, data, encoding); err != nil {
+				slog.Error("Unable to publish message", "messageId", next, "crawlerId", id)
+				continue
 			}
 
-			if err := ch.PublishWithContext(ctx, "", c.Rabbitmq.Queue.Name, false, false, publishing); err != nil {
-				slog.Error("Unable to publish message", "messageId", next, "crawlerId", id)
+			if c.Ledger != nil {
+				if err := c.Ledger.Fetched(ctx, next); err != nil {
+					slog.Warn("Unable to record fetched pgcr", "workerId", id, "pgcr", next, "error", err)
+				}
 			}
 
 			slog.Info("Successfully published pgcr", "pgcr", next)
 		}
 	}
 }
+
+// Requeue crawls the given instances again outside of the regular sequence and
+// publishes them for processing
+func (c *PgcrCrawler) Requeue(ctx context.Context, instanceIds []int64, apiKey string) error {
+	ch, err := c.Rabbitmq.Conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	var errs []error
+	for _, instanceId := range instanceIds {
+		data, encoding, err := c.fetch(ctx, instanceId, apiKey)
+		if errors.Is(err, transport.ErrResponseTooLarge) {
+			c.oversized(ctx, instanceId, err)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("pgcr %d: %w", instanceId, err))
+			continue
+		}
+
+		if err := c.publish(ctx, ch, instanceId, data, encoding); err != nil {
+			errs = append(errs, fmt.Errorf("pgcr %d: %w", instanceId, err))
+			continue
+		}
+		slog.Info("Successfully requeued pgcr", "pgcr", instanceId)
+	}
+	return errors.Join(errs...)
+}
+
+// Fetches a pgcr, still compressed along with its content encoding when
+// PublishEncoded is set and the client's transport kept the encoded body
+func (c *PgcrCrawler) fetch(ctx context.Context, instanceId int64, apiKey string) ([]byte, string, error) {
+	var encoded transport.EncodedBody
+	if c.PublishEncoded {
+		ctx = transport.WithEncodedBody(ctx, &encoded)
+	}
+
+	url := c.BaseUrl + fmt.Sprintf(pgcrPath, instanceId)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// No key when going through the proxy, it injects its own
+	if apiKey != "" {
+		req.Header.Add(keyHeaderName, apiKey)
+	}
+	res, err := c.Client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	slog.Debug("Response raw data", "data", string(data))
+	if _, err := checkResponse(res, data); err != nil {
+		return nil, "", err
+	}
+	if encoded.Encoding != "" {
+		return encoded.Bytes(), encoded.Encoding, nil
+	}
+	return data, "", nil
+}
+
+// Waits for as long as Bungie asked to back off after a failed request
+func (c *PgcrCrawler) backoff(ctx context.Context, err error) {
+	var resErr *ResponseError
+	if !errors.As(err, &resErr) || resErr.ThrottleFor == 0 {
+		return
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(resErr.ThrottleFor):
+	}
+}
+
+// ResponseError is a response that isn't a successful Bungie response, e.g. a
+// throttle, an error of the proxy or a pgcr past the head that doesn't exist yet
+type ResponseError struct {
+	Status      int
+	ErrorCode   int
+	ErrorStatus string
+	// How long Bungie asked to back off for
+	ThrottleFor time.Duration
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("request failed with status %d: %s (%d)", e.Status, e.ErrorStatus, e.ErrorCode)
+}
+
+// Bungie's envelope around every response
+type envelope struct {
+	ErrorCode       int    `json:"ErrorCode"`
+	ErrorStatus     string `json:"ErrorStatus"`
+	ThrottleSeconds int    `json:"ThrottleSeconds"`
+}
+
+// Reads Bungie's envelope off a decoded response body. Returns how long Bungie
+// asked to back off for, and a ResponseError unless the request succeeded
+func checkResponse(res *http.Response, data []byte) (time.Duration, error) {
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		// e.g. the proxy's plain text errors and html error pages
+		return 0, &ResponseError{Status: res.StatusCode, ErrorStatus: http.StatusText(res.StatusCode)}
+	}
+
+	backoff := time.Duration(env.ThrottleSeconds) * time.Second
+	if seconds, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil {
+		backoff = max(backoff, time.Duration(seconds)*time.Second)
+	}
+	if res.StatusCode != http.StatusOK || env.ErrorCode != history.SUCCESS_ERROR_CODE {
+		return backoff, &ResponseError{
+			Status:      res.StatusCode,
+			ErrorCode:   env.ErrorCode,
+			ErrorStatus: env.ErrorStatus,
+			ThrottleFor: backoff,
+		}
+	}
+	return backoff, nil
+}
+
+// Parks an oversized pgcr in the ledger so it can be requeued with a higher
+// limit instead of being lost
+func (c *PgcrCrawler) oversized(ctx context.Context, instanceId int64, cause error) {
+	if c.Ledger == nil {
+		slog.Error("Pgcr over the size limit dropped, no ledger to park it in", "pgcr", instanceId, "error", cause)
+		return
+	}
+
+	slog.Warn("Pgcr over the size limit, parked in the ledger", "pgcr", instanceId, "error", cause)
+	if err := c.Ledger.Oversized(ctx, instanceId, cause.Error()); err != nil {
+		slog.Error("Unable to record oversized pgcr", "pgcr", instanceId, "error", err)
+	}
+}
+
+// Plain pgcrs are published as utf-8, as they always were
+func (c *PgcrCrawler) publish(ctx context.Context, ch *amqp091.Channel, instanceId int64, data []byte, encoding string) error {
+	if encoding == "" {
+		encoding = "utf-8"
+	}
+
+	publishing := amqp091.Publishing{
+		MessageId: strconv.FormatInt(instanceId, 10),
+		Headers: map[string]any{
+			"source": crawlerSource,
+		},
+		ContentType:     "application/json",
+		ContentEncoding: encoding,
+		Body:            data,
+	}
+
+	return ch.PublishWithContext(ctx, "", c.Rabbitmq.Queue.Name, false, false, publishing)
+}
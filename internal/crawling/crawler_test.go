@@ -0,0 +1,50 @@
+package crawling
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFetch_ShouldFailResponsesThatArentPgcrs(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case fmt.Sprintf(pgcrPath, 1):
+			fmt.Fprint(w, `{"Response": {"activityDetails": {"instanceId": "1", "mode": 4}}, "ErrorCode": 1}`)
+		case fmt.Sprintf(pgcrPath, 2):
+			fmt.Fprint(w, `{"ErrorCode": 37, "ErrorStatus": "ThrottleLimitExceededMomentarily", "ThrottleSeconds": 3}`)
+		case fmt.Sprintf(pgcrPath, 3):
+			fmt.Fprint(w, `{"ErrorCode": 1653, "ErrorStatus": "DestinyPGCRNotFound"}`)
+		default:
+			http.Error(w, "unknown proxy token", http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	crawler := NewPgcrCrawler(nil, srv.Client(), nil)
+	crawler.BaseUrl = srv.URL
+
+	if _, _, err := crawler.fetch(context.Background(), 1, ""); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[int64]ResponseError{
+		2: {Status: http.StatusOK, ErrorCode: 37, ErrorStatus: "ThrottleLimitExceededMomentarily", ThrottleFor: 3 * time.Second},
+		3: {Status: http.StatusOK, ErrorCode: 1653, ErrorStatus: "DestinyPGCRNotFound"},
+		4: {Status: http.StatusUnauthorized, ErrorStatus: "Unauthorized"},
+	}
+	for instanceId, want := range expected {
+		data, _, err := crawler.fetch(context.Background(), instanceId, "")
+		var resErr *ResponseError
+		if !errors.As(err, &resErr) || *resErr != want {
+			t.Fatalf("Expected %+v for %d, got %v", want, instanceId, err)
+		}
+		if data != nil {
+			t.Fatalf("Expected nothing to publish for %d, got %q", instanceId, data)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package crawling
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pgcr-processing-service/internal/db"
+	"pgcr-processing-service/internal/types/history"
+	"pgcr-processing-service/internal/types/net"
+)
+
+var (
+	profilePath = "/Platform/Destiny2/%d/Profile/%d/?components=100"
+	// Mode 4 is raids, 250 is the max page size
+	activitiesPath = "/Platform/Destiny2/%d/Account/%d/Character/%s/Stats/Activities/?mode=4&count=250&page=%d"
+)
+
+// Attempts of a request Bungie keeps throttling before the walk gives up
+const maxThrottledAttempts = 3
+
+// Private profiles come back without their characters
+var errNoVisibleCharacters = errors.New("profile has no visible characters")
+
+// Member identifies a Bungie account to walk the activity history of
+type Member struct {
+	MembershipType int32
+	MembershipId   int64
+}
+
+// HistoryWalker finds the raids of specific players through their activity
+// history instead of sequentially crawling every instance id
+type HistoryWalker struct {
+	queries db.Querier
+	// Bungie, or the proxy in front of it
+	BaseUrl string
+	Client  *http.Client
+	// Only sent when set, the proxy injects its own
+	ApiKey string
+	// Optional, every request waits for a tick when set
+	Throttle <-chan time.Time
+	// Players aren't walked again until this long after their previous walk
+	MinAge time.Duration
+	// Players read from destiny_player per pass
+	BatchSize int32
+	// Pause between passes that found nothing to walk
+	Idle time.Duration
+}
+
+func NewHistoryWalker(queries db.Querier, client *http.Client, apiKey string) *HistoryWalker {
+	return &HistoryWalker{
+		queries:   queries,
+		BaseUrl:   net.BUNGIE_URL,
+		Client:    client,
+		ApiKey:    apiKey,
+		MinAge:    24 * time.Hour,
+		BatchSize: 100,
+		Idle:      time.Minute,
+	}
+}
+
+// Run keeps walking the players in destiny_player that weren't walked within
+// MinAge, sending the instance ids found to out until the context is cancelled
+func (w *HistoryWalker) Run(ctx context.Context, out chan<- int64) {
+	defer close(out)
+
+	for {
+		players, err := w.queries.ListPlayersToCrawl(ctx, db.ListPlayersToCrawlParams{
+			MinAgeSeconds: int32(w.MinAge.Seconds()),
+			MaxRows:       w.BatchSize,
+		})
+		if err != nil && ctx.Err() == nil {
+			slog.Error("Unable to list players to crawl", "error", err)
+		}
+
+		for _, player := range players {
+			member := Member{MembershipType: player.MembershipType, MembershipId: player.MembershipID}
+			if err := w.Walk(ctx, member, player.LastCrawled, out); err != nil {
+				if ctx.Err() != nil {
+					break
+				}
+				slog.Warn("Unable to walk activity history", "membershipId", player.MembershipID, "error", err)
+				w.markFailed(ctx, player.MembershipID, err)
+			}
+		}
+
+		if len(players) > 0 && ctx.Err() == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			slog.Info("Context cancelled. Stopping history walk.")
+			return
+		case <-time.After(w.Idle):
+		}
+	}
+}
+
+// Takes a player whose walk failed out of the next passes, otherwise the same
+// batch would be listed again forever
+func (w *HistoryWalker) markFailed(ctx context.Context, membershipId int64, walkErr error) {
+	var err error
+	if errors.Is(walkErr, errNoVisibleCharacters) {
+		err = w.queries.MarkPlayerPrivate(ctx, membershipId)
+	} else {
+		err = w.queries.MarkPlayerCrawlFailed(ctx, membershipId)
+	}
+	if err != nil {
+		slog.Error("Unable to record failed walk", "membershipId", membershipId, "error", err)
+	}
+}
+
+// WalkMembers walks the full activity history of each member once, then closes out
+func (w *HistoryWalker) WalkMembers(ctx context.Context, members []Member, out chan<- int64) error {
+	defer close(out)
+
+	for _, member := range members {
+		if err := w.Walk(ctx, member, time.Time{}, out); err != nil {
+			return fmt.Errorf("member %d: %w", member.MembershipId, err)
+		}
+	}
+	return nil
+}
+
+// Throttled hands the instance ids found by a walk to the crawler one per tick
+// of throttle, a walk finds up to 250 of them per request. The output is closed
+// once in is
+func Throttled(ctx context.Context, throttle <-chan time.Time, in <-chan int64) <-chan int64 {
+	out := make(chan int64)
+	go func() {
+		defer close(out)
+		for id := range in {
+			select {
+			case <-ctx.Done():
+				return
+			case <-throttle:
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case out <- id:
+			}
+		}
+	}()
+	return out
+}
+
+// Walk sends the instance id of every raid each character of the member
+// played after since to out, then records the member as crawled. Members are
+// only recorded once every character was walked, a partial walk would make
+// the next one skip what this one missed
+func (w *HistoryWalker) Walk(ctx context.Context, member Member, since time.Time, out chan<- int64) error {
+	var profile history.ProfileResponse
+	if err := w.get(ctx, w.BaseUrl+fmt.Sprintf(profilePath, member.MembershipType, member.MembershipId), &profile); err != nil {
+		return err
+	}
+	if len(profile.Response.Profile.Data.CharacterIds) == 0 {
+		return errNoVisibleCharacters
+	}
+
+	found := 0
+	for _, characterId := range profile.Response.Profile.Data.CharacterIds {
+		n, err := w.walkCharacter(ctx, member, characterId, since, out)
+		found += n
+		if err != nil {
+			return fmt.Errorf("character %s: %w", characterId, err)
+		}
+	}
+
+	// Members that aren't in destiny_player yet are added once one of their
+	// pgcrs is processed, there's nothing to update before that
+	if err := w.queries.MarkPlayerCrawled(ctx, member.MembershipId); err != nil {
+		return err
+	}
+
+	slog.Info("Walked activity history", "membershipId", member.MembershipId, "instances", found)
+	return nil
+}
+
+func (w *HistoryWalker) walkCharacter(ctx context.Context, member Member, characterId string, since time.Time, out chan<- int64) (int, error) {
+	found := 0
+	for page := 0; ; page++ {
+		var res history.ActivityHistoryResponse
+		url := w.BaseUrl + fmt.Sprintf(activitiesPath, member.MembershipType, member.MembershipId, characterId, page)
+		if err := w.get(ctx, url, &res); err != nil {
+			return found, err
+		}
+		if len(res.Response.Activities) == 0 {
+			return found, nil
+		}
+
+		for _, activity := range res.Response.Activities {
+			// Most recent first, everything after this was seen by the previous walk
+			if !activity.Period.After(since) {
+				return found, nil
+			}
+
+			instanceId, err := strconv.ParseInt(activity.ActivityDetails.InstanceId, 10, 64)
+			if err != nil {
+				return found, fmt.Errorf("invalid instance id %q in activity history: %w", activity.ActivityDetails.InstanceId, err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return found, ctx.Err()
+			case out <- instanceId:
+				found++
+			}
+		}
+	}
+}
+
+// Decodes a successful response into v. Requests Bungie asks to slow down are
+// waited on for as long as it says, and retried when they failed
+func (w *HistoryWalker) get(ctx context.Context, url string, v any) error {
+	for attempt := 1; ; attempt++ {
+		backoff, err := w.request(ctx, url, v)
+		if backoff > 0 {
+			slog.Warn("Throttled by Bungie, backing off", "url", url, "seconds", backoff.Seconds(), "attempt", attempt)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+		}
+		if err == nil || backoff == 0 || attempt >= maxThrottledAttempts {
+			return err
+		}
+	}
+}
+
+func (w *HistoryWalker) request(ctx context.Context, url string, v any) (time.Duration, error) {
+	if w.Throttle != nil {
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-w.Throttle:
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	if w.ApiKey != "" {
+		req.Header.Add(keyHeaderName, w.ApiKey)
+	}
+	res, err := w.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	backoff, err := checkResponse(res, data)
+	if err != nil {
+		return backoff, err
+	}
+	return backoff, json.Unmarshal(data, v)
+}
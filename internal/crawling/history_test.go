@@ -0,0 +1,192 @@
+package crawling
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"pgcr-processing-service/internal/db"
+	"pgcr-processing-service/internal/types/history"
+
+	"github.com/stretchr/testify/mock"
+)
+
+func TestHistoryWalker_ShouldStopAtThePreviousWalk(t *testing.T) {
+	since := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	pages := map[string]string{
+		"0": `{"ErrorCode": 1, "Response": {"activities": [
+			{"period": "2024-06-03T00:00:00Z", "activityDetails": {"instanceId": "30"}},
+			{"period": "2024-06-02T00:00:00Z", "activityDetails": {"instanceId": "20"}}
+		]}}`,
+		"1": `{"ErrorCode": 1, "Response": {"activities": [
+			{"period": "2024-06-01T12:00:00Z", "activityDetails": {"instanceId": "10"}},
+			{"period": "2024-05-30T00:00:00Z", "activityDetails": {"instanceId": "5"}}
+		]}}`,
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/Profile/") {
+			fmt.Fprint(w, `{"ErrorCode": 1, "Response": {"profile": {"data": {"characterIds": ["42"]}}}}`)
+			return
+		}
+		page, ok := pages[r.URL.Query().Get("page")]
+		if !ok {
+			t.Errorf("Requested page %s past the previous walk", r.URL.Query().Get("page"))
+		}
+		fmt.Fprint(w, page)
+	}))
+	defer srv.Close()
+
+	queries := &mockQuerier{}
+	queries.On("MarkPlayerCrawled", mock.Anything, int64(7)).Return(nil).Once()
+
+	out := make(chan int64, 10)
+	walker := NewHistoryWalker(queries, srv.Client(), "key")
+	walker.BaseUrl = srv.URL
+	if err := walker.Walk(context.Background(), Member{MembershipType: 3, MembershipId: 7}, since, out); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	close(out)
+
+	expected := []int64{30, 20, 10}
+	got := []int64{}
+	for id := range out {
+		got = append(got, id)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Fatalf("Expected %v, got %v", expected, got)
+	}
+	queries.AssertExpectations(t)
+}
+
+func TestHistoryWalker_ShouldNotMarkPartialWalks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.Contains(r.URL.Path, "/Profile/"):
+			fmt.Fprint(w, `{"ErrorCode": 1, "Response": {"profile": {"data": {"characterIds": ["41", "42"]}}}}`)
+		case strings.Contains(r.URL.Path, "/Character/41/") && r.URL.Query().Get("page") == "0":
+			fmt.Fprint(w, `{"ErrorCode": 1, "Response": {"activities": [
+				{"period": "2024-06-03T00:00:00Z", "activityDetails": {"instanceId": "30"}}
+			]}}`)
+		case strings.Contains(r.URL.Path, "/Character/41/"):
+			fmt.Fprint(w, `{"ErrorCode": 1, "Response": {}}`)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `{"ErrorCode": 5, "ErrorStatus": "SystemDisabled"}`)
+		}
+	}))
+	defer srv.Close()
+
+	queries := &mockQuerier{}
+	out := make(chan int64, 10)
+	walker := NewHistoryWalker(queries, srv.Client(), "key")
+	walker.BaseUrl = srv.URL
+	if err := walker.Walk(context.Background(), Member{MembershipType: 3, MembershipId: 7}, time.Time{}, out); err == nil {
+		t.Fatal("Expected the failed character to fail the walk")
+	}
+	if len(out) != 1 {
+		t.Fatalf("Expected the instance of the walked character, got %d", len(out))
+	}
+	queries.AssertNotCalled(t, "MarkPlayerCrawled", mock.Anything, mock.Anything)
+}
+
+// A failed player that isn't marked is listed again on the next pass, so the
+// walker would never get past the batch
+func TestHistoryWalker_ShouldMarkFailedWalks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/Profile/1/") {
+			fmt.Fprint(w, `{"ErrorCode": 1, "Response": {"profile": {"data": {}}}}`)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, `{"ErrorCode": 5, "ErrorStatus": "SystemDisabled"}`)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	queries := &mockQuerier{}
+	queries.On("ListPlayersToCrawl", mock.Anything, mock.Anything).Return([]db.DestinyPlayer{
+		{MembershipID: 1, MembershipType: 3},
+		{MembershipID: 2, MembershipType: 3},
+	}, nil).Once()
+	queries.On("ListPlayersToCrawl", mock.Anything, mock.Anything).Return([]db.DestinyPlayer{}, nil).Run(func(mock.Arguments) {
+		cancel()
+	}).Once()
+	queries.On("MarkPlayerPrivate", mock.Anything, int64(1)).Return(nil).Once()
+	queries.On("MarkPlayerCrawlFailed", mock.Anything, int64(2)).Return(nil).Once()
+
+	walker := NewHistoryWalker(queries, srv.Client(), "key")
+	walker.BaseUrl = srv.URL
+	walker.Run(ctx, make(chan int64))
+
+	queries.AssertExpectations(t)
+	queries.AssertNotCalled(t, "MarkPlayerCrawled", mock.Anything, mock.Anything)
+}
+
+func TestHistoryWalker_ShouldRetryThrottledRequests(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			fmt.Fprint(w, `{"ErrorCode": 51, "ErrorStatus": "PerEndpointRequestThrottleExceeded", "ThrottleSeconds": 1}`)
+			return
+		}
+		fmt.Fprint(w, `{"ErrorCode": 1, "Response": {"profile": {"data": {"characterIds": ["42"]}}}}`)
+	}))
+	defer srv.Close()
+
+	throttle := make(chan time.Time, 2)
+	throttle <- time.Now()
+	throttle <- time.Now()
+
+	walker := NewHistoryWalker(&mockQuerier{}, srv.Client(), "key")
+	walker.Throttle = throttle
+
+	start := time.Now()
+	var profile history.ProfileResponse
+	if err := walker.get(context.Background(), srv.URL, &profile); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if requests != 2 || len(throttle) != 0 {
+		t.Fatalf("Expected 2 throttled requests, got %d with %d ticks left", requests, len(throttle))
+	}
+	if time.Since(start) < time.Second {
+		t.Fatal("Expected the retry to wait for ThrottleSeconds")
+	}
+	if len(profile.Response.Profile.Data.CharacterIds) != 1 {
+		t.Fatalf("Expected the retried response, got %v", profile)
+	}
+}
+
+func TestThrottled_ShouldWaitForATickPerId(t *testing.T) {
+	in := make(chan int64, 2)
+	in <- 1
+	in <- 2
+	close(in)
+	throttle := make(chan time.Time)
+
+	out := Throttled(context.Background(), throttle, in)
+
+	for _, want := range []int64{1, 2} {
+		select {
+		case id := <-out:
+			t.Fatalf("Expected id %d to wait for the throttle", id)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		throttle <- time.Now()
+		if got := <-out; got != want {
+			t.Fatalf("Expected %d, got %d", want, got)
+		}
+	}
+
+	if _, ok := <-out; ok {
+		t.Fatal("Expected output to close with the input")
+	}
+}
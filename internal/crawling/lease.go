@@ -0,0 +1,199 @@
+package crawling
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"pgcr-processing-service/internal/db"
+)
+
+// ErrLeaseLost is returned when another crawler took over an expired lease
+var ErrLeaseLost = errors.New("lease was taken over by another crawler")
+
+// Lease is an inclusive range of instance ids assigned to a single crawler
+type Lease struct {
+	Start int64
+	End   int64
+}
+
+// Leaser splits the id space in ranges shared between crawler instances through
+// the crawl_lease table. Leases are renewed while their ids are handed out, the
+// ranges of crawlers that stop renewing are picked up by the others
+type Leaser struct {
+	queries db.Querier
+	Owner   string
+	// Instance ids per lease
+	Size int64
+	// How long a lease survives without being renewed
+	TTL time.Duration
+	// First id leased when the table is empty
+	FirstId int64
+}
+
+func NewLeaser(queries db.Querier, size int64) *Leaser {
+	return &Leaser{
+		queries: queries,
+		Owner:   defaultOwner(),
+		Size:    size,
+		TTL:     5 * time.Minute,
+		FirstId: 1,
+	}
+}
+
+// Hostname and pid, so restarted containers don't inherit the leases of their
+// previous run
+func defaultOwner() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "crawler"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// Acquire takes over an expired lease when there's one, otherwise it leases
+// the next range after the highest one handed out so far
+func (l *Leaser) Acquire(ctx context.Context) (Lease, error) {
+	expired, err := l.queries.ClaimExpiredLease(ctx, db.ClaimExpiredLeaseParams{
+		Owner:      l.Owner,
+		TtlSeconds: l.ttlSeconds(),
+	})
+	if err == nil {
+		slog.Info("Took over expired lease", "from", expired.RangeStart, "to", expired.RangeEnd, "owner", l.Owner)
+		return Lease{Start: expired.RangeStart, End: expired.RangeEnd}, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return Lease{}, err
+	}
+
+	// Another crawler may create the same range concurrently, the loser retries
+	// with the range after it
+	for {
+		next, err := l.queries.CreateNextLease(ctx, db.CreateNextLeaseParams{
+			Size:       l.Size,
+			Owner:      l.Owner,
+			TtlSeconds: l.ttlSeconds(),
+			FirstID:    l.FirstId,
+		})
+		if err == nil {
+			slog.Info("Leased range", "from", next.RangeStart, "to", next.RangeEnd, "owner", l.Owner)
+			return Lease{Start: next.RangeStart, End: next.RangeEnd}, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return Lease{}, err
+		}
+		if err := ctx.Err(); err != nil {
+			return Lease{}, err
+		}
+	}
+}
+
+func (l *Leaser) Renew(ctx context.Context, lease Lease) error {
+	rows, err := l.queries.RenewLease(ctx, db.RenewLeaseParams{
+		TtlSeconds: l.ttlSeconds(),
+		RangeStart: lease.Start,
+		Owner:      l.Owner,
+	})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// Complete marks the range as done so it's never leased again. Gaps left in it
+// are picked up by the backfill
+func (l *Leaser) Complete(ctx context.Context, lease Lease) error {
+	rows, err := l.queries.CompleteLease(ctx, db.CompleteLeaseParams{
+		RangeStart: lease.Start,
+		Owner:      l.Owner,
+	})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// Generate leases ranges one after the other and sends their ids to out, one
+// per throttle tick. The output is closed once the context is cancelled
+func (l *Leaser) Generate(ctx context.Context, throttle <-chan time.Time, out chan<- int64) {
+	defer close(out)
+
+	for {
+		lease, err := l.Acquire(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				slog.Info("Context cancelled. Exiting.")
+				return
+			}
+			slog.Error("Unable to acquire lease, retrying", "error", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(l.TTL / 10):
+			}
+			continue
+		}
+
+		if err := l.generate(ctx, lease, throttle, out); err != nil {
+			if ctx.Err() != nil {
+				slog.Info("Context cancelled. Exiting.")
+				return
+			}
+			slog.Warn("Abandoning lease", "from", lease.Start, "to", lease.End, "error", err)
+			continue
+		}
+
+		if err := l.Complete(ctx, lease); err != nil {
+			slog.Warn("Unable to complete lease", "from", lease.Start, "to", lease.End, "error", err)
+		}
+	}
+}
+
+// Renews the lease on its own ticker, well before it expires, while waiting on
+// both the throttle and the send. A crawler that stops taking ids for longer
+// than the TTL would otherwise keep sending ids of a lease another one took over
+func (l *Leaser) generate(ctx context.Context, lease Lease, throttle <-chan time.Time, out chan<- int64) error {
+	renew := time.NewTicker(l.TTL / 3)
+	defer renew.Stop()
+
+	ticked := false
+	for id := lease.Start; id <= lease.End; {
+		// Waits for a tick, then for the send of the id
+		var tick <-chan time.Time
+		var send chan<- int64
+		if ticked {
+			send = out
+		} else {
+			tick = throttle
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-renew.C:
+			if err := l.Renew(ctx, lease); err != nil {
+				return err
+			}
+		case <-tick:
+			ticked = true
+		case send <- id:
+			ticked = false
+			id++
+		}
+	}
+	return nil
+}
+
+func (l *Leaser) ttlSeconds() int32 {
+	return int32(l.TTL.Seconds())
+}
@@ -0,0 +1,75 @@
+package crawling
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"pgcr-processing-service/internal/db"
+
+	"github.com/stretchr/testify/mock"
+)
+
+func TestLeaser_ShouldPreferExpiredLeases(t *testing.T) {
+	queries := &mockQuerier{}
+	queries.On("ClaimExpiredLease", mock.Anything, mock.Anything).
+		Return(db.CrawlLease{RangeStart: 11, RangeEnd: 20}, nil).Once()
+
+	lease, err := NewLeaser(queries, 10).Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if lease != (Lease{Start: 11, End: 20}) {
+		t.Fatalf("Expected the expired lease, got %v", lease)
+	}
+	queries.AssertNotCalled(t, "CreateNextLease", mock.Anything, mock.Anything)
+}
+
+func TestLeaser_ShouldRetryWhenAnotherCrawlerTookTheNextRange(t *testing.T) {
+	queries := &mockQuerier{}
+	queries.On("ClaimExpiredLease", mock.Anything, mock.Anything).
+		Return(db.CrawlLease{}, sql.ErrNoRows).Once()
+	queries.On("CreateNextLease", mock.Anything, mock.Anything).
+		Return(db.CrawlLease{}, sql.ErrNoRows).Once()
+	queries.On("CreateNextLease", mock.Anything, mock.Anything).
+		Return(db.CrawlLease{RangeStart: 21, RangeEnd: 30}, nil).Once()
+
+	lease, err := NewLeaser(queries, 10).Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if lease != (Lease{Start: 21, End: 30}) {
+		t.Fatalf("Expected the next free range, got %v", lease)
+	}
+	queries.AssertExpectations(t)
+}
+
+func TestLeaser_ShouldReportLostLeases(t *testing.T) {
+	queries := &mockQuerier{}
+	queries.On("RenewLease", mock.Anything, mock.Anything).Return(int64(0), nil).Once()
+
+	err := NewLeaser(queries, 10).Renew(context.Background(), Lease{Start: 1, End: 10})
+	if !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("Expected ErrLeaseLost, got %v", err)
+	}
+}
+
+// Nothing takes the id off the output, the lease must still be renewed and
+// given up once lost instead of sending an id of another crawler's range
+func TestLeaser_ShouldRenewWhileBlockedOnTheSend(t *testing.T) {
+	queries := &mockQuerier{}
+	queries.On("RenewLease", mock.Anything, mock.Anything).Return(int64(0), nil).Once()
+
+	leaser := NewLeaser(queries, 10)
+	leaser.TTL = 30 * time.Millisecond
+	throttle := make(chan time.Time, 1)
+	throttle <- time.Now()
+
+	err := leaser.generate(context.Background(), Lease{Start: 1, End: 10}, throttle, make(chan int64))
+	if !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("Expected ErrLeaseLost, got %v", err)
+	}
+	queries.AssertExpectations(t)
+}
@@ -0,0 +1,127 @@
+package crawling
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"strconv"
+	"sync"
+
+	"pgcr-processing-service/internal/db"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Ledger lets the crawler skip instances that were already ingested and track
+// the ones it publishes in the ingestion_log
+type Ledger interface {
+	// Whether the instance doesn't need to be crawled again
+	Handled(ctx context.Context, instanceId int64) (bool, error)
+	// Records that the instance is about to be crawled
+	Queued(ctx context.Context, instanceId int64) error
+	// Records that the instance was published for processing
+	Fetched(ctx context.Context, instanceId int64) error
+	// Records that the instance's pgcr is over the size limit and wasn't published
+	Oversized(ctx context.Context, instanceId int64, reason string) error
+}
+
+// Windows kept in memory at once, enough for the live, backfill and leased ids
+// the workers interleave
+const ledgerWindows = 8
+
+// PostgresLedger reads the ingestion_log in windows of ids so the crawler only
+// hits the database once per window instead of once per instance
+type PostgresLedger struct {
+	queries    db.Querier
+	windowSize int64
+	// Workers missing the same window wait on a single query
+	group singleflight.Group
+
+	mu sync.Mutex
+	// Handled ids by the first id of their window
+	windows map[int64]map[int64]bool
+	// Window starts, least recently used first
+	order []int64
+}
+
+func NewPostgresLedger(queries db.Querier, windowSize int64) *PostgresLedger {
+	return &PostgresLedger{
+		queries:    queries,
+		windowSize: windowSize,
+		windows:    map[int64]map[int64]bool{},
+	}
+}
+
+func (l *PostgresLedger) Handled(ctx context.Context, instanceId int64) (bool, error) {
+	start := instanceId - instanceId%l.windowSize
+	if handled, ok := l.cached(start); ok {
+		return handled[instanceId], nil
+	}
+
+	// Queried outside the lock so workers on other windows aren't held up
+	v, err, _ := l.group.Do(strconv.FormatInt(start, 10), func() (any, error) {
+		ids, err := l.queries.ListHandledInstanceIds(ctx, db.ListHandledInstanceIdsParams{
+			FromID: start,
+			ToID:   start + l.windowSize - 1,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		handled := make(map[int64]bool, len(ids))
+		for _, id := range ids {
+			handled[id] = true
+		}
+		l.store(start, handled)
+		return handled, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return v.(map[int64]bool)[instanceId], nil
+}
+
+func (l *PostgresLedger) cached(start int64) (map[int64]bool, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	handled, ok := l.windows[start]
+	if ok {
+		l.order = append(slices.DeleteFunc(l.order, func(s int64) bool { return s == start }), start)
+	}
+	return handled, ok
+}
+
+// Keeps a window, evicting the least recently used one when full
+func (l *PostgresLedger) store(start int64, handled map[int64]bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.windows[start]; !ok {
+		l.order = append(l.order, start)
+	}
+	l.windows[start] = handled
+	if len(l.order) > ledgerWindows {
+		delete(l.windows, l.order[0])
+		l.order = l.order[1:]
+	}
+}
+
+func (l *PostgresLedger) Queued(ctx context.Context, instanceId int64) error {
+	return l.queries.CreateQueuedLogEntry(ctx, db.CreateQueuedLogEntryParams{
+		InstanceID: instanceId,
+		Source:     crawlerSource,
+	})
+}
+
+func (l *PostgresLedger) Fetched(ctx context.Context, instanceId int64) error {
+	return l.queries.MarkLogEntryFetched(ctx, instanceId)
+}
+
+func (l *PostgresLedger) Oversized(ctx context.Context, instanceId int64, reason string) error {
+	return l.queries.MarkLogEntryOversized(ctx, db.MarkLogEntryOversizedParams{
+		InstanceID: instanceId,
+		Source:     crawlerSource,
+		Error:      sql.NullString{String: reason, Valid: true},
+	})
+}
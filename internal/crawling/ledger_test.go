@@ -0,0 +1,145 @@
+package crawling
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"pgcr-processing-service/internal/db"
+
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPostgresLedger_ShouldReadHandledIdsOncePerWindow(t *testing.T) {
+	queries := &mockQuerier{}
+	queries.On("ListHandledInstanceIds", mock.Anything, db.ListHandledInstanceIdsParams{FromID: 100, ToID: 109}).
+		Return([]int64{101, 105}, nil).Once()
+	queries.On("ListHandledInstanceIds", mock.Anything, db.ListHandledInstanceIdsParams{FromID: 110, ToID: 119}).
+		Return([]int64{}, nil).Once()
+
+	ledger := NewPostgresLedger(queries, 10)
+	expected := map[int64]bool{100: false, 101: true, 105: true, 109: false, 110: false}
+	for _, id := range []int64{100, 101, 105, 109, 110} {
+		handled, err := ledger.Handled(context.Background(), id)
+		if err != nil {
+			t.Fatalf("Unexpected error for %d: %v", id, err)
+		}
+		if handled != expected[id] {
+			t.Fatalf("Expected handled %v for %d, got %v", expected[id], id, handled)
+		}
+	}
+
+	queries.AssertExpectations(t)
+}
+
+func TestPostgresLedger_ShouldKeepInterleavedWindows(t *testing.T) {
+	queries := &mockQuerier{}
+	queries.On("ListHandledInstanceIds", mock.Anything, db.ListHandledInstanceIdsParams{FromID: 100, ToID: 109}).
+		Return([]int64{101}, nil).Once()
+	queries.On("ListHandledInstanceIds", mock.Anything, db.ListHandledInstanceIdsParams{FromID: 5000, ToID: 5009}).
+		Return([]int64{5001}, nil).Once()
+
+	// Live and backfill ids taking turns only read each window once
+	ledger := NewPostgresLedger(queries, 10)
+	for _, id := range []int64{100, 5000, 101, 5001, 102, 5002} {
+		handled, err := ledger.Handled(context.Background(), id)
+		if err != nil {
+			t.Fatalf("Unexpected error for %d: %v", id, err)
+		}
+		if handled != (id == 101 || id == 5001) {
+			t.Fatalf("Unexpected handled %v for %d", handled, id)
+		}
+	}
+
+	queries.AssertExpectations(t)
+}
+
+func TestPostgresLedger_ShouldEvictLeastRecentlyUsedWindows(t *testing.T) {
+	queries := &mockQuerier{}
+	queries.On("ListHandledInstanceIds", mock.Anything, mock.Anything).Return([]int64{}, nil)
+
+	ledger := NewPostgresLedger(queries, 10)
+	for i := range int64(ledgerWindows + 1) {
+		ledger.Handled(context.Background(), i*10)
+	}
+	// The first window was evicted by the last one
+	ledger.Handled(context.Background(), 0)
+
+	queries.AssertNumberOfCalls(t, "ListHandledInstanceIds", ledgerWindows+2)
+	if len(ledger.windows) != ledgerWindows {
+		t.Fatalf("Expected %d windows kept, got %d", ledgerWindows, len(ledger.windows))
+	}
+}
+
+func TestPostgresLedger_ShouldParkOversizedInstances(t *testing.T) {
+	queries := &mockQuerier{}
+	queries.On("MarkLogEntryOversized", mock.Anything, db.MarkLogEntryOversizedParams{
+		InstanceID: 42,
+		Source:     crawlerSource,
+		Error:      sql.NullString{String: "response too large", Valid: true},
+	}).Return(nil).Once()
+
+	ledger := NewPostgresLedger(queries, 10)
+	if err := ledger.Oversized(context.Background(), 42, "response too large"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	queries.AssertExpectations(t)
+}
+
+// Only the ledger queries are mocked, anything else panics through the nil interface
+type mockQuerier struct {
+	db.Querier
+	mock.Mock
+}
+
+func (m *mockQuerier) ListHandledInstanceIds(ctx context.Context, arg db.ListHandledInstanceIdsParams) ([]int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).([]int64), args.Error(1)
+}
+
+func (m *mockQuerier) CountLogCoverage(ctx context.Context, arg db.CountLogCoverageParams) ([]db.CountLogCoverageRow, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).([]db.CountLogCoverageRow), args.Error(1)
+}
+
+func (m *mockQuerier) ClaimExpiredLease(ctx context.Context, arg db.ClaimExpiredLeaseParams) (db.CrawlLease, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(db.CrawlLease), args.Error(1)
+}
+
+func (m *mockQuerier) CreateNextLease(ctx context.Context, arg db.CreateNextLeaseParams) (db.CrawlLease, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(db.CrawlLease), args.Error(1)
+}
+
+func (m *mockQuerier) RenewLease(ctx context.Context, arg db.RenewLeaseParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *mockQuerier) ClaimLeadership(ctx context.Context, arg db.ClaimLeadershipParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *mockQuerier) MarkPlayerCrawled(ctx context.Context, membershipID int64) error {
+	return m.Called(ctx, membershipID).Error(0)
+}
+
+func (m *mockQuerier) ListPlayersToCrawl(ctx context.Context, arg db.ListPlayersToCrawlParams) ([]db.DestinyPlayer, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).([]db.DestinyPlayer), args.Error(1)
+}
+
+func (m *mockQuerier) MarkPlayerCrawlFailed(ctx context.Context, membershipID int64) error {
+	return m.Called(ctx, membershipID).Error(0)
+}
+
+func (m *mockQuerier) MarkPlayerPrivate(ctx context.Context, membershipID int64) error {
+	return m.Called(ctx, membershipID).Error(0)
+}
+
+func (m *mockQuerier) MarkLogEntryOversized(ctx context.Context, arg db.MarkLogEntryOversizedParams) error {
+	return m.Called(ctx, arg).Error(0)
+}
@@ -24,6 +24,30 @@ func New(db DBTX) *Queries {
 func Prepare(ctx context.Context, db DBTX) (*Queries, error) {
 	q := Queries{db: db}
 	var err error
+	if q.claimExpiredLeaseStmt, err = db.PrepareContext(ctx, claimExpiredLease); err != nil {
+		return nil, fmt.Errorf("error preparing query ClaimExpiredLease: %w", err)
+	}
+	if q.claimLeadershipStmt, err = db.PrepareContext(ctx, claimLeadership); err != nil {
+		return nil, fmt.Errorf("error preparing query ClaimLeadership: %w", err)
+	}
+	if q.claimLogEntryStmt, err = db.PrepareContext(ctx, claimLogEntry); err != nil {
+		return nil, fmt.Errorf("error preparing query ClaimLogEntry: %w", err)
+	}
+	if q.completeLeaseStmt, err = db.PrepareContext(ctx, completeLease); err != nil {
+		return nil, fmt.Errorf("error preparing query CompleteLease: %w", err)
+	}
+	if q.countLogCoverageStmt, err = db.PrepareContext(ctx, countLogCoverage); err != nil {
+		return nil, fmt.Errorf("error preparing query CountLogCoverage: %w", err)
+	}
+	if q.countLogEntriesByStatusStmt, err = db.PrepareContext(ctx, countLogEntriesByStatus); err != nil {
+		return nil, fmt.Errorf("error preparing query CountLogEntriesByStatus: %w", err)
+	}
+	if q.countLogEntriesByVersionStmt, err = db.PrepareContext(ctx, countLogEntriesByVersion); err != nil {
+		return nil, fmt.Errorf("error preparing query CountLogEntriesByVersion: %w", err)
+	}
+	if q.countLogErrorsStmt, err = db.PrepareContext(ctx, countLogErrors); err != nil {
+		return nil, fmt.Errorf("error preparing query CountLogErrors: %w", err)
+	}
 	if q.createDestinyPlayerStmt, err = db.PrepareContext(ctx, createDestinyPlayer); err != nil {
 		return nil, fmt.Errorf("error preparing query CreateDestinyPlayer: %w", err)
 	}
@@ -39,26 +63,156 @@ func Prepare(ctx context.Context, db DBTX) (*Queries, error) {
 	if q.createInstancePlayerStmt, err = db.PrepareContext(ctx, createInstancePlayer); err != nil {
 		return nil, fmt.Errorf("error preparing query CreateInstancePlayer: %w", err)
 	}
+	if q.createNextLeaseStmt, err = db.PrepareContext(ctx, createNextLease); err != nil {
+		return nil, fmt.Errorf("error preparing query CreateNextLease: %w", err)
+	}
 	if q.createPgcrStmt, err = db.PrepareContext(ctx, createPgcr); err != nil {
 		return nil, fmt.Errorf("error preparing query CreatePgcr: %w", err)
 	}
+	if q.createQueuedLogEntryStmt, err = db.PrepareContext(ctx, createQueuedLogEntry); err != nil {
+		return nil, fmt.Errorf("error preparing query CreateQueuedLogEntry: %w", err)
+	}
 	if q.createWeaponStmt, err = db.PrepareContext(ctx, createWeapon); err != nil {
 		return nil, fmt.Errorf("error preparing query CreateWeapon: %w", err)
 	}
-	if q.incrementPlayerCountsStmt, err = db.PrepareContext(ctx, incrementPlayerCounts); err != nil {
-		return nil, fmt.Errorf("error preparing query IncrementPlayerCounts: %w", err)
+	if q.deleteInstanceCharacterWeaponsStmt, err = db.PrepareContext(ctx, deleteInstanceCharacterWeapons); err != nil {
+		return nil, fmt.Errorf("error preparing query DeleteInstanceCharacterWeapons: %w", err)
+	}
+	if q.deleteInstanceCharactersStmt, err = db.PrepareContext(ctx, deleteInstanceCharacters); err != nil {
+		return nil, fmt.Errorf("error preparing query DeleteInstanceCharacters: %w", err)
+	}
+	if q.deleteInstancePlayersStmt, err = db.PrepareContext(ctx, deleteInstancePlayers); err != nil {
+		return nil, fmt.Errorf("error preparing query DeleteInstancePlayers: %w", err)
+	}
+	if q.failLogEntryStmt, err = db.PrepareContext(ctx, failLogEntry); err != nil {
+		return nil, fmt.Errorf("error preparing query FailLogEntry: %w", err)
+	}
+	if q.getDestinyPlayerStmt, err = db.PrepareContext(ctx, getDestinyPlayer); err != nil {
+		return nil, fmt.Errorf("error preparing query GetDestinyPlayer: %w", err)
+	}
+	if q.getInstanceStmt, err = db.PrepareContext(ctx, getInstance); err != nil {
+		return nil, fmt.Errorf("error preparing query GetInstance: %w", err)
+	}
+	if q.getLogEntryStmt, err = db.PrepareContext(ctx, getLogEntry); err != nil {
+		return nil, fmt.Errorf("error preparing query GetLogEntry: %w", err)
+	}
+	if q.listHandledInstanceIdsStmt, err = db.PrepareContext(ctx, listHandledInstanceIds); err != nil {
+		return nil, fmt.Errorf("error preparing query ListHandledInstanceIds: %w", err)
+	}
+	if q.listInstanceCharacterWeaponsStmt, err = db.PrepareContext(ctx, listInstanceCharacterWeapons); err != nil {
+		return nil, fmt.Errorf("error preparing query ListInstanceCharacterWeapons: %w", err)
+	}
+	if q.listInstanceCharactersStmt, err = db.PrepareContext(ctx, listInstanceCharacters); err != nil {
+		return nil, fmt.Errorf("error preparing query ListInstanceCharacters: %w", err)
+	}
+	if q.listInstancePlayersStmt, err = db.PrepareContext(ctx, listInstancePlayers); err != nil {
+		return nil, fmt.Errorf("error preparing query ListInstancePlayers: %w", err)
+	}
+	if q.listLogEntriesStmt, err = db.PrepareContext(ctx, listLogEntries); err != nil {
+		return nil, fmt.Errorf("error preparing query ListLogEntries: %w", err)
+	}
+	if q.listLogGapsStmt, err = db.PrepareContext(ctx, listLogGaps); err != nil {
+		return nil, fmt.Errorf("error preparing query ListLogGaps: %w", err)
+	}
+	if q.listPgcrBlobsStmt, err = db.PrepareContext(ctx, listPgcrBlobs); err != nil {
+		return nil, fmt.Errorf("error preparing query ListPgcrBlobs: %w", err)
+	}
+	if q.listPlayerCountDriftStmt, err = db.PrepareContext(ctx, listPlayerCountDrift); err != nil {
+		return nil, fmt.Errorf("error preparing query ListPlayerCountDrift: %w", err)
+	}
+	if q.listPlayersToCrawlStmt, err = db.PrepareContext(ctx, listPlayersToCrawl); err != nil {
+		return nil, fmt.Errorf("error preparing query ListPlayersToCrawl: %w", err)
+	}
+	if q.lockRaidWorldsFirstStmt, err = db.PrepareContext(ctx, lockRaidWorldsFirst); err != nil {
+		return nil, fmt.Errorf("error preparing query LockRaidWorldsFirst: %w", err)
+	}
+	if q.markLogEntryFetchedStmt, err = db.PrepareContext(ctx, markLogEntryFetched); err != nil {
+		return nil, fmt.Errorf("error preparing query MarkLogEntryFetched: %w", err)
+	}
+	if q.markLogEntryOversizedStmt, err = db.PrepareContext(ctx, markLogEntryOversized); err != nil {
+		return nil, fmt.Errorf("error preparing query MarkLogEntryOversized: %w", err)
+	}
+	if q.markLogEntryReprocessedStmt, err = db.PrepareContext(ctx, markLogEntryReprocessed); err != nil {
+		return nil, fmt.Errorf("error preparing query MarkLogEntryReprocessed: %w", err)
+	}
+	if q.markPlayerCrawlFailedStmt, err = db.PrepareContext(ctx, markPlayerCrawlFailed); err != nil {
+		return nil, fmt.Errorf("error preparing query MarkPlayerCrawlFailed: %w", err)
+	}
+	if q.markPlayerCrawledStmt, err = db.PrepareContext(ctx, markPlayerCrawled); err != nil {
+		return nil, fmt.Errorf("error preparing query MarkPlayerCrawled: %w", err)
+	}
+	if q.markPlayerPrivateStmt, err = db.PrepareContext(ctx, markPlayerPrivate); err != nil {
+		return nil, fmt.Errorf("error preparing query MarkPlayerPrivate: %w", err)
+	}
+	if q.markWorldsFirstStmt, err = db.PrepareContext(ctx, markWorldsFirst); err != nil {
+		return nil, fmt.Errorf("error preparing query MarkWorldsFirst: %w", err)
+	}
+	if q.queueLogEntryStmt, err = db.PrepareContext(ctx, queueLogEntry); err != nil {
+		return nil, fmt.Errorf("error preparing query QueueLogEntry: %w", err)
+	}
+	if q.recomputePlayerCountsStmt, err = db.PrepareContext(ctx, recomputePlayerCounts); err != nil {
+		return nil, fmt.Errorf("error preparing query RecomputePlayerCounts: %w", err)
+	}
+	if q.recordLogEntryStmt, err = db.PrepareContext(ctx, recordLogEntry); err != nil {
+		return nil, fmt.Errorf("error preparing query RecordLogEntry: %w", err)
+	}
+	if q.renewLeaseStmt, err = db.PrepareContext(ctx, renewLease); err != nil {
+		return nil, fmt.Errorf("error preparing query RenewLease: %w", err)
+	}
+	if q.resetLogEntriesStmt, err = db.PrepareContext(ctx, resetLogEntries); err != nil {
+		return nil, fmt.Errorf("error preparing query ResetLogEntries: %w", err)
+	}
+	if q.updateInstanceStmt, err = db.PrepareContext(ctx, updateInstance); err != nil {
+		return nil, fmt.Errorf("error preparing query UpdateInstance: %w", err)
 	}
 	if q.updateLogEntryStatusStmt, err = db.PrepareContext(ctx, updateLogEntryStatus); err != nil {
 		return nil, fmt.Errorf("error preparing query UpdateLogEntryStatus: %w", err)
 	}
-	if q.upsertLogEntryStmt, err = db.PrepareContext(ctx, upsertLogEntry); err != nil {
-		return nil, fmt.Errorf("error preparing query UpsertLogEntry: %w", err)
-	}
 	return &q, nil
 }
 
 func (q *Queries) Close() error {
 	var err error
+	if q.claimExpiredLeaseStmt != nil {
+		if cerr := q.claimExpiredLeaseStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing claimExpiredLeaseStmt: %w", cerr)
+		}
+	}
+	if q.claimLeadershipStmt != nil {
+		if cerr := q.claimLeadershipStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing claimLeadershipStmt: %w", cerr)
+		}
+	}
+	if q.claimLogEntryStmt != nil {
+		if cerr := q.claimLogEntryStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing claimLogEntryStmt: %w", cerr)
+		}
+	}
+	if q.completeLeaseStmt != nil {
+		if cerr := q.completeLeaseStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing completeLeaseStmt: %w", cerr)
+		}
+	}
+	if q.countLogCoverageStmt != nil {
+		if cerr := q.countLogCoverageStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing countLogCoverageStmt: %w", cerr)
+		}
+	}
+	if q.countLogEntriesByStatusStmt != nil {
+		if cerr := q.countLogEntriesByStatusStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing countLogEntriesByStatusStmt: %w", cerr)
+		}
+	}
+	if q.countLogEntriesByVersionStmt != nil {
+		if cerr := q.countLogEntriesByVersionStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing countLogEntriesByVersionStmt: %w", cerr)
+		}
+	}
+	if q.countLogErrorsStmt != nil {
+		if cerr := q.countLogErrorsStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing countLogErrorsStmt: %w", cerr)
+		}
+	}
 	if q.createDestinyPlayerStmt != nil {
 		if cerr := q.createDestinyPlayerStmt.Close(); cerr != nil {
 			err = fmt.Errorf("error closing createDestinyPlayerStmt: %w", cerr)
@@ -84,19 +238,174 @@ func (q *Queries) Close() error {
 			err = fmt.Errorf("error closing createInstancePlayerStmt: %w", cerr)
 		}
 	}
+	if q.createNextLeaseStmt != nil {
+		if cerr := q.createNextLeaseStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing createNextLeaseStmt: %w", cerr)
+		}
+	}
 	if q.createPgcrStmt != nil {
 		if cerr := q.createPgcrStmt.Close(); cerr != nil {
 			err = fmt.Errorf("error closing createPgcrStmt: %w", cerr)
 		}
 	}
+	if q.createQueuedLogEntryStmt != nil {
+		if cerr := q.createQueuedLogEntryStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing createQueuedLogEntryStmt: %w", cerr)
+		}
+	}
 	if q.createWeaponStmt != nil {
 		if cerr := q.createWeaponStmt.Close(); cerr != nil {
 			err = fmt.Errorf("error closing createWeaponStmt: %w", cerr)
 		}
 	}
-	if q.incrementPlayerCountsStmt != nil {
-		if cerr := q.incrementPlayerCountsStmt.Close(); cerr != nil {
-			err = fmt.Errorf("error closing incrementPlayerCountsStmt: %w", cerr)
+	if q.deleteInstanceCharacterWeaponsStmt != nil {
+		if cerr := q.deleteInstanceCharacterWeaponsStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing deleteInstanceCharacterWeaponsStmt: %w", cerr)
+		}
+	}
+	if q.deleteInstanceCharactersStmt != nil {
+		if cerr := q.deleteInstanceCharactersStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing deleteInstanceCharactersStmt: %w", cerr)
+		}
+	}
+	if q.deleteInstancePlayersStmt != nil {
+		if cerr := q.deleteInstancePlayersStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing deleteInstancePlayersStmt: %w", cerr)
+		}
+	}
+	if q.failLogEntryStmt != nil {
+		if cerr := q.failLogEntryStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing failLogEntryStmt: %w", cerr)
+		}
+	}
+	if q.getDestinyPlayerStmt != nil {
+		if cerr := q.getDestinyPlayerStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing getDestinyPlayerStmt: %w", cerr)
+		}
+	}
+	if q.getInstanceStmt != nil {
+		if cerr := q.getInstanceStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing getInstanceStmt: %w", cerr)
+		}
+	}
+	if q.getLogEntryStmt != nil {
+		if cerr := q.getLogEntryStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing getLogEntryStmt: %w", cerr)
+		}
+	}
+	if q.listHandledInstanceIdsStmt != nil {
+		if cerr := q.listHandledInstanceIdsStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing listHandledInstanceIdsStmt: %w", cerr)
+		}
+	}
+	if q.listInstanceCharacterWeaponsStmt != nil {
+		if cerr := q.listInstanceCharacterWeaponsStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing listInstanceCharacterWeaponsStmt: %w", cerr)
+		}
+	}
+	if q.listInstanceCharactersStmt != nil {
+		if cerr := q.listInstanceCharactersStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing listInstanceCharactersStmt: %w", cerr)
+		}
+	}
+	if q.listInstancePlayersStmt != nil {
+		if cerr := q.listInstancePlayersStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing listInstancePlayersStmt: %w", cerr)
+		}
+	}
+	if q.listLogEntriesStmt != nil {
+		if cerr := q.listLogEntriesStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing listLogEntriesStmt: %w", cerr)
+		}
+	}
+	if q.listLogGapsStmt != nil {
+		if cerr := q.listLogGapsStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing listLogGapsStmt: %w", cerr)
+		}
+	}
+	if q.listPgcrBlobsStmt != nil {
+		if cerr := q.listPgcrBlobsStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing listPgcrBlobsStmt: %w", cerr)
+		}
+	}
+	if q.listPlayerCountDriftStmt != nil {
+		if cerr := q.listPlayerCountDriftStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing listPlayerCountDriftStmt: %w", cerr)
+		}
+	}
+	if q.listPlayersToCrawlStmt != nil {
+		if cerr := q.listPlayersToCrawlStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing listPlayersToCrawlStmt: %w", cerr)
+		}
+	}
+	if q.lockRaidWorldsFirstStmt != nil {
+		if cerr := q.lockRaidWorldsFirstStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing lockRaidWorldsFirstStmt: %w", cerr)
+		}
+	}
+	if q.markLogEntryFetchedStmt != nil {
+		if cerr := q.markLogEntryFetchedStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing markLogEntryFetchedStmt: %w", cerr)
+		}
+	}
+	if q.markLogEntryOversizedStmt != nil {
+		if cerr := q.markLogEntryOversizedStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing markLogEntryOversizedStmt: %w", cerr)
+		}
+	}
+	if q.markLogEntryReprocessedStmt != nil {
+		if cerr := q.markLogEntryReprocessedStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing markLogEntryReprocessedStmt: %w", cerr)
+		}
+	}
+	if q.markPlayerCrawlFailedStmt != nil {
+		if cerr := q.markPlayerCrawlFailedStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing markPlayerCrawlFailedStmt: %w", cerr)
+		}
+	}
+	if q.markPlayerCrawledStmt != nil {
+		if cerr := q.markPlayerCrawledStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing markPlayerCrawledStmt: %w", cerr)
+		}
+	}
+	if q.markPlayerPrivateStmt != nil {
+		if cerr := q.markPlayerPrivateStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing markPlayerPrivateStmt: %w", cerr)
+		}
+	}
+	if q.markWorldsFirstStmt != nil {
+		if cerr := q.markWorldsFirstStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing markWorldsFirstStmt: %w", cerr)
+		}
+	}
+	if q.queueLogEntryStmt != nil {
+		if cerr := q.queueLogEntryStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing queueLogEntryStmt: %w", cerr)
+		}
+	}
+	if q.recomputePlayerCountsStmt != nil {
+		if cerr := q.recomputePlayerCountsStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing recomputePlayerCountsStmt: %w", cerr)
+		}
+	}
+	if q.recordLogEntryStmt != nil {
+		if cerr := q.recordLogEntryStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing recordLogEntryStmt: %w", cerr)
+		}
+	}
+	if q.renewLeaseStmt != nil {
+		if cerr := q.renewLeaseStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing renewLeaseStmt: %w", cerr)
+		}
+	}
+	if q.resetLogEntriesStmt != nil {
+		if cerr := q.resetLogEntriesStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing resetLogEntriesStmt: %w", cerr)
+		}
+	}
+	if q.updateInstanceStmt != nil {
+		if cerr := q.updateInstanceStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing updateInstanceStmt: %w", cerr)
 		}
 	}
 	if q.updateLogEntryStatusStmt != nil {
@@ -104,11 +413,6 @@ func (q *Queries) Close() error {
 			err = fmt.Errorf("error closing updateLogEntryStatusStmt: %w", cerr)
 		}
 	}
-	if q.upsertLogEntryStmt != nil {
-		if cerr := q.upsertLogEntryStmt.Close(); cerr != nil {
-			err = fmt.Errorf("error closing upsertLogEntryStmt: %w", cerr)
-		}
-	}
 	return err
 }
 
@@ -146,33 +450,109 @@ func (q *Queries) queryRow(ctx context.Context, stmt *sql.Stmt, query string, ar
 }
 
 type Queries struct {
-	db                                DBTX
-	tx                                *sql.Tx
-	createDestinyPlayerStmt           *sql.Stmt
-	createInstanceStmt                *sql.Stmt
-	createInstanceCharacterStmt       *sql.Stmt
-	createInstanceCharacterWeaponStmt *sql.Stmt
-	createInstancePlayerStmt          *sql.Stmt
-	createPgcrStmt                    *sql.Stmt
-	createWeaponStmt                  *sql.Stmt
-	incrementPlayerCountsStmt         *sql.Stmt
-	updateLogEntryStatusStmt          *sql.Stmt
-	upsertLogEntryStmt                *sql.Stmt
+	db                                 DBTX
+	tx                                 *sql.Tx
+	claimExpiredLeaseStmt              *sql.Stmt
+	claimLeadershipStmt                *sql.Stmt
+	claimLogEntryStmt                  *sql.Stmt
+	completeLeaseStmt                  *sql.Stmt
+	countLogCoverageStmt               *sql.Stmt
+	countLogEntriesByStatusStmt        *sql.Stmt
+	countLogEntriesByVersionStmt       *sql.Stmt
+	countLogErrorsStmt                 *sql.Stmt
+	createDestinyPlayerStmt            *sql.Stmt
+	createInstanceStmt                 *sql.Stmt
+	createInstanceCharacterStmt        *sql.Stmt
+	createInstanceCharacterWeaponStmt  *sql.Stmt
+	createInstancePlayerStmt           *sql.Stmt
+	createNextLeaseStmt                *sql.Stmt
+	createPgcrStmt                     *sql.Stmt
+	createQueuedLogEntryStmt           *sql.Stmt
+	createWeaponStmt                   *sql.Stmt
+	deleteInstanceCharacterWeaponsStmt *sql.Stmt
+	deleteInstanceCharactersStmt       *sql.Stmt
+	deleteInstancePlayersStmt          *sql.Stmt
+	failLogEntryStmt                   *sql.Stmt
+	getDestinyPlayerStmt               *sql.Stmt
+	getInstanceStmt                    *sql.Stmt
+	getLogEntryStmt                    *sql.Stmt
+	listHandledInstanceIdsStmt         *sql.Stmt
+	listInstanceCharacterWeaponsStmt   *sql.Stmt
+	listInstanceCharactersStmt         *sql.Stmt
+	listInstancePlayersStmt            *sql.Stmt
+	listLogEntriesStmt                 *sql.Stmt
+	listLogGapsStmt                    *sql.Stmt
+	listPgcrBlobsStmt                  *sql.Stmt
+	listPlayerCountDriftStmt           *sql.Stmt
+	listPlayersToCrawlStmt             *sql.Stmt
+	lockRaidWorldsFirstStmt            *sql.Stmt
+	markLogEntryFetchedStmt            *sql.Stmt
+	markLogEntryOversizedStmt          *sql.Stmt
+	markLogEntryReprocessedStmt        *sql.Stmt
+	markPlayerCrawlFailedStmt          *sql.Stmt
+	markPlayerCrawledStmt              *sql.Stmt
+	markPlayerPrivateStmt              *sql.Stmt
+	markWorldsFirstStmt                *sql.Stmt
+	queueLogEntryStmt                  *sql.Stmt
+	recomputePlayerCountsStmt          *sql.Stmt
+	recordLogEntryStmt                 *sql.Stmt
+	renewLeaseStmt                     *sql.Stmt
+	resetLogEntriesStmt                *sql.Stmt
+	updateInstanceStmt                 *sql.Stmt
+	updateLogEntryStatusStmt           *sql.Stmt
 }
 
 func (q *Queries) WithTx(tx *sql.Tx) *Queries {
 	return &Queries{
-		db:                                tx,
-		tx:                                tx,
-		createDestinyPlayerStmt:           q.createDestinyPlayerStmt,
-		createInstanceStmt:                q.createInstanceStmt,
-		createInstanceCharacterStmt:       q.createInstanceCharacterStmt,
-		createInstanceCharacterWeaponStmt: q.createInstanceCharacterWeaponStmt,
-		createInstancePlayerStmt:          q.createInstancePlayerStmt,
-		createPgcrStmt:                    q.createPgcrStmt,
-		createWeaponStmt:                  q.createWeaponStmt,
-		incrementPlayerCountsStmt:         q.incrementPlayerCountsStmt,
-		updateLogEntryStatusStmt:          q.updateLogEntryStatusStmt,
-		upsertLogEntryStmt:                q.upsertLogEntryStmt,
+		db:                                 tx,
+		tx:                                 tx,
+		claimExpiredLeaseStmt:              q.claimExpiredLeaseStmt,
+		claimLeadershipStmt:                q.claimLeadershipStmt,
+		claimLogEntryStmt:                  q.claimLogEntryStmt,
+		completeLeaseStmt:                  q.completeLeaseStmt,
+		countLogCoverageStmt:               q.countLogCoverageStmt,
+		countLogEntriesByStatusStmt:        q.countLogEntriesByStatusStmt,
+		countLogEntriesByVersionStmt:       q.countLogEntriesByVersionStmt,
+		countLogErrorsStmt:                 q.countLogErrorsStmt,
+		createDestinyPlayerStmt:            q.createDestinyPlayerStmt,
+		createInstanceStmt:                 q.createInstanceStmt,
+		createInstanceCharacterStmt:        q.createInstanceCharacterStmt,
+		createInstanceCharacterWeaponStmt:  q.createInstanceCharacterWeaponStmt,
+		createInstancePlayerStmt:           q.createInstancePlayerStmt,
+		createNextLeaseStmt:                q.createNextLeaseStmt,
+		createPgcrStmt:                     q.createPgcrStmt,
+		createQueuedLogEntryStmt:           q.createQueuedLogEntryStmt,
+		createWeaponStmt:                   q.createWeaponStmt,
+		deleteInstanceCharacterWeaponsStmt: q.deleteInstanceCharacterWeaponsStmt,
+		deleteInstanceCharactersStmt:       q.deleteInstanceCharactersStmt,
+		deleteInstancePlayersStmt:          q.deleteInstancePlayersStmt,
+		failLogEntryStmt:                   q.failLogEntryStmt,
+		getDestinyPlayerStmt:               q.getDestinyPlayerStmt,
+		getInstanceStmt:                    q.getInstanceStmt,
+		getLogEntryStmt:                    q.getLogEntryStmt,
+		listHandledInstanceIdsStmt:         q.listHandledInstanceIdsStmt,
+		listInstanceCharacterWeaponsStmt:   q.listInstanceCharacterWeaponsStmt,
+		listInstanceCharactersStmt:         q.listInstanceCharactersStmt,
+		listInstancePlayersStmt:            q.listInstancePlayersStmt,
+		listLogEntriesStmt:                 q.listLogEntriesStmt,
+		listLogGapsStmt:                    q.listLogGapsStmt,
+		listPgcrBlobsStmt:                  q.listPgcrBlobsStmt,
+		listPlayerCountDriftStmt:           q.listPlayerCountDriftStmt,
+		listPlayersToCrawlStmt:             q.listPlayersToCrawlStmt,
+		lockRaidWorldsFirstStmt:            q.lockRaidWorldsFirstStmt,
+		markLogEntryFetchedStmt:            q.markLogEntryFetchedStmt,
+		markLogEntryOversizedStmt:          q.markLogEntryOversizedStmt,
+		markLogEntryReprocessedStmt:        q.markLogEntryReprocessedStmt,
+		markPlayerCrawlFailedStmt:          q.markPlayerCrawlFailedStmt,
+		markPlayerCrawledStmt:              q.markPlayerCrawledStmt,
+		markPlayerPrivateStmt:              q.markPlayerPrivateStmt,
+		markWorldsFirstStmt:                q.markWorldsFirstStmt,
+		queueLogEntryStmt:                  q.queueLogEntryStmt,
+		recomputePlayerCountsStmt:          q.recomputePlayerCountsStmt,
+		recordLogEntryStmt:                 q.recordLogEntryStmt,
+		renewLeaseStmt:                     q.renewLeaseStmt,
+		resetLogEntriesStmt:                q.resetLogEntriesStmt,
+		updateInstanceStmt:                 q.updateInstanceStmt,
+		updateLogEntryStatusStmt:           q.updateLogEntryStatusStmt,
 	}
 }
@@ -45,9 +45,8 @@ DO UPDATE
         global_display_name_code = excluded.global_display_name_code,
         icon_path = excluded.icon_path,
         is_public = excluded.is_public,
-        last_seen = now(),
-        last_crawled = now()
-RETURNING membership_id, membership_type, icon_path, display_name, global_display_name, global_display_name_code, total_clears, total_full_clears, is_public, last_crawled, last_seen, created_at
+        last_seen = now()
+RETURNING membership_id, membership_type, icon_path, display_name, global_display_name, global_display_name_code, total_clears, total_full_clears, is_public, last_crawled, last_seen, created_at, crawl_failed_at
 `
 
 type CreateDestinyPlayerParams struct {
@@ -92,25 +91,210 @@ func (q *Queries) CreateDestinyPlayer(ctx context.Context, arg CreateDestinyPlay
 		&i.LastCrawled,
 		&i.LastSeen,
 		&i.CreatedAt,
+		&i.CrawlFailedAt,
 	)
 	return i, err
 }
 
-const incrementPlayerCounts = `-- name: IncrementPlayerCounts :exec
+const getDestinyPlayer = `-- name: GetDestinyPlayer :one
+SELECT membership_id, membership_type, icon_path, display_name, global_display_name, global_display_name_code, total_clears, total_full_clears, is_public, last_crawled, last_seen, created_at, crawl_failed_at FROM destiny_player
+WHERE membership_id = $1
+`
+
+func (q *Queries) GetDestinyPlayer(ctx context.Context, membershipID int64) (DestinyPlayer, error) {
+	row := q.queryRow(ctx, q.getDestinyPlayerStmt, getDestinyPlayer, membershipID)
+	var i DestinyPlayer
+	err := row.Scan(
+		&i.MembershipID,
+		&i.MembershipType,
+		&i.IconPath,
+		&i.DisplayName,
+		&i.GlobalDisplayName,
+		&i.GlobalDisplayNameCode,
+		&i.TotalClears,
+		&i.TotalFullClears,
+		&i.IsPublic,
+		&i.LastCrawled,
+		&i.LastSeen,
+		&i.CreatedAt,
+		&i.CrawlFailedAt,
+	)
+	return i, err
+}
+
+const listPlayerCountDrift = `-- name: ListPlayerCountDrift :many
+SELECT
+    dp.membership_id,
+    dp.total_clears,
+    dp.total_full_clears,
+    coalesce(c.clears, 0)::int AS expected_clears,
+    coalesce(c.full_clears, 0)::int AS expected_full_clears
+FROM destiny_player AS dp
+LEFT JOIN (
+    SELECT
+        ip.membership_id,
+        count(*) FILTER (WHERE ip.completed) AS clears,
+        count(*) FILTER (WHERE ip.completed AND i.is_fresh) AS full_clears
+    FROM instance_player AS ip
+    INNER JOIN instance AS i ON ip.instance_id = i.id
+    GROUP BY ip.membership_id
+) AS c ON dp.membership_id = c.membership_id
+WHERE
+    dp.total_clears != coalesce(c.clears, 0)
+    OR dp.total_full_clears != coalesce(c.full_clears, 0)
+ORDER BY dp.membership_id
+`
+
+type ListPlayerCountDriftRow struct {
+	MembershipID       int64 `json:"membership_id"`
+	TotalClears        int32 `json:"total_clears"`
+	TotalFullClears    int32 `json:"total_full_clears"`
+	ExpectedClears     int32 `json:"expected_clears"`
+	ExpectedFullClears int32 `json:"expected_full_clears"`
+}
+
+// Players whose stored clear counts don't match the instances they're recorded in
+func (q *Queries) ListPlayerCountDrift(ctx context.Context) ([]ListPlayerCountDriftRow, error) {
+	rows, err := q.query(ctx, q.listPlayerCountDriftStmt, listPlayerCountDrift)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListPlayerCountDriftRow{}
+	for rows.Next() {
+		var i ListPlayerCountDriftRow
+		if err := rows.Scan(
+			&i.MembershipID,
+			&i.TotalClears,
+			&i.TotalFullClears,
+			&i.ExpectedClears,
+			&i.ExpectedFullClears,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPlayersToCrawl = `-- name: ListPlayersToCrawl :many
+SELECT membership_id, membership_type, icon_path, display_name, global_display_name, global_display_name_code, total_clears, total_full_clears, is_public, last_crawled, last_seen, created_at, crawl_failed_at FROM destiny_player
+WHERE
+    last_crawled < now() - make_interval(secs => $1::int)
+    AND is_public IS DISTINCT FROM false
+    AND (
+        crawl_failed_at IS NULL
+        OR crawl_failed_at < now() - make_interval(secs => $1::int)
+    )
+ORDER BY last_crawled
+LIMIT $2::int
+`
+
+type ListPlayersToCrawlParams struct {
+	MinAgeSeconds int32 `json:"min_age_seconds"`
+	MaxRows       int32 `json:"max_rows"`
+}
+
+// Players whose activity history wasn't walked recently, least recent first.
+// Players known to be private or whose last walk failed recently are left out
+func (q *Queries) ListPlayersToCrawl(ctx context.Context, arg ListPlayersToCrawlParams) ([]DestinyPlayer, error) {
+	rows, err := q.query(ctx, q.listPlayersToCrawlStmt, listPlayersToCrawl, arg.MinAgeSeconds, arg.MaxRows)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []DestinyPlayer{}
+	for rows.Next() {
+		var i DestinyPlayer
+		if err := rows.Scan(
+			&i.MembershipID,
+			&i.MembershipType,
+			&i.IconPath,
+			&i.DisplayName,
+			&i.GlobalDisplayName,
+			&i.GlobalDisplayNameCode,
+			&i.TotalClears,
+			&i.TotalFullClears,
+			&i.IsPublic,
+			&i.LastCrawled,
+			&i.LastSeen,
+			&i.CreatedAt,
+			&i.CrawlFailedAt,
+			&i.CrawlFailedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markPlayerCrawlFailed = `-- name: MarkPlayerCrawlFailed :exec
 UPDATE destiny_player
-SET
-    total_clears = total_clears + CASE WHEN $2::boolean THEN 1 ELSE 0 END,
-    total_full_clears = total_full_clears + CASE WHEN $3::boolean THEN 1 ELSE 0 END
+SET crawl_failed_at = now()
+WHERE membership_id = $1
+`
+
+// Leaves last_crawled alone so the next walk still covers what this one missed
+func (q *Queries) MarkPlayerCrawlFailed(ctx context.Context, membershipID int64) error {
+	_, err := q.exec(ctx, q.markPlayerCrawlFailedStmt, markPlayerCrawlFailed, membershipID)
+	return err
+}
+
+const markPlayerCrawled = `-- name: MarkPlayerCrawled :exec
+UPDATE destiny_player
+SET last_crawled = now(), crawl_failed_at = NULL
 WHERE membership_id = $1
 `
 
-type IncrementPlayerCountsParams struct {
-	MembershipID int64 `json:"membership_id"`
-	Column2      bool  `json:"column_2"`
-	Column3      bool  `json:"column_3"`
+func (q *Queries) MarkPlayerCrawled(ctx context.Context, membershipID int64) error {
+	_, err := q.exec(ctx, q.markPlayerCrawledStmt, markPlayerCrawled, membershipID)
+	return err
 }
 
-func (q *Queries) IncrementPlayerCounts(ctx context.Context, arg IncrementPlayerCountsParams) error {
-	_, err := q.exec(ctx, q.incrementPlayerCountsStmt, incrementPlayerCounts, arg.MembershipID, arg.Column2, arg.Column3)
+const markPlayerPrivate = `-- name: MarkPlayerPrivate :exec
+UPDATE destiny_player
+SET is_public = false
+WHERE membership_id = $1
+`
+
+// Recording a pgcr of the player sets is_public again
+func (q *Queries) MarkPlayerPrivate(ctx context.Context, membershipID int64) error {
+	_, err := q.exec(ctx, q.markPlayerPrivateStmt, markPlayerPrivate, membershipID)
+	return err
+}
+
+const recomputePlayerCounts = `-- name: RecomputePlayerCounts :exec
+UPDATE destiny_player AS dp
+SET
+    total_clears = (
+        SELECT count(*)
+        FROM instance_player AS ip
+        WHERE ip.membership_id = dp.membership_id AND ip.completed
+    ),
+    total_full_clears = (
+        SELECT count(*)
+        FROM instance_player AS ip
+        INNER JOIN instance AS i ON ip.instance_id = i.id
+        WHERE ip.membership_id = dp.membership_id AND ip.completed AND i.is_fresh
+    )
+WHERE dp.membership_id = $1
+`
+
+// Derives the clear counts of a player from the instances they're recorded in
+func (q *Queries) RecomputePlayerCounts(ctx context.Context, membershipID int64) error {
+	_, err := q.exec(ctx, q.recomputePlayerCountsStmt, recomputePlayerCounts, membershipID)
 	return err
 }
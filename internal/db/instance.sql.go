@@ -7,6 +7,7 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"time"
 )
 
@@ -20,22 +21,30 @@ INSERT INTO instance (
     player_count,
     duration_seconds,
     end_time,
-    start_time
+    start_time,
+    clear_type,
+    completion_reason,
+    completion_status,
+    is_contest
 ) VALUES (
-    $1, $2, $3, $4, $5, $6, $7, $8, $9
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13
 )
 `
 
 type CreateInstanceParams struct {
-	ID              int64     `json:"id"`
-	ActivityHash    int64     `json:"activity_hash"`
-	IsFresh         bool      `json:"is_fresh"`
-	Flawless        bool      `json:"flawless"`
-	Completed       bool      `json:"completed"`
-	PlayerCount     int32     `json:"player_count"`
-	DurationSeconds int32     `json:"duration_seconds"`
-	EndTime         time.Time `json:"end_time"`
-	StartTime       time.Time `json:"start_time"`
+	ID               int64          `json:"id"`
+	ActivityHash     int64          `json:"activity_hash"`
+	IsFresh          bool           `json:"is_fresh"`
+	Flawless         bool           `json:"flawless"`
+	Completed        bool           `json:"completed"`
+	PlayerCount      int32          `json:"player_count"`
+	DurationSeconds  int32          `json:"duration_seconds"`
+	EndTime          time.Time      `json:"end_time"`
+	StartTime        time.Time      `json:"start_time"`
+	ClearType        sql.NullString `json:"clear_type"`
+	CompletionReason sql.NullInt32  `json:"completion_reason"`
+	CompletionStatus sql.NullString `json:"completion_status"`
+	IsContest        bool           `json:"is_contest"`
 }
 
 func (q *Queries) CreateInstance(ctx context.Context, arg CreateInstanceParams) error {
@@ -49,6 +58,144 @@ func (q *Queries) CreateInstance(ctx context.Context, arg CreateInstanceParams)
 		arg.DurationSeconds,
 		arg.EndTime,
 		arg.StartTime,
+		arg.ClearType,
+		arg.CompletionReason,
+		arg.CompletionStatus,
+		arg.IsContest,
+	)
+	return err
+}
+
+const getInstance = `-- name: GetInstance :one
+SELECT id, activity_hash, is_fresh, flawless, completed, player_count, duration_seconds, end_time, start_time, created_at, clear_type, completion_reason, completion_status, is_contest, is_worlds_first FROM instance
+WHERE id = $1
+`
+
+func (q *Queries) GetInstance(ctx context.Context, id int64) (Instance, error) {
+	row := q.queryRow(ctx, q.getInstanceStmt, getInstance, id)
+	var i Instance
+	err := row.Scan(
+		&i.ID,
+		&i.ActivityHash,
+		&i.IsFresh,
+		&i.Flawless,
+		&i.Completed,
+		&i.PlayerCount,
+		&i.DurationSeconds,
+		&i.EndTime,
+		&i.StartTime,
+		&i.CreatedAt,
+		&i.ClearType,
+		&i.CompletionReason,
+		&i.CompletionStatus,
+		&i.IsContest,
+		&i.IsWorldsFirst,
+	)
+	return i, err
+}
+
+const lockRaidWorldsFirst = `-- name: LockRaidWorldsFirst :exec
+SELECT pg_advisory_xact_lock(hashtext('worlds_first'), activity.name_id::int)
+FROM activity
+WHERE activity.activity_hash = $1
+`
+
+// Serializes the World's First of a raid until the transaction ends. Under read
+// committed, MarkWorldsFirst only sees the clears other processors committed
+// before it started, two of them racing would each flag their own instance
+func (q *Queries) LockRaidWorldsFirst(ctx context.Context, activityHash int64) error {
+	_, err := q.exec(ctx, q.lockRaidWorldsFirstStmt, lockRaidWorldsFirst, activityHash)
+	return err
+}
+
+const markWorldsFirst = `-- name: MarkWorldsFirst :exec
+WITH raid AS (
+    SELECT activity_hash
+    FROM activity
+    WHERE name_id = (
+        SELECT name_id FROM activity WHERE activity.activity_hash = $1
+    )
+),
+
+worlds_first AS (
+    SELECT f.id
+    FROM instance AS f
+    WHERE
+        f.activity_hash IN (SELECT activity_hash FROM raid)
+        AND f.is_contest
+        AND f.completed
+    ORDER BY f.end_time ASC, f.id ASC
+    LIMIT 1
+)
+
+UPDATE instance
+SET is_worlds_first = coalesce(instance.id = (SELECT id FROM worlds_first), false)
+WHERE
+    instance.activity_hash IN (SELECT activity_hash FROM raid)
+    AND (instance.is_worlds_first OR instance.id = (SELECT id FROM worlds_first))
+    AND instance.is_worlds_first
+    != coalesce(instance.id = (SELECT id FROM worlds_first), false)
+`
+
+// Moves the World's First flag of the raid that the given activity hash
+// belongs to onto its earliest completed contest instance. Only the rows whose
+// flag changes are written, none unless a clear beats the current first.
+// Unlike the seeded activity.is_worlds_first, which flags the activity hash a
+// race was run on, this flags the single clear that won it
+func (q *Queries) MarkWorldsFirst(ctx context.Context, activityHash int64) error {
+	_, err := q.exec(ctx, q.markWorldsFirstStmt, markWorldsFirst, activityHash)
+	return err
+}
+
+const updateInstance = `-- name: UpdateInstance :exec
+UPDATE instance
+SET
+    activity_hash = $2,
+    is_fresh = $3,
+    flawless = $4,
+    completed = $5,
+    player_count = $6,
+    duration_seconds = $7,
+    end_time = $8,
+    start_time = $9,
+    clear_type = $10,
+    completion_reason = $11,
+    completion_status = $12,
+    is_contest = $13
+WHERE id = $1
+`
+
+type UpdateInstanceParams struct {
+	ID               int64          `json:"id"`
+	ActivityHash     int64          `json:"activity_hash"`
+	IsFresh          bool           `json:"is_fresh"`
+	Flawless         bool           `json:"flawless"`
+	Completed        bool           `json:"completed"`
+	PlayerCount      int32          `json:"player_count"`
+	DurationSeconds  int32          `json:"duration_seconds"`
+	EndTime          time.Time      `json:"end_time"`
+	StartTime        time.Time      `json:"start_time"`
+	ClearType        sql.NullString `json:"clear_type"`
+	CompletionReason sql.NullInt32  `json:"completion_reason"`
+	CompletionStatus sql.NullString `json:"completion_status"`
+	IsContest        bool           `json:"is_contest"`
+}
+
+func (q *Queries) UpdateInstance(ctx context.Context, arg UpdateInstanceParams) error {
+	_, err := q.exec(ctx, q.updateInstanceStmt, updateInstance,
+		arg.ID,
+		arg.ActivityHash,
+		arg.IsFresh,
+		arg.Flawless,
+		arg.Completed,
+		arg.PlayerCount,
+		arg.DurationSeconds,
+		arg.EndTime,
+		arg.StartTime,
+		arg.ClearType,
+		arg.CompletionReason,
+		arg.CompletionStatus,
+		arg.IsContest,
 	)
 	return err
 }
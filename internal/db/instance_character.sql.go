@@ -7,6 +7,7 @@ package db
 
 import (
 	"context"
+	"database/sql"
 )
 
 const createInstanceCharacter = `-- name: CreateInstanceCharacter :exec
@@ -26,7 +27,14 @@ INSERT INTO instance_character (
     melee_kills,
     grenade_kills,
     efficiency,
-    time_played_seconds
+    time_played_seconds,
+    deathless,
+    flawless,
+    character_class,
+    light_level,
+    precision_kills,
+    class_ability_kills,
+    start_seconds
 )
 VALUES (
     $1,
@@ -44,29 +52,43 @@ VALUES (
     $13,
     $14,
     $15,
-    $16
+    $16,
+    $17,
+    $18,
+    $19,
+    $20,
+    $21,
+    $22,
+    $23
 )
 ON CONFLICT (instance_id, membership_id, character_id) DO NOTHING
 RETURNING instance_id
 `
 
 type CreateInstanceCharacterParams struct {
-	InstanceID        int64  `json:"instance_id"`
-	MembershipID      int64  `json:"membership_id"`
-	CharacterID       int64  `json:"character_id"`
-	EmblemHash        int64  `json:"emblem_hash"`
-	ClassHash         int64  `json:"class_hash"`
-	Completed         bool   `json:"completed"`
-	Kills             int32  `json:"kills"`
-	Deaths            int32  `json:"deaths"`
-	Assists           int32  `json:"assists"`
-	Kda               string `json:"kda"`
-	Kdr               string `json:"kdr"`
-	SuperKills        int32  `json:"super_kills"`
-	MeleeKills        int32  `json:"melee_kills"`
-	GrenadeKills      int32  `json:"grenade_kills"`
-	Efficiency        int32  `json:"efficiency"`
-	TimePlayedSeconds int32  `json:"time_played_seconds"`
+	InstanceID        int64          `json:"instance_id"`
+	MembershipID      int64          `json:"membership_id"`
+	CharacterID       int64          `json:"character_id"`
+	EmblemHash        int64          `json:"emblem_hash"`
+	ClassHash         int64          `json:"class_hash"`
+	Completed         bool           `json:"completed"`
+	Kills             int32          `json:"kills"`
+	Deaths            int32          `json:"deaths"`
+	Assists           int32          `json:"assists"`
+	Kda               string         `json:"kda"`
+	Kdr               string         `json:"kdr"`
+	SuperKills        int32          `json:"super_kills"`
+	MeleeKills        int32          `json:"melee_kills"`
+	GrenadeKills      int32          `json:"grenade_kills"`
+	Efficiency        string         `json:"efficiency"`
+	TimePlayedSeconds int32          `json:"time_played_seconds"`
+	Deathless         bool           `json:"deathless"`
+	Flawless          bool           `json:"flawless"`
+	CharacterClass    sql.NullString `json:"character_class"`
+	LightLevel        int32          `json:"light_level"`
+	PrecisionKills    int32          `json:"precision_kills"`
+	ClassAbilityKills int32          `json:"class_ability_kills"`
+	StartSeconds      int32          `json:"start_seconds"`
 }
 
 func (q *Queries) CreateInstanceCharacter(ctx context.Context, arg CreateInstanceCharacterParams) error {
@@ -87,6 +109,76 @@ func (q *Queries) CreateInstanceCharacter(ctx context.Context, arg CreateInstanc
 		arg.GrenadeKills,
 		arg.Efficiency,
 		arg.TimePlayedSeconds,
+		arg.Deathless,
+		arg.Flawless,
+		arg.CharacterClass,
+		arg.LightLevel,
+		arg.PrecisionKills,
+		arg.ClassAbilityKills,
+		arg.StartSeconds,
 	)
 	return err
 }
+
+const deleteInstanceCharacters = `-- name: DeleteInstanceCharacters :exec
+DELETE FROM instance_character
+WHERE instance_id = $1
+`
+
+func (q *Queries) DeleteInstanceCharacters(ctx context.Context, instanceID int64) error {
+	_, err := q.exec(ctx, q.deleteInstanceCharactersStmt, deleteInstanceCharacters, instanceID)
+	return err
+}
+
+const listInstanceCharacters = `-- name: ListInstanceCharacters :many
+SELECT instance_id, membership_id, character_id, class_hash, emblem_hash, completed, kills, deaths, assists, kda, kdr, super_kills, melee_kills, grenade_kills, efficiency, time_played_seconds, deathless, flawless, character_class, light_level, precision_kills, class_ability_kills, start_seconds FROM instance_character
+WHERE instance_id = $1
+ORDER BY membership_id, character_id
+`
+
+func (q *Queries) ListInstanceCharacters(ctx context.Context, instanceID int64) ([]InstanceCharacter, error) {
+	rows, err := q.query(ctx, q.listInstanceCharactersStmt, listInstanceCharacters, instanceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []InstanceCharacter{}
+	for rows.Next() {
+		var i InstanceCharacter
+		if err := rows.Scan(
+			&i.InstanceID,
+			&i.MembershipID,
+			&i.CharacterID,
+			&i.ClassHash,
+			&i.EmblemHash,
+			&i.Completed,
+			&i.Kills,
+			&i.Deaths,
+			&i.Assists,
+			&i.Kda,
+			&i.Kdr,
+			&i.SuperKills,
+			&i.MeleeKills,
+			&i.GrenadeKills,
+			&i.Efficiency,
+			&i.TimePlayedSeconds,
+			&i.Deathless,
+			&i.Flawless,
+			&i.CharacterClass,
+			&i.LightLevel,
+			&i.PrecisionKills,
+			&i.ClassAbilityKills,
+			&i.StartSeconds,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -54,3 +54,50 @@ func (q *Queries) CreateInstanceCharacterWeapon(ctx context.Context, arg CreateI
 	)
 	return err
 }
+
+const deleteInstanceCharacterWeapons = `-- name: DeleteInstanceCharacterWeapons :exec
+DELETE FROM instance_character_weapon
+WHERE instance_id = $1
+`
+
+func (q *Queries) DeleteInstanceCharacterWeapons(ctx context.Context, instanceID int64) error {
+	_, err := q.exec(ctx, q.deleteInstanceCharacterWeaponsStmt, deleteInstanceCharacterWeapons, instanceID)
+	return err
+}
+
+const listInstanceCharacterWeapons = `-- name: ListInstanceCharacterWeapons :many
+SELECT instance_id, player_membership_id, player_character_id, weapon_id, kills, precision_kills, precision_ratio FROM instance_character_weapon
+WHERE instance_id = $1
+ORDER BY player_membership_id, player_character_id, weapon_id
+`
+
+func (q *Queries) ListInstanceCharacterWeapons(ctx context.Context, instanceID int64) ([]InstanceCharacterWeapon, error) {
+	rows, err := q.query(ctx, q.listInstanceCharacterWeaponsStmt, listInstanceCharacterWeapons, instanceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []InstanceCharacterWeapon{}
+	for rows.Next() {
+		var i InstanceCharacterWeapon
+		if err := rows.Scan(
+			&i.InstanceID,
+			&i.PlayerMembershipID,
+			&i.PlayerCharacterID,
+			&i.WeaponID,
+			&i.Kills,
+			&i.PrecisionKills,
+			&i.PrecisionRatio,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -15,12 +15,16 @@ INSERT INTO instance_player (
     instance_id,
     membership_id,
     completed,
-    time_played_seconds
+    time_played_seconds,
+    deathless,
+    flawless
 ) VALUES (
     $1,
     $2,
     $3,
-    $4
+    $4,
+    $5,
+    $6
 ) ON CONFLICT (instance_id, membership_id) DO NOTHING
 `
 
@@ -29,6 +33,8 @@ type CreateInstancePlayerParams struct {
 	MembershipID      int64        `json:"membership_id"`
 	Completed         sql.NullBool `json:"completed"`
 	TimePlayedSeconds int32        `json:"time_played_seconds"`
+	Deathless         bool         `json:"deathless"`
+	Flawless          bool         `json:"flawless"`
 }
 
 func (q *Queries) CreateInstancePlayer(ctx context.Context, arg CreateInstancePlayerParams) error {
@@ -37,6 +43,55 @@ func (q *Queries) CreateInstancePlayer(ctx context.Context, arg CreateInstancePl
 		arg.MembershipID,
 		arg.Completed,
 		arg.TimePlayedSeconds,
+		arg.Deathless,
+		arg.Flawless,
 	)
 	return err
 }
+
+const deleteInstancePlayers = `-- name: DeleteInstancePlayers :exec
+DELETE FROM instance_player
+WHERE instance_id = $1
+`
+
+func (q *Queries) DeleteInstancePlayers(ctx context.Context, instanceID int64) error {
+	_, err := q.exec(ctx, q.deleteInstancePlayersStmt, deleteInstancePlayers, instanceID)
+	return err
+}
+
+const listInstancePlayers = `-- name: ListInstancePlayers :many
+SELECT instance_id, membership_id, completed, time_played_seconds, created_at, deathless, flawless FROM instance_player
+WHERE instance_id = $1
+ORDER BY membership_id
+`
+
+func (q *Queries) ListInstancePlayers(ctx context.Context, instanceID int64) ([]InstancePlayer, error) {
+	rows, err := q.query(ctx, q.listInstancePlayersStmt, listInstancePlayers, instanceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []InstancePlayer{}
+	for rows.Next() {
+		var i InstancePlayer
+		if err := rows.Scan(
+			&i.InstanceID,
+			&i.MembershipID,
+			&i.Completed,
+			&i.TimePlayedSeconds,
+			&i.CreatedAt,
+			&i.Deathless,
+			&i.Flawless,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -10,44 +10,297 @@ import (
 	"database/sql"
 )
 
-const updateLogEntryStatus = `-- name: UpdateLogEntryStatus :exec
-UPDATE ingestion_log
-SET
-    status = $2,
-    last_attempt_at = now(),
-    error = $3
-WHERE instance_id = $1
+const claimLogEntry = `-- name: ClaimLogEntry :one
+INSERT INTO ingestion_log (instance_id, source, status, processor_version)
+VALUES (
+    $1,
+    $2,
+    'processing',
+    $3
+)
+ON CONFLICT (instance_id) DO UPDATE
+    SET
+        status = 'processing',
+        last_attempt_at = now(),
+        attempt_count = ingestion_log.attempt_count + 1,
+        processor_version = excluded.processor_version,
+        error = NULL
+    WHERE ingestion_log.status IN ('queued', 'fetched', 'error', 'processing')
+RETURNING instance_id, source, status, first_seen_at, last_attempt_at, attempt_count, error, processor_version
 `
 
-type UpdateLogEntryStatusParams struct {
-	InstanceID int64          `json:"instance_id"`
-	Status     string         `json:"status"`
-	Error      sql.NullString `json:"error"`
+type ClaimLogEntryParams struct {
+	InstanceID       int64          `json:"instance_id"`
+	Source           string         `json:"source"`
+	ProcessorVersion sql.NullString `json:"processor_version"`
 }
 
-func (q *Queries) UpdateLogEntryStatus(ctx context.Context, arg UpdateLogEntryStatusParams) error {
-	_, err := q.exec(ctx, q.updateLogEntryStatusStmt, updateLogEntryStatus, arg.InstanceID, arg.Status, arg.Error)
+// Moves an instance to processing for the calling processor. Returns no rows
+// when the instance is terminal or parked. The claim is committed along with
+// the outcome of the processing, so a processing entry seen here was left
+// behind by a processor from before the ledger was transactional
+func (q *Queries) ClaimLogEntry(ctx context.Context, arg ClaimLogEntryParams) (IngestionLog, error) {
+	row := q.queryRow(ctx, q.claimLogEntryStmt, claimLogEntry,
+		arg.InstanceID,
+		arg.Source,
+		arg.ProcessorVersion,
+	)
+	var i IngestionLog
+	err := row.Scan(
+		&i.InstanceID,
+		&i.Source,
+		&i.Status,
+		&i.FirstSeenAt,
+		&i.LastAttemptAt,
+		&i.AttemptCount,
+		&i.Error,
+		&i.ProcessorVersion,
+	)
+	return i, err
+}
+
+const countLogCoverage = `-- name: CountLogCoverage :many
+SELECT
+    (
+        $1::bigint
+        + (instance_id - $1::bigint)
+        / $2::bigint
+        * $2::bigint
+    )::bigint AS range_start,
+    count(*) FILTER (WHERE status != 'queued') AS seen,
+    count(*) FILTER (
+        WHERE status IN ('success', 'skipped-non-raid', 'dead', 'oversized')
+    ) AS handled
+FROM ingestion_log
+WHERE instance_id BETWEEN $1::bigint AND $3::bigint
+GROUP BY range_start
+ORDER BY range_start
+`
+
+type CountLogCoverageParams struct {
+	FromID     int64 `json:"from_id"`
+	BucketSize int64 `json:"bucket_size"`
+	ToID       int64 `json:"to_id"`
+}
+
+type CountLogCoverageRow struct {
+	RangeStart int64 `json:"range_start"`
+	Seen       int64 `json:"seen"`
+	Handled    int64 `json:"handled"`
+}
+
+// Entries per range of bucket_size ids starting at from_id. Seen entries made
+// it past queued, handled ones need no further crawling
+func (q *Queries) CountLogCoverage(ctx context.Context, arg CountLogCoverageParams) ([]CountLogCoverageRow, error) {
+	rows, err := q.query(ctx, q.countLogCoverageStmt, countLogCoverage, arg.FromID, arg.BucketSize, arg.ToID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CountLogCoverageRow{}
+	for rows.Next() {
+		var i CountLogCoverageRow
+		if err := rows.Scan(&i.RangeStart, &i.Seen, &i.Handled); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const countLogEntriesByStatus = `-- name: CountLogEntriesByStatus :many
+SELECT status, count(*) AS entries
+FROM ingestion_log
+GROUP BY status
+ORDER BY status
+`
+
+type CountLogEntriesByStatusRow struct {
+	Status  string `json:"status"`
+	Entries int64  `json:"entries"`
+}
+
+func (q *Queries) CountLogEntriesByStatus(ctx context.Context) ([]CountLogEntriesByStatusRow, error) {
+	rows, err := q.query(ctx, q.countLogEntriesByStatusStmt, countLogEntriesByStatus)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CountLogEntriesByStatusRow{}
+	for rows.Next() {
+		var i CountLogEntriesByStatusRow
+		if err := rows.Scan(&i.Status, &i.Entries); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const countLogEntriesByVersion = `-- name: CountLogEntriesByVersion :many
+SELECT coalesce(processor_version, '')::text AS processor_version, count(*) AS entries
+FROM ingestion_log
+WHERE status = 'success'
+GROUP BY processor_version
+ORDER BY entries DESC
+`
+
+type CountLogEntriesByVersionRow struct {
+	ProcessorVersion string `json:"processor_version"`
+	Entries          int64  `json:"entries"`
+}
+
+// Successful entries by the processor version that last built them
+func (q *Queries) CountLogEntriesByVersion(ctx context.Context) ([]CountLogEntriesByVersionRow, error) {
+	rows, err := q.query(ctx, q.countLogEntriesByVersionStmt, countLogEntriesByVersion)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CountLogEntriesByVersionRow{}
+	for rows.Next() {
+		var i CountLogEntriesByVersionRow
+		if err := rows.Scan(&i.ProcessorVersion, &i.Entries); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const countLogErrors = `-- name: CountLogErrors :many
+SELECT status, error, count(*) AS entries
+FROM ingestion_log
+WHERE status IN ('error', 'dead')
+GROUP BY status, error
+ORDER BY entries DESC
+LIMIT $1
+`
+
+type CountLogErrorsRow struct {
+	Status  string         `json:"status"`
+	Error   sql.NullString `json:"error"`
+	Entries int64          `json:"entries"`
+}
+
+// The most common failures of instances that are still failing
+func (q *Queries) CountLogErrors(ctx context.Context, limit int32) ([]CountLogErrorsRow, error) {
+	rows, err := q.query(ctx, q.countLogErrorsStmt, countLogErrors, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CountLogErrorsRow{}
+	for rows.Next() {
+		var i CountLogErrorsRow
+		if err := rows.Scan(&i.Status, &i.Error, &i.Entries); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const createQueuedLogEntry = `-- name: CreateQueuedLogEntry :exec
+INSERT INTO ingestion_log (instance_id, source, status, attempt_count)
+VALUES ($1, $2, 'queued', 0)
+ON CONFLICT (instance_id) DO NOTHING
+`
+
+type CreateQueuedLogEntryParams struct {
+	InstanceID int64  `json:"instance_id"`
+	Source     string `json:"source"`
+}
+
+func (q *Queries) CreateQueuedLogEntry(ctx context.Context, arg CreateQueuedLogEntryParams) error {
+	_, err := q.exec(ctx, q.createQueuedLogEntryStmt, createQueuedLogEntry, arg.InstanceID, arg.Source)
 	return err
 }
 
-const upsertLogEntry = `-- name: UpsertLogEntry :one
-INSERT INTO ingestion_log (instance_id, source, status)
-VALUES ($1, $2, $3)
+const failLogEntry = `-- name: FailLogEntry :one
+INSERT INTO ingestion_log (
+    instance_id, source, status, error, processor_version
+)
+VALUES (
+    $1,
+    $2,
+    CASE WHEN $3::boolean THEN 'dead' ELSE 'error' END,
+    $4,
+    $5
+)
 ON CONFLICT (instance_id) DO UPDATE
     SET
+        status = CASE
+            WHEN
+                $3::boolean
+                OR ingestion_log.attempt_count + 1 >= $6::int
+                THEN 'dead'
+            ELSE 'error'
+        END,
         last_attempt_at = now(),
-        attempt_count = ingestion_log.attempt_count + 1
-RETURNING instance_id, source, status, first_seen_at, last_attempt_at, attempt_count, error
+        attempt_count = ingestion_log.attempt_count + 1,
+        processor_version = excluded.processor_version,
+        error = excluded.error
+    WHERE ingestion_log.status NOT IN ('success', 'skipped-non-raid')
+RETURNING status
 `
 
-type UpsertLogEntryParams struct {
-	InstanceID int64  `json:"instance_id"`
-	Source     string `json:"source"`
-	Status     string `json:"status"`
+type FailLogEntryParams struct {
+	InstanceID       int64          `json:"instance_id"`
+	Source           string         `json:"source"`
+	Permanent        bool           `json:"permanent"`
+	Error            sql.NullString `json:"error"`
+	ProcessorVersion sql.NullString `json:"processor_version"`
+	MaxAttempts      int32          `json:"max_attempts"`
 }
 
-func (q *Queries) UpsertLogEntry(ctx context.Context, arg UpsertLogEntryParams) (IngestionLog, error) {
-	row := q.queryRow(ctx, q.upsertLogEntryStmt, upsertLogEntry, arg.InstanceID, arg.Source, arg.Status)
+// Records a failed attempt outside of the rolled back processing transaction.
+// The instance is dead once the failure is permanent or it ran out of attempts
+func (q *Queries) FailLogEntry(ctx context.Context, arg FailLogEntryParams) (string, error) {
+	row := q.queryRow(ctx, q.failLogEntryStmt, failLogEntry,
+		arg.InstanceID,
+		arg.Source,
+		arg.Permanent,
+		arg.Error,
+		arg.ProcessorVersion,
+		arg.MaxAttempts,
+	)
+	var status string
+	err := row.Scan(&status)
+	return status, err
+}
+
+const getLogEntry = `-- name: GetLogEntry :one
+SELECT instance_id, source, status, first_seen_at, last_attempt_at, attempt_count, error, processor_version FROM ingestion_log
+WHERE instance_id = $1
+`
+
+func (q *Queries) GetLogEntry(ctx context.Context, instanceID int64) (IngestionLog, error) {
+	row := q.queryRow(ctx, q.getLogEntryStmt, getLogEntry, instanceID)
 	var i IngestionLog
 	err := row.Scan(
 		&i.InstanceID,
@@ -57,6 +310,380 @@ func (q *Queries) UpsertLogEntry(ctx context.Context, arg UpsertLogEntryParams)
 		&i.LastAttemptAt,
 		&i.AttemptCount,
 		&i.Error,
+		&i.ProcessorVersion,
 	)
 	return i, err
 }
+
+const listHandledInstanceIds = `-- name: ListHandledInstanceIds :many
+SELECT instance_id FROM ingestion_log
+WHERE
+    instance_id BETWEEN $1::bigint AND $2::bigint
+    AND status IN ('success', 'skipped-non-raid', 'dead', 'oversized')
+ORDER BY instance_id
+`
+
+type ListHandledInstanceIdsParams struct {
+	FromID int64 `json:"from_id"`
+	ToID   int64 `json:"to_id"`
+}
+
+// Instances within the range that don't need to be crawled again
+func (q *Queries) ListHandledInstanceIds(ctx context.Context, arg ListHandledInstanceIdsParams) ([]int64, error) {
+	rows, err := q.query(ctx, q.listHandledInstanceIdsStmt, listHandledInstanceIds, arg.FromID, arg.ToID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []int64{}
+	for rows.Next() {
+		var instance_id int64
+		if err := rows.Scan(&instance_id); err != nil {
+			return nil, err
+		}
+		items = append(items, instance_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listLogEntries = `-- name: ListLogEntries :many
+SELECT instance_id, source, status, first_seen_at, last_attempt_at, attempt_count, error, processor_version FROM ingestion_log
+WHERE
+    ($1::text = '' OR status = $1::text)
+    AND ($2::text = '' OR source = $2::text)
+    AND (
+        $3::text = ''
+        OR error ILIKE '%' || $3::text || '%'
+    )
+    AND last_attempt_at
+    <= now() - make_interval(secs => $4::int)
+    AND (
+        $5::text = ''
+        OR processor_version = $5::text
+    )
+ORDER BY last_attempt_at
+LIMIT $6
+`
+
+type ListLogEntriesParams struct {
+	Status           string `json:"status"`
+	Source           string `json:"source"`
+	ErrorContains    string `json:"error_contains"`
+	OlderThanSeconds int32  `json:"older_than_seconds"`
+	ProcessorVersion string `json:"processor_version"`
+	MaxRows          int32  `json:"max_rows"`
+}
+
+// Empty filters are ignored
+func (q *Queries) ListLogEntries(ctx context.Context, arg ListLogEntriesParams) ([]IngestionLog, error) {
+	rows, err := q.query(ctx, q.listLogEntriesStmt, listLogEntries,
+		arg.Status,
+		arg.Source,
+		arg.ErrorContains,
+		arg.OlderThanSeconds,
+		arg.ProcessorVersion,
+		arg.MaxRows,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []IngestionLog{}
+	for rows.Next() {
+		var i IngestionLog
+		if err := rows.Scan(
+			&i.InstanceID,
+			&i.Source,
+			&i.Status,
+			&i.FirstSeenAt,
+			&i.LastAttemptAt,
+			&i.AttemptCount,
+			&i.Error,
+			&i.ProcessorVersion,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listLogGaps = `-- name: ListLogGaps :many
+WITH seen AS (
+    SELECT instance_id FROM ingestion_log
+    WHERE
+        instance_id BETWEEN $1::bigint AND $2::bigint
+        AND (
+            status != 'queued'
+            OR last_attempt_at
+            > now() - make_interval(secs => $3::int)
+        )
+    UNION ALL
+    SELECT $1::bigint - 1
+    UNION ALL
+    SELECT $2::bigint + 1
+),
+
+bounds AS (
+    SELECT
+        instance_id,
+        lead(instance_id) OVER (ORDER BY instance_id) AS next_id
+    FROM seen
+)
+
+SELECT
+    (instance_id + 1)::bigint AS gap_start,
+    (next_id - 1)::bigint AS gap_end
+FROM bounds
+WHERE
+    next_id > instance_id + 1
+    AND NOT EXISTS (
+        SELECT 1 FROM crawl_lease AS cl
+        WHERE
+            cl.status = 'leased'
+            AND cl.range_start <= bounds.next_id - 1
+            AND cl.range_end >= bounds.instance_id + 1
+    )
+ORDER BY gap_start
+LIMIT $4::int
+`
+
+type ListLogGapsParams struct {
+	FromID       int64 `json:"from_id"`
+	ToID         int64 `json:"to_id"`
+	StaleSeconds int32 `json:"stale_seconds"`
+	MaxGaps      int32 `json:"max_gaps"`
+}
+
+type ListLogGapsRow struct {
+	GapStart int64 `json:"gap_start"`
+	GapEnd   int64 `json:"gap_end"`
+}
+
+// Ranges of ids within the window the crawler never got past queued, either
+// because they have no entry at all or their entry is stuck in queued
+// Ranges overlapping a lease still being crawled aren't gaps yet
+func (q *Queries) ListLogGaps(ctx context.Context, arg ListLogGapsParams) ([]ListLogGapsRow, error) {
+	rows, err := q.query(ctx, q.listLogGapsStmt, listLogGaps,
+		arg.FromID,
+		arg.ToID,
+		arg.StaleSeconds,
+		arg.MaxGaps,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListLogGapsRow{}
+	for rows.Next() {
+		var i ListLogGapsRow
+		if err := rows.Scan(&i.GapStart, &i.GapEnd); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markLogEntryFetched = `-- name: MarkLogEntryFetched :exec
+UPDATE ingestion_log
+SET
+    status = 'fetched',
+    last_attempt_at = now()
+WHERE instance_id = $1 AND status = 'queued'
+`
+
+// Only moves entries forward, a processor may already have claimed the instance
+func (q *Queries) MarkLogEntryFetched(ctx context.Context, instanceID int64) error {
+	_, err := q.exec(ctx, q.markLogEntryFetchedStmt, markLogEntryFetched, instanceID)
+	return err
+}
+
+const markLogEntryOversized = `-- name: MarkLogEntryOversized :exec
+INSERT INTO ingestion_log (instance_id, source, status, error)
+VALUES ($1, $2, 'oversized', $3)
+ON CONFLICT (instance_id) DO UPDATE
+    SET
+        status = 'oversized',
+        last_attempt_at = now(),
+        error = excluded.error
+    WHERE ingestion_log.status = 'queued'
+`
+
+type MarkLogEntryOversizedParams struct {
+	InstanceID int64          `json:"instance_id"`
+	Source     string         `json:"source"`
+	Error      sql.NullString `json:"error"`
+}
+
+// Parks an instance whose pgcr is over the crawler's size limit until it's
+// requeued with a higher one. Entries the crawler didn't queue are left alone
+func (q *Queries) MarkLogEntryOversized(ctx context.Context, arg MarkLogEntryOversizedParams) error {
+	_, err := q.exec(ctx, q.markLogEntryOversizedStmt, markLogEntryOversized, arg.InstanceID, arg.Source, arg.Error)
+	return err
+}
+
+const markLogEntryReprocessed = `-- name: MarkLogEntryReprocessed :exec
+INSERT INTO ingestion_log (instance_id, source, status, processor_version)
+VALUES (
+    $1,
+    $2,
+    'success',
+    $3
+)
+ON CONFLICT (instance_id) DO UPDATE
+    SET
+        status = 'success',
+        last_attempt_at = now(),
+        processor_version = excluded.processor_version,
+        error = NULL
+`
+
+type MarkLogEntryReprocessedParams struct {
+	InstanceID       int64          `json:"instance_id"`
+	Source           string         `json:"source"`
+	ProcessorVersion sql.NullString `json:"processor_version"`
+}
+
+// Records a successful reprocess with the version that rebuilt the instance.
+// Instances stored before the ledger existed get an entry under the given source
+func (q *Queries) MarkLogEntryReprocessed(ctx context.Context, arg MarkLogEntryReprocessedParams) error {
+	_, err := q.exec(ctx, q.markLogEntryReprocessedStmt, markLogEntryReprocessed, arg.InstanceID, arg.Source, arg.ProcessorVersion)
+	return err
+}
+
+const queueLogEntry = `-- name: QueueLogEntry :execrows
+INSERT INTO ingestion_log (instance_id, source, status, attempt_count)
+VALUES ($1, $2, 'queued', 0)
+ON CONFLICT (instance_id) DO UPDATE
+    SET
+        status = 'queued',
+        attempt_count = 0,
+        last_attempt_at = now(),
+        error = NULL
+    WHERE ingestion_log.status != 'success'
+`
+
+type QueueLogEntryParams struct {
+	InstanceID int64  `json:"instance_id"`
+	Source     string `json:"source"`
+}
+
+// Queues an instance for another crawl. Successfully processed instances are
+// left untouched, they can only be rebuilt from their stored pgcr
+func (q *Queries) QueueLogEntry(ctx context.Context, arg QueueLogEntryParams) (int64, error) {
+	result, err := q.exec(ctx, q.queueLogEntryStmt, queueLogEntry, arg.InstanceID, arg.Source)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const recordLogEntry = `-- name: RecordLogEntry :exec
+INSERT INTO ingestion_log (instance_id, source, status, processor_version)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (instance_id) DO UPDATE
+    SET
+        status = excluded.status,
+        last_attempt_at = now(),
+        attempt_count = ingestion_log.attempt_count + 1,
+        processor_version = excluded.processor_version,
+        error = NULL
+    WHERE ingestion_log.status != 'success'
+`
+
+type RecordLogEntryParams struct {
+	InstanceID       int64          `json:"instance_id"`
+	Source           string         `json:"source"`
+	Status           string         `json:"status"`
+	ProcessorVersion sql.NullString `json:"processor_version"`
+}
+
+// Records an instance that was handled without being claimed, e.g. skipped
+// non raid activities. Successfully processed instances are left untouched
+func (q *Queries) RecordLogEntry(ctx context.Context, arg RecordLogEntryParams) error {
+	_, err := q.exec(ctx, q.recordLogEntryStmt, recordLogEntry,
+		arg.InstanceID,
+		arg.Source,
+		arg.Status,
+		arg.ProcessorVersion,
+	)
+	return err
+}
+
+const resetLogEntries = `-- name: ResetLogEntries :execrows
+UPDATE ingestion_log
+SET
+    status = 'queued',
+    attempt_count = 0,
+    last_attempt_at = now(),
+    error = NULL
+WHERE
+    status = $1::text
+    AND ($2::text = '' OR source = $2::text)
+    AND (
+        $3::text = ''
+        OR error ILIKE '%' || $3::text || '%'
+    )
+    AND last_attempt_at
+    <= now() - make_interval(secs => $4::int)
+`
+
+type ResetLogEntriesParams struct {
+	Status           string `json:"status"`
+	Source           string `json:"source"`
+	ErrorContains    string `json:"error_contains"`
+	OlderThanSeconds int32  `json:"older_than_seconds"`
+}
+
+// Moves matching entries back to queued with a fresh attempt budget
+func (q *Queries) ResetLogEntries(ctx context.Context, arg ResetLogEntriesParams) (int64, error) {
+	result, err := q.exec(ctx, q.resetLogEntriesStmt, resetLogEntries,
+		arg.Status,
+		arg.Source,
+		arg.ErrorContains,
+		arg.OlderThanSeconds,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateLogEntryStatus = `-- name: UpdateLogEntryStatus :exec
+UPDATE ingestion_log
+SET
+    status = $2,
+    last_attempt_at = now(),
+    error = $3
+WHERE instance_id = $1
+`
+
+type UpdateLogEntryStatusParams struct {
+	InstanceID int64          `json:"instance_id"`
+	Status     string         `json:"status"`
+	Error      sql.NullString `json:"error"`
+}
+
+func (q *Queries) UpdateLogEntryStatus(ctx context.Context, arg UpdateLogEntryStatusParams) error {
+	_, err := q.exec(ctx, q.updateLogEntryStatusStmt, updateLogEntryStatus, arg.InstanceID, arg.Status, arg.Error)
+	return err
+}
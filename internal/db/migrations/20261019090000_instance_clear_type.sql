@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+-- 'Solo' | 'Duo' | 'Trio' | 'Solo Flawless' | 'Duo Flawless' | 'Trio Flawless'
+ALTER TABLE instance ADD COLUMN IF NOT EXISTS clear_type text;
+
+CREATE INDEX IF NOT EXISTS instance_clear_type_idx ON instance (
+    clear_type
+) WHERE clear_type IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS instance_clear_type_idx;
+
+ALTER TABLE instance DROP COLUMN IF EXISTS clear_type;
+-- +goose StatementEnd
@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE instance_player
+ADD COLUMN IF NOT EXISTS deathless boolean NOT NULL DEFAULT FALSE,
+ADD COLUMN IF NOT EXISTS flawless boolean NOT NULL DEFAULT FALSE;
+
+ALTER TABLE instance_character
+ADD COLUMN IF NOT EXISTS deathless boolean NOT NULL DEFAULT FALSE,
+ADD COLUMN IF NOT EXISTS flawless boolean NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS instance_player_flawless_idx ON instance_player (
+    membership_id
+) WHERE flawless;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS instance_player_flawless_idx;
+
+ALTER TABLE instance_character
+DROP COLUMN IF EXISTS flawless,
+DROP COLUMN IF EXISTS deathless;
+
+ALTER TABLE instance_player
+DROP COLUMN IF EXISTS flawless,
+DROP COLUMN IF EXISTS deathless;
+-- +goose StatementEnd
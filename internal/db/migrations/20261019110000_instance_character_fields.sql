@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE instance_character
+ADD COLUMN IF NOT EXISTS character_class text,
+ADD COLUMN IF NOT EXISTS light_level int NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS precision_kills int NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS class_ability_kills int NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS start_seconds int NOT NULL DEFAULT 0,
+ALTER COLUMN efficiency TYPE decimal;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE instance_character
+DROP COLUMN IF EXISTS start_seconds,
+DROP COLUMN IF EXISTS class_ability_kills,
+DROP COLUMN IF EXISTS precision_kills,
+DROP COLUMN IF EXISTS light_level,
+DROP COLUMN IF EXISTS character_class,
+ALTER COLUMN efficiency TYPE int USING round(efficiency);
+-- +goose StatementEnd
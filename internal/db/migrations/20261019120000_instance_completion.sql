@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE instance
+ALTER COLUMN completed SET DEFAULT FALSE,
+ADD COLUMN IF NOT EXISTS completion_reason int,
+-- 'Finished' | 'Wiped' | 'Abandoned'
+ADD COLUMN IF NOT EXISTS completion_status text;
+
+-- Instances were stored as not completed until now, an instance is completed
+-- as soon as a single character completed it. Whether the others were wiped
+-- or abandoned can only be told by reprocessing them
+UPDATE instance AS i
+SET
+    completed = true,
+    completion_status = 'Finished'
+WHERE EXISTS (
+    SELECT 1
+    FROM instance_character AS c
+    WHERE c.instance_id = i.id AND c.completed
+)
+OR EXISTS (
+    SELECT 1
+    FROM instance_player AS p
+    WHERE p.instance_id = i.id AND p.completed
+);
+
+CREATE INDEX IF NOT EXISTS instance_completed_idx ON instance (
+    activity_hash
+) WHERE completed;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS instance_completed_idx;
+
+ALTER TABLE instance
+DROP COLUMN IF EXISTS completion_status,
+DROP COLUMN IF EXISTS completion_reason,
+ALTER COLUMN completed DROP DEFAULT;
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE instance
+ADD COLUMN IF NOT EXISTS is_contest boolean NOT NULL DEFAULT FALSE,
+ADD COLUMN IF NOT EXISTS is_worlds_first boolean NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS instance_contest_idx ON instance (
+    activity_hash, end_time
+) WHERE is_contest AND completed;
+
+CREATE INDEX IF NOT EXISTS instance_worlds_first_idx ON instance (
+    activity_hash
+) WHERE is_worlds_first;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS instance_worlds_first_idx;
+DROP INDEX IF EXISTS instance_contest_idx;
+
+ALTER TABLE instance
+DROP COLUMN IF EXISTS is_worlds_first,
+DROP COLUMN IF EXISTS is_contest;
+-- +goose StatementEnd
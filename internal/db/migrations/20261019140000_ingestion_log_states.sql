@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE ingestion_log
+ADD COLUMN IF NOT EXISTS processor_version text;
+
+ALTER TABLE ingestion_log
+ADD CONSTRAINT ingestion_log_status_check CHECK (
+    status IN (
+        'queued',
+        'fetched',
+        'processing',
+        'success',
+        'error',
+        'skipped-non-raid',
+        'dead'
+    )
+);
+
+CREATE INDEX IF NOT EXISTS ingestion_log_status_idx ON ingestion_log (
+    status, last_attempt_at
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS ingestion_log_status_idx;
+
+ALTER TABLE ingestion_log
+DROP CONSTRAINT IF EXISTS ingestion_log_status_check;
+
+ALTER TABLE ingestion_log
+DROP COLUMN IF EXISTS processor_version;
+-- +goose StatementEnd
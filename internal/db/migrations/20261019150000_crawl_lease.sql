@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS crawl_lease (
+    range_start bigint PRIMARY KEY,
+    range_end bigint NOT NULL,
+    owner text NOT NULL,
+    status text NOT NULL DEFAULT 'leased' CHECK (status IN ('leased', 'done')),
+    leased_at timestamptz NOT NULL DEFAULT now(),
+    expires_at timestamptz NOT NULL,
+    done_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS crawl_lease_status_idx ON crawl_lease (
+    status, expires_at
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS crawl_lease;
+-- +goose StatementEnd
@@ -0,0 +1,42 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE ingestion_log
+DROP CONSTRAINT IF EXISTS ingestion_log_status_check;
+
+ALTER TABLE ingestion_log
+ADD CONSTRAINT ingestion_log_status_check CHECK (
+    status IN (
+        'queued',
+        'fetched',
+        'processing',
+        'success',
+        'error',
+        'skipped-non-raid',
+        'dead',
+        'oversized'
+    )
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+UPDATE ingestion_log
+SET status = 'queued'
+WHERE status = 'oversized';
+
+ALTER TABLE ingestion_log
+DROP CONSTRAINT IF EXISTS ingestion_log_status_check;
+
+ALTER TABLE ingestion_log
+ADD CONSTRAINT ingestion_log_status_check CHECK (
+    status IN (
+        'queued',
+        'fetched',
+        'processing',
+        'success',
+        'error',
+        'skipped-non-raid',
+        'dead'
+    )
+);
+-- +goose StatementEnd
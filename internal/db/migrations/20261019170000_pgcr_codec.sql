@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE pgcr
+ADD COLUMN IF NOT EXISTS codec smallint NOT NULL DEFAULT 1;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE pgcr
+DROP COLUMN IF EXISTS codec;
+-- +goose StatementEnd
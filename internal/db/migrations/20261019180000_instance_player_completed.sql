@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The processor never wrote instance_player.completed until clear counts were
+-- derived from it, a player completed an instance when any of their
+-- characters did
+UPDATE instance_player AS p
+SET completed = EXISTS (
+    SELECT 1
+    FROM instance_character AS c
+    WHERE
+        c.instance_id = p.instance_id
+        AND c.membership_id = p.membership_id
+        AND c.completed
+)
+WHERE p.completed IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- The backfilled values are the correct ones, there's nothing to undo
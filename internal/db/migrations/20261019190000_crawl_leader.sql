@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Roles a single crawler at a time holds, e.g. backfilling gaps
+CREATE TABLE IF NOT EXISTS crawl_leader (
+    role text PRIMARY KEY,
+    owner text NOT NULL,
+    expires_at timestamptz NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS crawl_leader;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+-- When the activity history of a player last failed to walk. Kept apart from
+-- last_crawled, which is where the next walk resumes from
+ALTER TABLE destiny_player
+ADD COLUMN IF NOT EXISTS crawl_failed_at timestamp;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE destiny_player
+DROP COLUMN IF EXISTS crawl_failed_at;
+-- +goose StatementEnd
@@ -29,6 +29,22 @@ type ActivityName struct {
 	ReleaseDate   time.Time `json:"release_date"`
 }
 
+type CrawlLease struct {
+	RangeStart int64        `json:"range_start"`
+	RangeEnd   int64        `json:"range_end"`
+	Owner      string       `json:"owner"`
+	Status     string       `json:"status"`
+	LeasedAt   time.Time    `json:"leased_at"`
+	ExpiresAt  time.Time    `json:"expires_at"`
+	DoneAt     sql.NullTime `json:"done_at"`
+}
+
+type CrawlLeader struct {
+	Role      string    `json:"role"`
+	Owner     string    `json:"owner"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
 type DestinyPlayer struct {
 	MembershipID          int64          `json:"membership_id"`
 	MembershipType        int32          `json:"membership_type"`
@@ -42,48 +58,62 @@ type DestinyPlayer struct {
 	LastCrawled           time.Time      `json:"last_crawled"`
 	LastSeen              sql.NullTime   `json:"last_seen"`
 	CreatedAt             time.Time      `json:"created_at"`
+	CrawlFailedAt         sql.NullTime   `json:"crawl_failed_at"`
 }
 
 type IngestionLog struct {
-	InstanceID    int64          `json:"instance_id"`
-	Source        string         `json:"source"`
-	Status        string         `json:"status"`
-	FirstSeenAt   time.Time      `json:"first_seen_at"`
-	LastAttemptAt time.Time      `json:"last_attempt_at"`
-	AttemptCount  int32          `json:"attempt_count"`
-	Error         sql.NullString `json:"error"`
+	InstanceID       int64          `json:"instance_id"`
+	Source           string         `json:"source"`
+	Status           string         `json:"status"`
+	FirstSeenAt      time.Time      `json:"first_seen_at"`
+	LastAttemptAt    time.Time      `json:"last_attempt_at"`
+	AttemptCount     int32          `json:"attempt_count"`
+	Error            sql.NullString `json:"error"`
+	ProcessorVersion sql.NullString `json:"processor_version"`
 }
 
 type Instance struct {
-	ID              int64     `json:"id"`
-	ActivityHash    int64     `json:"activity_hash"`
-	IsFresh         bool      `json:"is_fresh"`
-	Flawless        bool      `json:"flawless"`
-	Completed       bool      `json:"completed"`
-	PlayerCount     int32     `json:"player_count"`
-	DurationSeconds int32     `json:"duration_seconds"`
-	EndTime         time.Time `json:"end_time"`
-	StartTime       time.Time `json:"start_time"`
-	CreatedAt       time.Time `json:"created_at"`
+	ID               int64          `json:"id"`
+	ActivityHash     int64          `json:"activity_hash"`
+	IsFresh          bool           `json:"is_fresh"`
+	Flawless         bool           `json:"flawless"`
+	Completed        bool           `json:"completed"`
+	PlayerCount      int32          `json:"player_count"`
+	DurationSeconds  int32          `json:"duration_seconds"`
+	EndTime          time.Time      `json:"end_time"`
+	StartTime        time.Time      `json:"start_time"`
+	CreatedAt        time.Time      `json:"created_at"`
+	ClearType        sql.NullString `json:"clear_type"`
+	CompletionReason sql.NullInt32  `json:"completion_reason"`
+	CompletionStatus sql.NullString `json:"completion_status"`
+	IsContest        bool           `json:"is_contest"`
+	IsWorldsFirst    bool           `json:"is_worlds_first"`
 }
 
 type InstanceCharacter struct {
-	InstanceID        int64  `json:"instance_id"`
-	MembershipID      int64  `json:"membership_id"`
-	CharacterID       int64  `json:"character_id"`
-	ClassHash         int64  `json:"class_hash"`
-	EmblemHash        int64  `json:"emblem_hash"`
-	Completed         bool   `json:"completed"`
-	Kills             int32  `json:"kills"`
-	Deaths            int32  `json:"deaths"`
-	Assists           int32  `json:"assists"`
-	Kda               string `json:"kda"`
-	Kdr               string `json:"kdr"`
-	SuperKills        int32  `json:"super_kills"`
-	MeleeKills        int32  `json:"melee_kills"`
-	GrenadeKills      int32  `json:"grenade_kills"`
-	Efficiency        int32  `json:"efficiency"`
-	TimePlayedSeconds int32  `json:"time_played_seconds"`
+	InstanceID        int64          `json:"instance_id"`
+	MembershipID      int64          `json:"membership_id"`
+	CharacterID       int64          `json:"character_id"`
+	ClassHash         int64          `json:"class_hash"`
+	EmblemHash        int64          `json:"emblem_hash"`
+	Completed         bool           `json:"completed"`
+	Kills             int32          `json:"kills"`
+	Deaths            int32          `json:"deaths"`
+	Assists           int32          `json:"assists"`
+	Kda               string         `json:"kda"`
+	Kdr               string         `json:"kdr"`
+	SuperKills        int32          `json:"super_kills"`
+	MeleeKills        int32          `json:"melee_kills"`
+	GrenadeKills      int32          `json:"grenade_kills"`
+	Efficiency        string         `json:"efficiency"`
+	TimePlayedSeconds int32          `json:"time_played_seconds"`
+	Deathless         bool           `json:"deathless"`
+	Flawless          bool           `json:"flawless"`
+	CharacterClass    sql.NullString `json:"character_class"`
+	LightLevel        int32          `json:"light_level"`
+	PrecisionKills    int32          `json:"precision_kills"`
+	ClassAbilityKills int32          `json:"class_ability_kills"`
+	StartSeconds      int32          `json:"start_seconds"`
 }
 
 type InstanceCharacterWeapon struct {
@@ -102,12 +132,15 @@ type InstancePlayer struct {
 	Completed         sql.NullBool `json:"completed"`
 	TimePlayedSeconds int32        `json:"time_played_seconds"`
 	CreatedAt         time.Time    `json:"created_at"`
+	Deathless         bool         `json:"deathless"`
+	Flawless          bool         `json:"flawless"`
 }
 
 type Pgcr struct {
 	InstanceID int64     `json:"instance_id"`
 	Blob       []byte    `json:"blob"`
 	CreatedAt  time.Time `json:"created_at"`
+	Codec      int16     `json:"codec"`
 }
 
 type Weapon struct {
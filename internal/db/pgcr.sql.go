@@ -12,20 +12,83 @@ import (
 const createPgcr = `-- name: CreatePgcr :exec
 INSERT INTO pgcr (
     instance_id,
-    blob
+    blob,
+    codec
 )
 VALUES (
     $1,
-    $2
+    $2,
+    $3
 )
 `
 
 type CreatePgcrParams struct {
 	InstanceID int64  `json:"instance_id"`
 	Blob       []byte `json:"blob"`
+	Codec      int16  `json:"codec"`
 }
 
 func (q *Queries) CreatePgcr(ctx context.Context, arg CreatePgcrParams) error {
-	_, err := q.exec(ctx, q.createPgcrStmt, createPgcr, arg.InstanceID, arg.Blob)
+	_, err := q.exec(ctx, q.createPgcrStmt, createPgcr, arg.InstanceID, arg.Blob, arg.Codec)
 	return err
 }
+
+const listPgcrBlobs = `-- name: ListPgcrBlobs :many
+SELECT p.instance_id, p.blob, p.codec
+FROM pgcr AS p
+INNER JOIN instance AS i ON p.instance_id = i.id
+INNER JOIN activity AS a ON i.activity_hash = a.activity_hash
+INNER JOIN activity_name AS an ON a.name_id = an.id
+LEFT JOIN ingestion_log AS l ON p.instance_id = l.instance_id
+WHERE
+    p.instance_id > $1::bigint
+    AND ($2::bigint = 0 OR p.instance_id <= $2::bigint)
+    AND ($3::text = '' OR an.activity_label = $3::text)
+    AND ($4::text = '' OR l.status = $4::text)
+ORDER BY p.instance_id
+LIMIT $5
+`
+
+type ListPgcrBlobsParams struct {
+	AfterID   int64  `json:"after_id"`
+	ToID      int64  `json:"to_id"`
+	Raid      string `json:"raid"`
+	Status    string `json:"status"`
+	BatchSize int32  `json:"batch_size"`
+}
+
+type ListPgcrBlobsRow struct {
+	InstanceID int64  `json:"instance_id"`
+	Blob       []byte `json:"blob"`
+	Codec      int16  `json:"codec"`
+}
+
+// Pages through stored raw pgcrs in instance id order. Empty filters are ignored
+func (q *Queries) ListPgcrBlobs(ctx context.Context, arg ListPgcrBlobsParams) ([]ListPgcrBlobsRow, error) {
+	rows, err := q.query(ctx, q.listPgcrBlobsStmt, listPgcrBlobs,
+		arg.AfterID,
+		arg.ToID,
+		arg.Raid,
+		arg.Status,
+		arg.BatchSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListPgcrBlobsRow{}
+	for rows.Next() {
+		var i ListPgcrBlobsRow
+		if err := rows.Scan(&i.InstanceID, &i.Blob, &i.Codec); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
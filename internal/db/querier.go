@@ -9,16 +9,99 @@ import (
 )
 
 type Querier interface {
+	// Takes over the lowest range whose crawler stopped renewing its lease
+	ClaimExpiredLease(ctx context.Context, arg ClaimExpiredLeaseParams) (CrawlLease, error)
+	// Takes the role when nobody holds it or its holder stopped renewing it,
+	// renews it when owner already holds it. Affects no rows otherwise
+	ClaimLeadership(ctx context.Context, arg ClaimLeadershipParams) (int64, error)
+	// Moves an instance to processing for the calling processor. Returns no rows
+	// when the instance is terminal or parked. The claim is committed along with
+	// the outcome of the processing, so a processing entry seen here was left
+	// behind by a processor from before the ledger was transactional
+	ClaimLogEntry(ctx context.Context, arg ClaimLogEntryParams) (IngestionLog, error)
+	CompleteLease(ctx context.Context, arg CompleteLeaseParams) (int64, error)
+	// Entries per range of bucket_size ids starting at from_id. Seen entries made
+	// it past queued, handled ones need no further crawling
+	CountLogCoverage(ctx context.Context, arg CountLogCoverageParams) ([]CountLogCoverageRow, error)
+	CountLogEntriesByStatus(ctx context.Context) ([]CountLogEntriesByStatusRow, error)
+	// Successful entries by the processor version that last built them
+	CountLogEntriesByVersion(ctx context.Context) ([]CountLogEntriesByVersionRow, error)
+	// The most common failures of instances that are still failing
+	CountLogErrors(ctx context.Context, limit int32) ([]CountLogErrorsRow, error)
 	CreateDestinyPlayer(ctx context.Context, arg CreateDestinyPlayerParams) (DestinyPlayer, error)
 	CreateInstance(ctx context.Context, arg CreateInstanceParams) error
 	CreateInstanceCharacter(ctx context.Context, arg CreateInstanceCharacterParams) error
 	CreateInstanceCharacterWeapon(ctx context.Context, arg CreateInstanceCharacterWeaponParams) error
 	CreateInstancePlayer(ctx context.Context, arg CreateInstancePlayerParams) error
+	// Leases the range right after the highest one handed out so far. Returns no
+	// rows when another crawler took the same range first
+	CreateNextLease(ctx context.Context, arg CreateNextLeaseParams) (CrawlLease, error)
 	CreatePgcr(ctx context.Context, arg CreatePgcrParams) error
+	CreateQueuedLogEntry(ctx context.Context, arg CreateQueuedLogEntryParams) error
 	CreateWeapon(ctx context.Context, arg CreateWeaponParams) error
-	IncrementPlayerCounts(ctx context.Context, arg IncrementPlayerCountsParams) error
+	DeleteInstanceCharacterWeapons(ctx context.Context, instanceID int64) error
+	DeleteInstanceCharacters(ctx context.Context, instanceID int64) error
+	DeleteInstancePlayers(ctx context.Context, instanceID int64) error
+	// Records a failed attempt outside of the rolled back processing transaction.
+	// The instance is dead once the failure is permanent or it ran out of attempts
+	FailLogEntry(ctx context.Context, arg FailLogEntryParams) (string, error)
+	GetDestinyPlayer(ctx context.Context, membershipID int64) (DestinyPlayer, error)
+	GetInstance(ctx context.Context, id int64) (Instance, error)
+	GetLogEntry(ctx context.Context, instanceID int64) (IngestionLog, error)
+	// Instances within the range that don't need to be crawled again
+	ListHandledInstanceIds(ctx context.Context, arg ListHandledInstanceIdsParams) ([]int64, error)
+	ListInstanceCharacterWeapons(ctx context.Context, instanceID int64) ([]InstanceCharacterWeapon, error)
+	ListInstanceCharacters(ctx context.Context, instanceID int64) ([]InstanceCharacter, error)
+	ListInstancePlayers(ctx context.Context, instanceID int64) ([]InstancePlayer, error)
+	// Empty filters are ignored
+	ListLogEntries(ctx context.Context, arg ListLogEntriesParams) ([]IngestionLog, error)
+	// Ranges of ids within the window the crawler never got past queued, either
+	// because they have no entry at all or their entry is stuck in queued
+	// Ranges overlapping a lease still being crawled aren't gaps yet
+	ListLogGaps(ctx context.Context, arg ListLogGapsParams) ([]ListLogGapsRow, error)
+	// Pages through stored raw pgcrs in instance id order. Empty filters are ignored
+	ListPgcrBlobs(ctx context.Context, arg ListPgcrBlobsParams) ([]ListPgcrBlobsRow, error)
+	// Players whose stored clear counts don't match the instances they're recorded in
+	ListPlayerCountDrift(ctx context.Context) ([]ListPlayerCountDriftRow, error)
+	// Players whose activity history wasn't walked recently, least recent first.
+	// Players known to be private or whose last walk failed recently are left out
+	ListPlayersToCrawl(ctx context.Context, arg ListPlayersToCrawlParams) ([]DestinyPlayer, error)
+	// Serializes the World's First of a raid until the transaction ends. Under read
+	// committed, MarkWorldsFirst only sees the clears other processors committed
+	// before it started, two of them racing would each flag their own instance
+	LockRaidWorldsFirst(ctx context.Context, activityHash int64) error
+	// Only moves entries forward, a processor may already have claimed the instance
+	MarkLogEntryFetched(ctx context.Context, instanceID int64) error
+	// Parks an instance whose pgcr is over the crawler's size limit until it's
+	// requeued with a higher one. Entries the crawler didn't queue are left alone
+	MarkLogEntryOversized(ctx context.Context, arg MarkLogEntryOversizedParams) error
+	// Records a successful reprocess with the version that rebuilt the instance.
+	// Instances stored before the ledger existed get an entry under the given source
+	MarkLogEntryReprocessed(ctx context.Context, arg MarkLogEntryReprocessedParams) error
+	// Leaves last_crawled alone so the next walk still covers what this one missed
+	MarkPlayerCrawlFailed(ctx context.Context, membershipID int64) error
+	MarkPlayerCrawled(ctx context.Context, membershipID int64) error
+	// Recording a pgcr of the player sets is_public again
+	MarkPlayerPrivate(ctx context.Context, membershipID int64) error
+	// Moves the World's First flag of the raid that the given activity hash
+	// belongs to onto its earliest completed contest instance. Only the rows whose
+	// flag changes are written, none unless a clear beats the current first.
+	// Unlike the seeded activity.is_worlds_first, which flags the activity hash a
+	// race was run on, this flags the single clear that won it
+	MarkWorldsFirst(ctx context.Context, activityHash int64) error
+	// Queues an instance for another crawl. Successfully processed instances are
+	// left untouched, they can only be rebuilt from their stored pgcr
+	QueueLogEntry(ctx context.Context, arg QueueLogEntryParams) (int64, error)
+	// Derives the clear counts of a player from the instances they're recorded in
+	RecomputePlayerCounts(ctx context.Context, membershipID int64) error
+	// Records an instance that was handled without being claimed, e.g. skipped
+	// non raid activities. Successfully processed instances are left untouched
+	RecordLogEntry(ctx context.Context, arg RecordLogEntryParams) error
+	RenewLease(ctx context.Context, arg RenewLeaseParams) (int64, error)
+	// Moves matching entries back to queued with a fresh attempt budget
+	ResetLogEntries(ctx context.Context, arg ResetLogEntriesParams) (int64, error)
+	UpdateInstance(ctx context.Context, arg UpdateInstanceParams) error
 	UpdateLogEntryStatus(ctx context.Context, arg UpdateLogEntryStatusParams) error
-	UpsertLogEntry(ctx context.Context, arg UpsertLogEntryParams) (IngestionLog, error)
 }
 
 var _ Querier = (*Queries)(nil)
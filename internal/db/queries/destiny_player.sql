@@ -32,13 +32,80 @@ DO UPDATE
         global_display_name_code = excluded.global_display_name_code,
         icon_path = excluded.icon_path,
         is_public = excluded.is_public,
-        last_seen = now(),
-        last_crawled = now()
+        last_seen = now()
 RETURNING *;
 
--- name: IncrementPlayerCounts :exec
-UPDATE destiny_player
+-- name: RecomputePlayerCounts :exec
+-- Derives the clear counts of a player from the instances they're recorded in
+UPDATE destiny_player AS dp
 SET
-    total_clears = total_clears + CASE WHEN $2::boolean THEN 1 ELSE 0 END,
-    total_full_clears = total_full_clears + CASE WHEN $3::boolean THEN 1 ELSE 0 END
+    total_clears = (
+        SELECT count(*)
+        FROM instance_player AS ip
+        WHERE ip.membership_id = dp.membership_id AND ip.completed
+    ),
+    total_full_clears = (
+        SELECT count(*)
+        FROM instance_player AS ip
+        INNER JOIN instance AS i ON ip.instance_id = i.id
+        WHERE ip.membership_id = dp.membership_id AND ip.completed AND i.is_fresh
+    )
+WHERE dp.membership_id = $1;
+
+-- name: ListPlayerCountDrift :many
+-- Players whose stored clear counts don't match the instances they're recorded in
+SELECT
+    dp.membership_id,
+    dp.total_clears,
+    dp.total_full_clears,
+    coalesce(c.clears, 0)::int AS expected_clears,
+    coalesce(c.full_clears, 0)::int AS expected_full_clears
+FROM destiny_player AS dp
+LEFT JOIN (
+    SELECT
+        ip.membership_id,
+        count(*) FILTER (WHERE ip.completed) AS clears,
+        count(*) FILTER (WHERE ip.completed AND i.is_fresh) AS full_clears
+    FROM instance_player AS ip
+    INNER JOIN instance AS i ON ip.instance_id = i.id
+    GROUP BY ip.membership_id
+) AS c ON dp.membership_id = c.membership_id
+WHERE
+    dp.total_clears != coalesce(c.clears, 0)
+    OR dp.total_full_clears != coalesce(c.full_clears, 0)
+ORDER BY dp.membership_id;
+
+-- name: GetDestinyPlayer :one
+SELECT * FROM destiny_player
+WHERE membership_id = $1;
+
+-- name: ListPlayersToCrawl :many
+-- Players whose activity history wasn't walked recently, least recent first.
+-- Players known to be private or whose last walk failed recently are left out
+SELECT * FROM destiny_player
+WHERE
+    last_crawled < now() - make_interval(secs => sqlc.arg(min_age_seconds)::int)
+    AND is_public IS DISTINCT FROM false
+    AND (
+        crawl_failed_at IS NULL
+        OR crawl_failed_at < now() - make_interval(secs => sqlc.arg(min_age_seconds)::int)
+    )
+ORDER BY last_crawled
+LIMIT sqlc.arg(max_rows)::int;
+
+-- name: MarkPlayerCrawled :exec
+UPDATE destiny_player
+SET last_crawled = now(), crawl_failed_at = NULL
+WHERE membership_id = $1;
+
+-- name: MarkPlayerCrawlFailed :exec
+-- Leaves last_crawled alone so the next walk still covers what this one missed
+UPDATE destiny_player
+SET crawl_failed_at = now()
+WHERE membership_id = $1;
+
+-- name: MarkPlayerPrivate :exec
+-- Recording a pgcr of the player sets is_public again
+UPDATE destiny_player
+SET is_public = false
 WHERE membership_id = $1;
@@ -8,7 +8,73 @@ INSERT INTO instance (
     player_count,
     duration_seconds,
     end_time,
-    start_time
+    start_time,
+    clear_type,
+    completion_reason,
+    completion_status,
+    is_contest
 ) VALUES (
-    $1, $2, $3, $4, $5, $6, $7, $8, $9
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13
 );
+
+-- name: LockRaidWorldsFirst :exec
+-- Serializes the World's First of a raid until the transaction ends. Under read
+-- committed, MarkWorldsFirst only sees the clears other processors committed
+-- before it started, two of them racing would each flag their own instance
+SELECT pg_advisory_xact_lock(hashtext('worlds_first'), activity.name_id::int)
+FROM activity
+WHERE activity.activity_hash = $1;
+
+-- name: MarkWorldsFirst :exec
+-- Moves the World's First flag of the raid that the given activity hash
+-- belongs to onto its earliest completed contest instance. Only the rows whose
+-- flag changes are written, none unless a clear beats the current first.
+-- Unlike the seeded activity.is_worlds_first, which flags the activity hash a
+-- race was run on, this flags the single clear that won it
+WITH raid AS (
+    SELECT activity_hash
+    FROM activity
+    WHERE name_id = (
+        SELECT name_id FROM activity WHERE activity.activity_hash = $1
+    )
+),
+
+worlds_first AS (
+    SELECT f.id
+    FROM instance AS f
+    WHERE
+        f.activity_hash IN (SELECT activity_hash FROM raid)
+        AND f.is_contest
+        AND f.completed
+    ORDER BY f.end_time ASC, f.id ASC
+    LIMIT 1
+)
+
+UPDATE instance
+SET is_worlds_first = coalesce(instance.id = (SELECT id FROM worlds_first), false)
+WHERE
+    instance.activity_hash IN (SELECT activity_hash FROM raid)
+    AND (instance.is_worlds_first OR instance.id = (SELECT id FROM worlds_first))
+    AND instance.is_worlds_first
+    != coalesce(instance.id = (SELECT id FROM worlds_first), false);
+
+-- name: GetInstance :one
+SELECT * FROM instance
+WHERE id = $1;
+
+-- name: UpdateInstance :exec
+UPDATE instance
+SET
+    activity_hash = $2,
+    is_fresh = $3,
+    flawless = $4,
+    completed = $5,
+    player_count = $6,
+    duration_seconds = $7,
+    end_time = $8,
+    start_time = $9,
+    clear_type = $10,
+    completion_reason = $11,
+    completion_status = $12,
+    is_contest = $13
+WHERE id = $1;
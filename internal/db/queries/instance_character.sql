@@ -15,7 +15,14 @@ INSERT INTO instance_character (
     melee_kills,
     grenade_kills,
     efficiency,
-    time_played_seconds
+    time_played_seconds,
+    deathless,
+    flawless,
+    character_class,
+    light_level,
+    precision_kills,
+    class_ability_kills,
+    start_seconds
 )
 VALUES (
     $1,
@@ -33,7 +40,23 @@ VALUES (
     $13,
     $14,
     $15,
-    $16
+    $16,
+    $17,
+    $18,
+    $19,
+    $20,
+    $21,
+    $22,
+    $23
 )
 ON CONFLICT (instance_id, membership_id, character_id) DO NOTHING
 RETURNING instance_id;
+
+-- name: ListInstanceCharacters :many
+SELECT * FROM instance_character
+WHERE instance_id = $1
+ORDER BY membership_id, character_id;
+
+-- name: DeleteInstanceCharacters :exec
+DELETE FROM instance_character
+WHERE instance_id = $1;
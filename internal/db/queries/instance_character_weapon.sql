@@ -19,3 +19,12 @@ VALUES (
 )
 ON CONFLICT DO NOTHING
 RETURNING instance_id;
+
+-- name: ListInstanceCharacterWeapons :many
+SELECT * FROM instance_character_weapon
+WHERE instance_id = $1
+ORDER BY player_membership_id, player_character_id, weapon_id;
+
+-- name: DeleteInstanceCharacterWeapons :exec
+DELETE FROM instance_character_weapon
+WHERE instance_id = $1;
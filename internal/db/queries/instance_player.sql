@@ -3,10 +3,23 @@ INSERT INTO instance_player (
     instance_id,
     membership_id,
     completed,
-    time_played_seconds
+    time_played_seconds,
+    deathless,
+    flawless
 ) VALUES (
     $1,
     $2,
     $3,
-    $4
+    $4,
+    $5,
+    $6
 ) ON CONFLICT (instance_id, membership_id) DO NOTHING;
+
+-- name: ListInstancePlayers :many
+SELECT * FROM instance_player
+WHERE instance_id = $1
+ORDER BY membership_id;
+
+-- name: DeleteInstancePlayers :exec
+DELETE FROM instance_player
+WHERE instance_id = $1;
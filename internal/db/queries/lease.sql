@@ -0,0 +1,64 @@
+-- name: ClaimExpiredLease :one
+-- Takes over the lowest range whose crawler stopped renewing its lease
+UPDATE crawl_lease
+SET
+    owner = sqlc.arg(owner)::text,
+    leased_at = now(),
+    expires_at = now() + make_interval(secs => sqlc.arg(ttl_seconds)::int)
+WHERE
+    range_start = (
+        SELECT range_start FROM crawl_lease
+        WHERE status = 'leased' AND expires_at < now()
+        ORDER BY range_start
+        LIMIT 1
+        FOR UPDATE SKIP LOCKED
+    )
+    AND status = 'leased'
+    AND expires_at < now()
+RETURNING *;
+
+-- name: CreateNextLease :one
+-- Leases the range right after the highest one handed out so far. Returns no
+-- rows when another crawler took the same range first
+INSERT INTO crawl_lease (range_start, range_end, owner, expires_at)
+SELECT
+    next_start,
+    next_start + sqlc.arg(size)::bigint - 1,
+    sqlc.arg(owner)::text,
+    now() + make_interval(secs => sqlc.arg(ttl_seconds)::int)
+FROM (
+    SELECT coalesce(max(range_end) + 1, sqlc.arg(first_id)::bigint) AS next_start
+    FROM crawl_lease
+) AS n
+ON CONFLICT (range_start) DO NOTHING
+RETURNING *;
+
+-- name: RenewLease :execrows
+UPDATE crawl_lease
+SET expires_at = now() + make_interval(secs => sqlc.arg(ttl_seconds)::int)
+WHERE
+    range_start = sqlc.arg(range_start)
+    AND owner = sqlc.arg(owner)
+    AND status = 'leased';
+
+-- name: CompleteLease :execrows
+UPDATE crawl_lease
+SET
+    status = 'done',
+    done_at = now()
+WHERE range_start = $1 AND owner = $2 AND status = 'leased';
+
+-- name: ClaimLeadership :execrows
+-- Takes the role when nobody holds it or its holder stopped renewing it,
+-- renews it when owner already holds it. Affects no rows otherwise
+INSERT INTO crawl_leader (role, owner, expires_at)
+VALUES (
+    sqlc.arg(role)::text,
+    sqlc.arg(owner)::text,
+    now() + make_interval(secs => sqlc.arg(ttl_seconds)::int)
+)
+ON CONFLICT (role) DO UPDATE
+SET
+    owner = excluded.owner,
+    expires_at = excluded.expires_at
+WHERE crawl_leader.owner = excluded.owner OR crawl_leader.expires_at < now();
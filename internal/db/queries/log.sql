@@ -1,12 +1,29 @@
--- name: UpsertLogEntry :one
-INSERT INTO ingestion_log (instance_id, source, status)
-VALUES ($1, $2, $3)
+-- name: ClaimLogEntry :one
+-- Moves an instance to processing for the calling processor. Returns no rows
+-- when the instance is terminal or parked. The claim is committed along with
+-- the outcome of the processing, so a processing entry seen here was left
+-- behind by a processor from before the ledger was transactional
+INSERT INTO ingestion_log (instance_id, source, status, processor_version)
+VALUES (
+    sqlc.arg(instance_id),
+    sqlc.arg(source),
+    'processing',
+    sqlc.arg(processor_version)
+)
 ON CONFLICT (instance_id) DO UPDATE
     SET
+        status = 'processing',
         last_attempt_at = now(),
-        attempt_count = ingestion_log.attempt_count + 1
+        attempt_count = ingestion_log.attempt_count + 1,
+        processor_version = excluded.processor_version,
+        error = NULL
+    WHERE ingestion_log.status IN ('queued', 'fetched', 'error', 'processing')
 RETURNING *;
 
+-- name: GetLogEntry :one
+SELECT * FROM ingestion_log
+WHERE instance_id = $1;
+
 -- name: UpdateLogEntryStatus :exec
 UPDATE ingestion_log
 SET
@@ -14,3 +31,230 @@ SET
     last_attempt_at = now(),
     error = $3
 WHERE instance_id = $1;
+
+-- name: RecordLogEntry :exec
+-- Records an instance that was handled without being claimed, e.g. skipped
+-- non raid activities. Successfully processed instances are left untouched
+INSERT INTO ingestion_log (instance_id, source, status, processor_version)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (instance_id) DO UPDATE
+    SET
+        status = excluded.status,
+        last_attempt_at = now(),
+        attempt_count = ingestion_log.attempt_count + 1,
+        processor_version = excluded.processor_version,
+        error = NULL
+    WHERE ingestion_log.status != 'success';
+
+-- name: FailLogEntry :one
+-- Records a failed attempt outside of the rolled back processing transaction.
+-- The instance is dead once the failure is permanent or it ran out of attempts
+INSERT INTO ingestion_log (
+    instance_id, source, status, error, processor_version
+)
+VALUES (
+    sqlc.arg(instance_id),
+    sqlc.arg(source),
+    CASE WHEN sqlc.arg(permanent)::boolean THEN 'dead' ELSE 'error' END,
+    sqlc.arg(error),
+    sqlc.arg(processor_version)
+)
+ON CONFLICT (instance_id) DO UPDATE
+    SET
+        status = CASE
+            WHEN
+                sqlc.arg(permanent)::boolean
+                OR ingestion_log.attempt_count + 1 >= sqlc.arg(max_attempts)::int
+                THEN 'dead'
+            ELSE 'error'
+        END,
+        last_attempt_at = now(),
+        attempt_count = ingestion_log.attempt_count + 1,
+        processor_version = excluded.processor_version,
+        error = excluded.error
+    WHERE ingestion_log.status NOT IN ('success', 'skipped-non-raid')
+RETURNING status;
+
+-- name: ListLogEntries :many
+-- Empty filters are ignored
+SELECT * FROM ingestion_log
+WHERE
+    (sqlc.arg(status)::text = '' OR status = sqlc.arg(status)::text)
+    AND (sqlc.arg(source)::text = '' OR source = sqlc.arg(source)::text)
+    AND (
+        sqlc.arg(error_contains)::text = ''
+        OR error ILIKE '%' || sqlc.arg(error_contains)::text || '%'
+    )
+    AND last_attempt_at
+    <= now() - make_interval(secs => sqlc.arg(older_than_seconds)::int)
+    AND (
+        sqlc.arg(processor_version)::text = ''
+        OR processor_version = sqlc.arg(processor_version)::text
+    )
+ORDER BY last_attempt_at
+LIMIT sqlc.arg(max_rows);
+
+-- name: ResetLogEntries :execrows
+-- Moves matching entries back to queued with a fresh attempt budget
+UPDATE ingestion_log
+SET
+    status = 'queued',
+    attempt_count = 0,
+    last_attempt_at = now(),
+    error = NULL
+WHERE
+    status = sqlc.arg(status)::text
+    AND (sqlc.arg(source)::text = '' OR source = sqlc.arg(source)::text)
+    AND (
+        sqlc.arg(error_contains)::text = ''
+        OR error ILIKE '%' || sqlc.arg(error_contains)::text || '%'
+    )
+    AND last_attempt_at
+    <= now() - make_interval(secs => sqlc.arg(older_than_seconds)::int);
+
+-- name: QueueLogEntry :execrows
+-- Queues an instance for another crawl. Successfully processed instances are
+-- left untouched, they can only be rebuilt from their stored pgcr
+INSERT INTO ingestion_log (instance_id, source, status, attempt_count)
+VALUES ($1, $2, 'queued', 0)
+ON CONFLICT (instance_id) DO UPDATE
+    SET
+        status = 'queued',
+        attempt_count = 0,
+        last_attempt_at = now(),
+        error = NULL
+    WHERE ingestion_log.status != 'success';
+
+-- name: CountLogEntriesByStatus :many
+SELECT status, count(*) AS entries
+FROM ingestion_log
+GROUP BY status
+ORDER BY status;
+
+-- name: CountLogEntriesByVersion :many
+-- Successful entries by the processor version that last built them
+SELECT coalesce(processor_version, '')::text AS processor_version, count(*) AS entries
+FROM ingestion_log
+WHERE status = 'success'
+GROUP BY processor_version
+ORDER BY entries DESC;
+
+-- name: CountLogErrors :many
+-- The most common failures of instances that are still failing
+SELECT status, error, count(*) AS entries
+FROM ingestion_log
+WHERE status IN ('error', 'dead')
+GROUP BY status, error
+ORDER BY entries DESC
+LIMIT $1;
+
+-- name: ListHandledInstanceIds :many
+-- Instances within the range that don't need to be crawled again
+SELECT instance_id FROM ingestion_log
+WHERE
+    instance_id BETWEEN sqlc.arg(from_id)::bigint AND sqlc.arg(to_id)::bigint
+    AND status IN ('success', 'skipped-non-raid', 'dead', 'oversized')
+ORDER BY instance_id;
+
+-- name: CreateQueuedLogEntry :exec
+INSERT INTO ingestion_log (instance_id, source, status, attempt_count)
+VALUES ($1, $2, 'queued', 0)
+ON CONFLICT (instance_id) DO NOTHING;
+
+-- name: MarkLogEntryFetched :exec
+-- Only moves entries forward, a processor may already have claimed the instance
+UPDATE ingestion_log
+SET
+    status = 'fetched',
+    last_attempt_at = now()
+WHERE instance_id = $1 AND status = 'queued';
+
+-- name: MarkLogEntryOversized :exec
+-- Parks an instance whose pgcr is over the crawler's size limit until it's
+-- requeued with a higher one. Entries the crawler didn't queue are left alone
+INSERT INTO ingestion_log (instance_id, source, status, error)
+VALUES ($1, $2, 'oversized', $3)
+ON CONFLICT (instance_id) DO UPDATE
+    SET
+        status = 'oversized',
+        last_attempt_at = now(),
+        error = excluded.error
+    WHERE ingestion_log.status = 'queued';
+
+-- name: MarkLogEntryReprocessed :exec
+-- Records a successful reprocess with the version that rebuilt the instance.
+-- Instances stored before the ledger existed get an entry under the given source
+INSERT INTO ingestion_log (instance_id, source, status, processor_version)
+VALUES (
+    sqlc.arg(instance_id),
+    sqlc.arg(source),
+    'success',
+    sqlc.arg(processor_version)
+)
+ON CONFLICT (instance_id) DO UPDATE
+    SET
+        status = 'success',
+        last_attempt_at = now(),
+        processor_version = excluded.processor_version,
+        error = NULL;
+
+-- name: ListLogGaps :many
+-- Ranges of ids within the window the crawler never got past queued, either
+-- because they have no entry at all or their entry is stuck in queued
+-- Ranges overlapping a lease still being crawled aren't gaps yet
+WITH seen AS (
+    SELECT instance_id FROM ingestion_log
+    WHERE
+        instance_id BETWEEN sqlc.arg(from_id)::bigint AND sqlc.arg(to_id)::bigint
+        AND (
+            status != 'queued'
+            OR last_attempt_at
+            > now() - make_interval(secs => sqlc.arg(stale_seconds)::int)
+        )
+    UNION ALL
+    SELECT sqlc.arg(from_id)::bigint - 1
+    UNION ALL
+    SELECT sqlc.arg(to_id)::bigint + 1
+),
+
+bounds AS (
+    SELECT
+        instance_id,
+        lead(instance_id) OVER (ORDER BY instance_id) AS next_id
+    FROM seen
+)
+
+SELECT
+    (instance_id + 1)::bigint AS gap_start,
+    (next_id - 1)::bigint AS gap_end
+FROM bounds
+WHERE
+    next_id > instance_id + 1
+    AND NOT EXISTS (
+        SELECT 1 FROM crawl_lease AS cl
+        WHERE
+            cl.status = 'leased'
+            AND cl.range_start <= bounds.next_id - 1
+            AND cl.range_end >= bounds.instance_id + 1
+    )
+ORDER BY gap_start
+LIMIT sqlc.arg(max_gaps)::int;
+
+-- name: CountLogCoverage :many
+-- Entries per range of bucket_size ids starting at from_id. Seen entries made
+-- it past queued, handled ones need no further crawling
+SELECT
+    (
+        sqlc.arg(from_id)::bigint
+        + (instance_id - sqlc.arg(from_id)::bigint)
+        / sqlc.arg(bucket_size)::bigint
+        * sqlc.arg(bucket_size)::bigint
+    )::bigint AS range_start,
+    count(*) FILTER (WHERE status != 'queued') AS seen,
+    count(*) FILTER (
+        WHERE status IN ('success', 'skipped-non-raid', 'dead', 'oversized')
+    ) AS handled
+FROM ingestion_log
+WHERE instance_id BETWEEN sqlc.arg(from_id)::bigint AND sqlc.arg(to_id)::bigint
+GROUP BY range_start
+ORDER BY range_start;
@@ -1,9 +1,27 @@
 -- name: CreatePgcr :exec
 INSERT INTO pgcr (
     instance_id,
-    blob
+    blob,
+    codec
 )
 VALUES (
     $1,
-    $2
+    $2,
+    $3
 );
+
+-- name: ListPgcrBlobs :many
+-- Pages through stored raw pgcrs in instance id order. Empty filters are ignored
+SELECT p.instance_id, p.blob, p.codec
+FROM pgcr AS p
+INNER JOIN instance AS i ON p.instance_id = i.id
+INNER JOIN activity AS a ON i.activity_hash = a.activity_hash
+INNER JOIN activity_name AS an ON a.name_id = an.id
+LEFT JOIN ingestion_log AS l ON p.instance_id = l.instance_id
+WHERE
+    p.instance_id > sqlc.arg(after_id)::bigint
+    AND (sqlc.arg(to_id)::bigint = 0 OR p.instance_id <= sqlc.arg(to_id)::bigint)
+    AND (sqlc.arg(raid)::text = '' OR an.activity_label = sqlc.arg(raid)::text)
+    AND (sqlc.arg(status)::text = '' OR l.status = sqlc.arg(status)::text)
+ORDER BY p.instance_id
+LIMIT sqlc.arg(batch_size);
@@ -0,0 +1,61 @@
+package mapper
+
+import (
+	"pgcr-processing-service/internal/types/pgcr"
+)
+
+// Players that never finished and spent less than this in the activity are
+// not counted towards the team, e.g., someone who loaded in and got kicked
+const participationThresholdSeconds = 60
+
+// Returns the players that count towards the size of the team that cleared
+// the raid. Players who left early still count as long as they actually
+// played, as do players who joined from a later checkpoint
+func participants(players []pgcr.PlayerInfo) []pgcr.PlayerInfo {
+	result := []pgcr.PlayerInfo{}
+	for _, p := range players {
+		if p.Completed || p.TimePlayedSeconds >= participationThresholdSeconds {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// Classifies a raid clear as a lowman based on the players that participated
+// in it. Only completed instances are classified and flawless variants also
+// require the raid to be started from the beginning.
+// An empty ClearType is returned for anything that is not a lowman
+func classifyClear(players []pgcr.PlayerInfo, fresh, flawless bool) pgcr.ClearType {
+	completed := false
+	for _, p := range players {
+		if p.Completed {
+			completed = true
+			break
+		}
+	}
+
+	if !completed {
+		return ""
+	}
+
+	flawless = flawless && fresh
+	switch len(participants(players)) {
+	case 1:
+		if flawless {
+			return pgcr.SOLO_FLAWLESS
+		}
+		return pgcr.SOLO
+	case 2:
+		if flawless {
+			return pgcr.DUO_FLAWLESS
+		}
+		return pgcr.DUO
+	case 3:
+		if flawless {
+			return pgcr.TRIO_FLAWLESS
+		}
+		return pgcr.TRIO
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,41 @@
+package mapper
+
+import (
+	"pgcr-processing-service/internal/types/pgcr"
+)
+
+// Value of the completionReason stat Bungie reports for failed activities
+const reasonFailed = 2
+
+// Resolves whether an instance was finished, wiped or abandoned.
+// An instance is finished as soon as a single character completed it.
+// Otherwise it is a wipe when Bungie reports the activity as failed and
+// abandoned in any other case, e.g., everyone left before the end.
+// The reason is taken from a finishing character when there is one since
+// players who left early may report a different one. It is nil when Bungie
+// didn't report one, its zero value would read as objective completed
+func resolveCompletion(entries []pgcr.StatsEntry) (bool, *int, pgcr.CompletionStatus) {
+	if len(entries) == 0 {
+		return false, nil, pgcr.ABANDONED
+	}
+
+	for _, e := range entries {
+		if e.Values.Completed.Value == 1.0 {
+			return true, completionReason(e), pgcr.FINISHED
+		}
+	}
+
+	reason := completionReason(entries[0])
+	if reason != nil && *reason == reasonFailed {
+		return false, reason, pgcr.WIPED
+	}
+	return false, reason, pgcr.ABANDONED
+}
+
+func completionReason(entry pgcr.StatsEntry) *int {
+	if entry.Values.CompletionReason == nil {
+		return nil
+	}
+	reason := int(entry.Values.CompletionReason.Value)
+	return &reason
+}
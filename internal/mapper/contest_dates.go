@@ -0,0 +1,67 @@
+package mapper
+
+import (
+	"time"
+
+	"pgcr-processing-service/internal/types/pgcr"
+)
+
+type contestWindow struct {
+	start time.Time
+	end   time.Time
+}
+
+// Contest mode windows for every raid that launched with one, starting at the
+// raid's launch and lasting until contest mode was lifted
+var contestWindows = map[pgcr.RaidName]contestWindow{
+	pgcr.GARDEN_OF_SALVATION: {
+		start: time.Date(2019, time.October, 5, 10, 0, 0, 0, time.FixedZone("PDT", -7*60*60)),
+		end:   time.Date(2019, time.October, 6, 10, 0, 0, 0, time.FixedZone("PDT", -7*60*60)),
+	},
+	pgcr.DEEP_STONE_CRYPT: {
+		start: time.Date(2020, time.November, 21, 10, 0, 0, 0, time.FixedZone("PST", -8*60*60)),
+		end:   time.Date(2020, time.November, 22, 10, 0, 0, 0, time.FixedZone("PST", -8*60*60)),
+	},
+	pgcr.VAULT_OF_GLASS: {
+		start: time.Date(2021, time.May, 22, 10, 0, 0, 0, time.FixedZone("PDT", -7*60*60)),
+		end:   time.Date(2021, time.May, 23, 10, 0, 0, 0, time.FixedZone("PDT", -7*60*60)),
+	},
+	pgcr.VOW_OF_THE_DISCIPLE: {
+		start: time.Date(2022, time.March, 5, 10, 0, 0, 0, time.FixedZone("PST", -8*60*60)),
+		end:   time.Date(2022, time.March, 7, 10, 0, 0, 0, time.FixedZone("PST", -8*60*60)),
+	},
+	pgcr.KINGS_FALL: {
+		start: time.Date(2022, time.August, 26, 10, 0, 0, 0, time.FixedZone("PDT", -7*60*60)),
+		end:   time.Date(2022, time.August, 28, 10, 0, 0, 0, time.FixedZone("PDT", -7*60*60)),
+	},
+	pgcr.ROOT_OF_NIGHTMARES: {
+		start: time.Date(2023, time.March, 10, 9, 0, 0, 0, time.FixedZone("PST", -8*60*60)),
+		end:   time.Date(2023, time.March, 12, 10, 0, 0, 0, time.FixedZone("PDT", -7*60*60)),
+	},
+	pgcr.CROTAS_END: {
+		start: time.Date(2023, time.September, 1, 10, 0, 0, 0, time.FixedZone("PDT", -7*60*60)),
+		end:   time.Date(2023, time.September, 3, 10, 0, 0, 0, time.FixedZone("PDT", -7*60*60)),
+	},
+	pgcr.SALVATIONS_EDGE: {
+		start: time.Date(2024, time.June, 7, 10, 0, 0, 0, time.FixedZone("PDT", -7*60*60)),
+		end:   time.Date(2024, time.June, 9, 10, 0, 0, 0, time.FixedZone("PDT", -7*60*60)),
+	},
+}
+
+// Returns true if the raid was played in contest mode, either because the
+// manifest says so or because it started while its contest window was open.
+// Master and Prestige versions are never contest runs
+func isContest(raid pgcr.RaidName, difficulty pgcr.RaidDifficulty, startTime time.Time) bool {
+	switch difficulty {
+	case pgcr.CONTEST:
+		return true
+	case pgcr.MASTER, pgcr.PRESTIGE:
+		return false
+	}
+
+	window, ok := contestWindows[raid]
+	if !ok {
+		return false
+	}
+	return !startTime.Before(window.start) && startTime.Before(window.end)
+}
@@ -0,0 +1,175 @@
+package mapper
+
+import (
+	_ "embed"
+	"fmt"
+	"slices"
+	"time"
+
+	"pgcr-processing-service/internal/types/pgcr"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed eras.yaml
+var erasYaml []byte
+
+// The catalog shipped with the service, see eras.yaml
+var defaultEras = mustLoadEras(erasYaml)
+
+// A freshnessRule decides how a pgcr is resolved as started from the beginning
+type freshnessRule string
+
+const (
+	freshnessStartingPhase freshnessRule = "starting_phase"
+	freshnessReported      freshnessRule = "reported"
+	freshnessNever         freshnessRule = "never"
+)
+
+var flawlessRules = map[string]flawlessRule{
+	"everyone":  everyoneDeathless,
+	"finishers": finishersDeathless,
+}
+
+type erasFile struct {
+	Eras []struct {
+		Name           string        `yaml:"name"`
+		From           time.Time     `yaml:"from"`
+		Freshness      freshnessRule `yaml:"freshness"`
+		StartingPhases []int         `yaml:"starting_phases"`
+		Flawless       string        `yaml:"flawless"`
+		Activities     []struct {
+			Name           string        `yaml:"name"`
+			Freshness      freshnessRule `yaml:"freshness"`
+			StartingPhases []int         `yaml:"starting_phases"`
+			Hashes         []int64       `yaml:"hashes"`
+		} `yaml:"activities"`
+	} `yaml:"eras"`
+}
+
+type freshness struct {
+	rule           freshnessRule
+	startingPhases []int
+}
+
+type era struct {
+	name       string
+	from       time.Time
+	freshness  freshness
+	flawless   flawlessRule
+	activities map[int64]freshness
+}
+
+// raidEras is the catalog of raid eras sorted by start date
+type raidEras []era
+
+// Parses and validates an era catalog
+func loadEras(data []byte) (raidEras, error) {
+	var file erasFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("unable to parse eras: %w", err)
+	}
+	if len(file.Eras) == 0 {
+		return nil, fmt.Errorf("no eras defined")
+	}
+
+	eras := make(raidEras, 0, len(file.Eras))
+	for i, e := range file.Eras {
+		if i > 0 && !e.From.After(eras[i-1].from) {
+			return nil, fmt.Errorf("era %q must start after %q", e.Name, eras[i-1].name)
+		}
+
+		rule, ok := flawlessRules[e.Flawless]
+		if !ok {
+			return nil, fmt.Errorf("era %q has unknown flawless rule %q", e.Name, e.Flawless)
+		}
+
+		defaults := freshness{rule: e.Freshness, startingPhases: e.StartingPhases}
+		if err := defaults.validate(); err != nil {
+			return nil, fmt.Errorf("era %q: %w", e.Name, err)
+		}
+
+		activities := map[int64]freshness{}
+		for _, a := range e.Activities {
+			override := defaults
+			if a.Freshness != "" {
+				override = freshness{rule: a.Freshness}
+			}
+			if a.StartingPhases != nil {
+				override.startingPhases = a.StartingPhases
+			}
+			if err := override.validate(); err != nil {
+				return nil, fmt.Errorf("era %q activity %q: %w", e.Name, a.Name, err)
+			}
+
+			for _, hash := range a.Hashes {
+				if _, ok := activities[hash]; ok {
+					return nil, fmt.Errorf("era %q lists activity hash %d more than once", e.Name, hash)
+				}
+				activities[hash] = override
+			}
+		}
+
+		eras = append(eras, era{
+			name:       e.Name,
+			from:       e.From,
+			freshness:  defaults,
+			flawless:   rule,
+			activities: activities,
+		})
+	}
+	return eras, nil
+}
+
+func mustLoadEras(data []byte) raidEras {
+	eras, err := loadEras(data)
+	if err != nil {
+		panic(err)
+	}
+	return eras
+}
+
+func (f freshness) validate() error {
+	switch f.rule {
+	case freshnessReported, freshnessNever:
+		return nil
+	case freshnessStartingPhase:
+		if len(f.startingPhases) == 0 {
+			return fmt.Errorf("%s rule requires starting_phases", f.rule)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown freshness rule %q", f.rule)
+	}
+}
+
+// Returns the era an instance that started at the given time belongs to.
+// Anything older than the first era falls into it
+func (r raidEras) eraFor(startTime time.Time) *era {
+	current := &r[0]
+	for i := range r {
+		if startTime.Before(r[i].from) {
+			break
+		}
+		current = &r[i]
+	}
+	return current
+}
+
+// Resolves whether the raid was started from the beginning, using the
+// activity specific rule of its era when there is one
+func (e *era) fromBeginning(report *pgcr.PostGameCarnageReport) bool {
+	rule, ok := e.activities[report.ActivityDetails.ActivityHash]
+	if !ok {
+		rule = e.freshness
+	}
+
+	switch rule.rule {
+	case freshnessStartingPhase:
+		return slices.Contains(rule.startingPhases, report.StartingPhaseIndex)
+	case freshnessReported:
+		return report.ActivityWasStartedFromBeginning
+	default:
+		return false
+	}
+}
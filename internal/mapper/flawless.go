@@ -0,0 +1,56 @@
+package mapper
+
+import "pgcr-processing-service/internal/types/pgcr"
+
+// Players that load in within this many seconds of the activity starting are
+// considered to have started the raid with the rest of their team
+const joinGraceSeconds = 120
+
+// A flawlessRule decides whether a whole team went flawless
+type flawlessRule func(players []pgcr.PlayerInfo) bool
+
+// Nobody who set foot in the instance died, even if they left afterwards
+func everyoneDeathless(players []pgcr.PlayerInfo) bool {
+	for _, p := range players {
+		if !p.Deathless {
+			return false
+		}
+	}
+	return true
+}
+
+// Nobody who finished the raid died. Players who left before the end are
+// ignored, so a single death followed by a leave does not count against
+// the team that actually cleared it
+func finishersDeathless(players []pgcr.PlayerInfo) bool {
+	finished := false
+	for _, p := range players {
+		if !p.Completed {
+			continue
+		}
+		if !p.Deathless {
+			return false
+		}
+		finished = true
+	}
+	return finished
+}
+
+// Sets the player and character level flawless flags once it is known if the
+// raid was started from the beginning. A player is flawless when they were
+// there from the start, finished the raid and never died on any character
+func markFlawlessPlayers(players []pgcr.PlayerInfo, fresh bool) {
+	for i := range players {
+		player := &players[i]
+
+		startedWithTeam := false
+		for j := range player.CharacterInfo {
+			character := &player.CharacterInfo[j]
+			joinedAtStart := character.StartSeconds <= joinGraceSeconds
+			startedWithTeam = startedWithTeam || joinedAtStart
+			character.Flawless = fresh && joinedAtStart && character.ActivityCompleted && character.Deathless
+		}
+
+		player.Flawless = fresh && startedWithTeam && player.Completed && player.Deathless
+	}
+}
@@ -1,18 +0,0 @@
-package mapper
-
-// Leviathan raid hashes
-var leviHashes = map[int64]bool{
-	2693136600: true, 2693136601: true, 2693136602: true,
-	2693136603: true, 2693136604: true, 2693136605: true,
-	89727599: true, 287649202: true, 1699948563: true, 1875726950: true,
-	3916343513: true, 4039317196: true, 417231112: true, 508802457: true,
-	757116822: true, 771164842: true, 1685065161: true, 1800508819: true,
-	2449714930: true, 3446541099: true, 4206123728: true, 3912437239: true,
-	3879860661: true, 3857338478: true,
-}
-
-// Scourge of the Past hashes
-const (
-	sotpHash1 int64 = 548750096
-	sotpHash2 int64 = 2812525063
-)
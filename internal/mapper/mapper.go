@@ -2,6 +2,8 @@ package mapper
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"math"
 	"strconv"
@@ -15,11 +17,13 @@ import (
 
 type PgcrMapper struct {
 	cache cache.Service[manifest.ManifestEntry]
+	eras  raidEras
 }
 
 func New(cache cache.Service[manifest.ManifestEntry]) *PgcrMapper {
 	return &PgcrMapper{
 		cache: cache,
+		eras:  defaultEras,
 	}
 }
 
@@ -27,6 +31,14 @@ const (
 	pstTimezone string = "America/Los_Angeles"
 )
 
+// ErrMalformedPgcr marks pgcrs the mapper will never be able to map, unlike
+// failed manifest lookups which may succeed on a retry
+var ErrMalformedPgcr = errors.New("malformed pgcr")
+
+func malformed(err error) error {
+	return fmt.Errorf("%w: %w", ErrMalformedPgcr, err)
+}
+
 func (m *PgcrMapper) ExtractInfo(report *pgcr.PostGameCarnageReport) (*pgcr.PgcrInfo, error) {
 	enriched, err := m.enrichPgcrInfo(report)
 	if err != nil {
@@ -42,7 +54,7 @@ func (p *PgcrMapper) enrichPgcrInfo(report *pgcr.PostGameCarnageReport) (*pgcr.P
 	startTime, err := time.Parse(time.RFC3339, report.Period)
 	if err != nil {
 		slog.Error("Something went wrong when parsing the period for PGCR", "InstanceId", report.ActivityDetails.InstanceId, "Error", err)
-		return nil, err
+		return nil, malformed(err)
 	}
 
 	if len(report.Entries) == 0 {
@@ -52,7 +64,7 @@ func (p *PgcrMapper) enrichPgcrInfo(report *pgcr.PostGameCarnageReport) (*pgcr.P
 	// Get the max duration value for all players
 	var maxDuration float64 = 0
 	for _, e := range report.Entries {
-		maxDuration = math.Max(float64(maxDuration), float64(e.Values.ActivityDurationSeconds))
+		maxDuration = math.Max(float64(maxDuration), e.Values.ActivityDurationSeconds.Value)
 	}
 
 	endTime := startTime.Add(time.Second * time.Duration(maxDuration))
@@ -63,7 +75,7 @@ func (p *PgcrMapper) enrichPgcrInfo(report *pgcr.PostGameCarnageReport) (*pgcr.P
 	instanceId, err := strconv.ParseInt(report.ActivityDetails.InstanceId, 10, 64)
 	if err != nil {
 		slog.Error("Unable to convert instanceIdto int64 for some reason?", "InstanceId", report.ActivityDetails.InstanceId)
-		return nil, err
+		return nil, malformed(err)
 	}
 
 	entity.InstanceId = instanceId
@@ -79,18 +91,19 @@ func (p *PgcrMapper) enrichPgcrInfo(report *pgcr.PostGameCarnageReport) (*pgcr.P
 	raidName, raidDifficulty, err := utils.GetRaidAndDifficulty(manifestResponse.DisplayProperties.Name)
 	if err != nil {
 		slog.Error("Unable to parse activity raid name and raid difficulty")
-		return nil, err
+		return nil, malformed(err)
 	}
 
 	entity.RaidName = raidName
 	entity.RaidDifficulty = raidDifficulty
+	entity.Contest = isContest(raidName, raidDifficulty, startTime)
 
 	groupedPlayers := make(map[int64][]pgcr.StatsEntry)
 	for _, entry := range report.Entries {
 		membershipId, err := strconv.ParseInt(entry.Player.DestinyUserInfo.MembershipId, 10, 64)
 		if err != nil {
 			slog.Error("Something went wrong when parsing membership ID to Int64", "MembershipId", entry.Player.DestinyUserInfo.MembershipId)
-			return nil, err
+			return nil, malformed(err)
 		}
 		val, ok := groupedPlayers[membershipId]
 		if ok {
@@ -101,36 +114,19 @@ func (p *PgcrMapper) enrichPgcrInfo(report *pgcr.PostGameCarnageReport) (*pgcr.P
 	}
 
 	if entity.PlayerInfo, err = processPlayers(groupedPlayers); err != nil {
-		return nil, err
+		return nil, malformed(err)
 	}
 
-	flawless := true
-
-Outerloop:
-	for _, players := range groupedPlayers {
-		for _, player := range players {
-			if player.Values.Deaths > 0.0 {
-				flawless = false
-				break Outerloop
-			}
-		}
-	}
-
-	fresh, err := resolveFromBeginning(report, flawless)
-	if err != nil {
-		slog.Error("Failed to determine if PGCR is fresh", "InstanceId", instanceId, "Error", err)
-		return nil, err
-	}
+	era := p.eras.eraFor(startTime)
+	flawless := era.flawless(entity.PlayerInfo)
+	fresh := era.fromBeginning(report)
 
-	trio := len(groupedPlayers) == 3
-	duo := len(groupedPlayers) == 2
-	solo := len(groupedPlayers) == 1
+	markFlawlessPlayers(entity.PlayerInfo, fresh)
 
-	entity.Trio = trio
-	entity.Duo = duo
-	entity.Solo = solo
 	entity.Flawless = flawless
-	entity.FromBeginning = *fresh
+	entity.FromBeginning = fresh
+	entity.ClearType = classifyClear(entity.PlayerInfo, fresh, flawless)
+	entity.Completed, entity.CompletionReason, entity.CompletionStatus = resolveCompletion(report.Entries)
 	return &entity, nil
 }
 
@@ -163,11 +159,10 @@ func processPlayers(groups map[int64][]pgcr.StatsEntry) ([]pgcr.PlayerInfo, erro
 			playerInfo.CharacterInfo = append(playerInfo.CharacterInfo, *characterInfo)
 		}
 
+		playerInfo.Deathless = true
 		for _, c := range playerInfo.CharacterInfo {
-			if c.ActivityCompleted {
-				playerInfo.Completed = true
-				break
-			}
+			playerInfo.Completed = playerInfo.Completed || c.ActivityCompleted
+			playerInfo.Deathless = playerInfo.Deathless && c.Deathless
 		}
 
 		totalTimePlayed := 0
@@ -186,7 +181,7 @@ func processPlayers(groups map[int64][]pgcr.StatsEntry) ([]pgcr.PlayerInfo, erro
 // If querying Redis fails then this method return an error
 func createPlayerCharacter(entry *pgcr.StatsEntry) (*pgcr.CharacterInfo, error) {
 	characterInfo := pgcr.CharacterInfo{
-		ActivityCompleted: entry.Values.Completed == 1.0,
+		ActivityCompleted: entry.Values.Completed.Value == 1.0,
 		WeaponInformation: []pgcr.WeaponInfo{}, // empty just in case the player didn't do anything in the activity
 	}
 
@@ -201,66 +196,39 @@ func createPlayerCharacter(entry *pgcr.StatsEntry) (*pgcr.CharacterInfo, error)
 	characterInfo.CharacterId = characterId
 	characterInfo.LightLevel = entry.Player.LightLevel
 	characterInfo.CharacterClass = class
+	characterInfo.ClassHash = entry.Player.ClassHash
 	characterInfo.CharacterEmblem = entry.Player.EmblemHash
-	characterInfo.TimePlayedSeconds = int(entry.Values.TimePlayedSeconds)
-	characterInfo.Kills = int(entry.Values.Kills)
-	characterInfo.Deaths = int(entry.Values.Deaths)
-	characterInfo.Assists = int(entry.Values.Assists)
-	characterInfo.Kda = float64(entry.Values.Kda)
-	characterInfo.Kdr = float64(entry.Values.Kdr)
+	characterInfo.TimePlayedSeconds = int(entry.Values.TimePlayedSeconds.Value)
+	characterInfo.Kills = int(entry.Values.Kills.Value)
+	characterInfo.Deaths = int(entry.Values.Deaths.Value)
+	characterInfo.Deathless = characterInfo.Deaths == 0
+	characterInfo.StartSeconds = int(entry.Values.StartSeconds.Value)
+	characterInfo.Assists = int(entry.Values.Assists.Value)
+	characterInfo.Kda = entry.Values.Kda.Value
+	characterInfo.Kdr = entry.Values.Kdr.Value
+	characterInfo.Efficiency = entry.Values.Efficiency.Value
 
 	// Set weapon information
 	if entry.Extended != nil {
 		for _, weapon := range entry.Extended.Weapons {
 			w := pgcr.WeaponInfo{
 				WeaponHash:     weapon.ReferenceId,
-				Kills:          int(weapon.Values.WeaponKills),
-				PrecisionKills: int(weapon.Values.PrecisionKills),
-				PrecisionRatio: float64(weapon.Values.PrecisionRatio),
+				Kills:          int(weapon.Values.WeaponKills.Value),
+				PrecisionKills: int(weapon.Values.PrecisionKills.Value),
+				PrecisionRatio: weapon.Values.PrecisionRatio.Value,
 			}
 			characterInfo.WeaponInformation = append(characterInfo.WeaponInformation, w)
 		}
 
 		// Set ability information
 		abilityInfo := pgcr.AbilityInfo{
-			GrenadeKills: int(entry.Extended.Abilities.GrenadeKills),
-			MeleeKills:   int(entry.Extended.Abilities.MeleeKills),
-			SuperKills:   int(entry.Extended.Abilities.SuperKills),
+			GrenadeKills:      int(entry.Extended.Abilities.GrenadeKills.Value),
+			MeleeKills:        int(entry.Extended.Abilities.MeleeKills.Value),
+			SuperKills:        int(entry.Extended.Abilities.SuperKills.Value),
+			ClassAbilityKills: int(entry.Extended.Abilities.ClassAbilityKills.Value),
 		}
 		characterInfo.AbilityInformation = abilityInfo
+		characterInfo.PrecisionKills = int(entry.Extended.Abilities.PrecisionKills.Value)
 	}
 	return &characterInfo, nil
 }
-
-// Resolves if a raid was fresh or not, courtesy of @Newo
-func resolveFromBeginning(pgcr *pgcr.PostGameCarnageReport, flawless bool) (*bool, error) {
-	var result *bool = new(bool)
-
-	startTime, err := time.Parse(time.RFC3339, pgcr.Period)
-	if err != nil {
-		return nil, err
-	}
-
-	if startTime.After(hauntedStart) || startTime.Equal(hauntedStart) {
-		return &pgcr.ActivityWasStartedFromBeginning, nil
-	} else if startTime.Before(beyondLightStart) {
-
-		isScourge := pgcr.ActivityDetails.ActivityHash == sotpHash1 || pgcr.ActivityDetails.ActivityHash == sotpHash2
-		isLeviathan := leviHashes[pgcr.ActivityDetails.ActivityHash]
-
-		if isScourge {
-			*result = pgcr.StartingPhaseIndex <= 1
-			return result, nil
-		} else if isLeviathan {
-			*result = pgcr.StartingPhaseIndex == 0 || pgcr.StartingPhaseIndex == 2
-			return result, nil
-		} else {
-			*result = pgcr.StartingPhaseIndex == 0
-			return result, nil
-		}
-	} else if startTime.After(witchQueenStart) && (pgcr.ActivityWasStartedFromBeginning || flawless) {
-		return &pgcr.ActivityWasStartedFromBeginning, nil
-	}
-
-	return result, nil
-}
@@ -3,9 +3,12 @@ package mapper
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
+	"strconv"
 	"testing"
+	"time"
 
 	"pgcr-processing-service/internal/types/manifest"
 	"pgcr-processing-service/internal/types/pgcr"
@@ -36,10 +39,10 @@ func TestExtractInfo_ShouldWorkForDatasetPgcr(t *testing.T) {
 	mockCache.On("Get", mock.Anything, mock.Anything, mock.Anything).
 		Return(manifest.ManifestEntry{DisplayProperties: manifest.DisplayProperties{Name: "Last Wish"}}, nil)
 
-	pgcr := openPgcr(t, "beyond_light_pgcr.json")
+	report := openDatasetPgcr(t, "dataset_pgcr.json")
 	sut := New(mockCache)
 
-	res, err := sut.ExtractInfo(&pgcr.Response)
+	res, err := sut.ExtractInfo(report)
 	if err != nil {
 		t.Fatal("Unable to extract info from dataset-originated pgcr")
 	}
@@ -49,6 +52,485 @@ func TestExtractInfo_ShouldWorkForDatasetPgcr(t *testing.T) {
 	}
 }
 
+func TestExtractInfo_ShouldMapCharacterStats(t *testing.T) {
+	mockCache := new(mockCacheService[manifest.ManifestEntry])
+	mockCache.On("Get", mock.Anything, mock.Anything, mock.Anything).
+		Return(manifest.ManifestEntry{DisplayProperties: manifest.DisplayProperties{Name: "Last Wish"}}, nil)
+
+	report := openPgcr(t, "beyond_light_pgcr.json")
+	res, err := New(mockCache).ExtractInfo(&report.Response)
+	if err != nil {
+		t.Fatalf("Unable to extract info: %v", err)
+	}
+
+	entry := report.Response.Entries[0]
+	var character *pgcr.CharacterInfo
+	for _, p := range res.PlayerInfo {
+		for i, c := range p.CharacterInfo {
+			if strconv.FormatInt(c.CharacterId, 10) == entry.CharacterId {
+				character = &p.CharacterInfo[i]
+			}
+		}
+	}
+
+	if character == nil {
+		t.Fatalf("Character %s was not mapped", entry.CharacterId)
+	}
+	if character.ClassHash != entry.Player.ClassHash || character.LightLevel != entry.Player.LightLevel {
+		t.Fatalf("Character class hash or light level were not mapped: %+v", character)
+	}
+	if character.Efficiency != entry.Values.Efficiency.Value {
+		t.Fatalf("Expected efficiency %v, got %v", entry.Values.Efficiency.Value, character.Efficiency)
+	}
+	if character.PrecisionKills != int(entry.Extended.Abilities.PrecisionKills.Value) {
+		t.Fatalf("Expected %v precision kills, got %d", entry.Extended.Abilities.PrecisionKills.Value, character.PrecisionKills)
+	}
+	if character.AbilityInformation.ClassAbilityKills != int(entry.Extended.Abilities.ClassAbilityKills.Value) {
+		t.Fatalf("Expected %v class ability kills, got %d", entry.Extended.Abilities.ClassAbilityKills.Value, character.AbilityInformation.ClassAbilityKills)
+	}
+}
+
+func TestExtractInfo_ShouldClassifyLowmans(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     pgcr.ClearType
+	}{
+		{filename: "solo_pgcr.json", want: pgcr.SOLO},
+		{filename: "solo_flawless_pgcr.json", want: pgcr.SOLO_FLAWLESS},
+		{filename: "duo_pgcr.json", want: pgcr.DUO},
+		{filename: "duo_flawless_pgcr.json", want: pgcr.DUO_FLAWLESS},
+		{filename: "trio_pgcr.json", want: pgcr.TRIO},
+		{filename: "trio_flawless_pgcr.json", want: pgcr.TRIO_FLAWLESS},
+		{filename: "flawless_pgcr.json", want: ""},
+		{filename: "not_completed_pgcr.json", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			mockCache := new(mockCacheService[manifest.ManifestEntry])
+			mockCache.On("Get", mock.Anything, mock.Anything, mock.Anything).
+				Return(manifest.ManifestEntry{DisplayProperties: manifest.DisplayProperties{Name: "Last Wish"}}, nil)
+
+			report := openPgcr(t, tt.filename)
+			res, err := New(mockCache).ExtractInfo(&report.Response)
+			if err != nil {
+				t.Fatalf("Unable to extract info: %v", err)
+			}
+
+			if res.ClearType != tt.want {
+				t.Fatalf("Expected clear type [%s], got [%s]", tt.want, res.ClearType)
+			}
+		})
+	}
+}
+
+func TestClassifyClear_ShouldIgnorePlayersThatNeverPlayed(t *testing.T) {
+	players := []pgcr.PlayerInfo{
+		{MembershipId: 1, Completed: true, TimePlayedSeconds: 3000},
+		{MembershipId: 2, Completed: true, TimePlayedSeconds: 3000},
+		{MembershipId: 3, Completed: false, TimePlayedSeconds: 12},
+	}
+
+	if got := classifyClear(players, true, false); got != pgcr.DUO {
+		t.Fatalf("Expected a duo, got [%s]", got)
+	}
+}
+
+func TestClassifyClear_ShouldCountPlayersThatLeftEarly(t *testing.T) {
+	players := []pgcr.PlayerInfo{
+		{MembershipId: 1, Completed: true, TimePlayedSeconds: 3000},
+		{MembershipId: 2, Completed: true, TimePlayedSeconds: 3000},
+		{MembershipId: 3, Completed: false, TimePlayedSeconds: 900},
+	}
+
+	if got := classifyClear(players, true, true); got != pgcr.TRIO_FLAWLESS {
+		t.Fatalf("Expected a flawless trio, got [%s]", got)
+	}
+}
+
+func TestClassifyClear_ShouldNotBeFlawlessFromCheckpoint(t *testing.T) {
+	players := []pgcr.PlayerInfo{
+		{MembershipId: 1, Completed: true, TimePlayedSeconds: 600},
+	}
+
+	if got := classifyClear(players, false, true); got != pgcr.SOLO {
+		t.Fatalf("Expected a solo, got [%s]", got)
+	}
+}
+
+func TestExtractInfo_ShouldTrackPerPlayerFlawless(t *testing.T) {
+	mockCache := new(mockCacheService[manifest.ManifestEntry])
+	mockCache.On("Get", mock.Anything, mock.Anything, mock.Anything).
+		Return(manifest.ManifestEntry{DisplayProperties: manifest.DisplayProperties{Name: "Last Wish"}}, nil)
+
+	report := openPgcr(t, "trio_pgcr.json")
+	res, err := New(mockCache).ExtractInfo(&report.Response)
+	if err != nil {
+		t.Fatalf("Unable to extract info: %v", err)
+	}
+
+	if res.Flawless {
+		t.Fatal("Expected the team not to be flawless")
+	}
+
+	flawless := map[int64]bool{}
+	for _, p := range res.PlayerInfo {
+		flawless[p.MembershipId] = p.Flawless
+		if p.Deathless != p.Flawless {
+			t.Fatalf("Expected deathless and flawless to match for player %d on a fresh clear", p.MembershipId)
+		}
+		for _, c := range p.CharacterInfo {
+			if c.Flawless != p.Flawless {
+				t.Fatalf("Expected character %d to match player flawless", c.CharacterId)
+			}
+		}
+	}
+
+	want := map[int64]bool{
+		4611686018440744095: false,
+		4611686018437477666: true,
+		4611686018508859852: true,
+	}
+	for id, w := range want {
+		if got, ok := flawless[id]; !ok || got != w {
+			t.Fatalf("Expected player %d flawless to be %v, got %v", id, w, got)
+		}
+	}
+}
+
+func TestExtractInfo_ShouldNotMarkCheckpointPlayersFlawless(t *testing.T) {
+	mockCache := new(mockCacheService[manifest.ManifestEntry])
+	mockCache.On("Get", mock.Anything, mock.Anything, mock.Anything).
+		Return(manifest.ManifestEntry{DisplayProperties: manifest.DisplayProperties{Name: "Last Wish"}}, nil)
+
+	report := openPgcr(t, "various_character_pgcr.json")
+	res, err := New(mockCache).ExtractInfo(&report.Response)
+	if err != nil {
+		t.Fatalf("Unable to extract info: %v", err)
+	}
+
+	for _, p := range res.PlayerInfo {
+		if p.Flawless {
+			t.Fatalf("Player %d cannot be flawless on a checkpoint run", p.MembershipId)
+		}
+	}
+}
+
+func TestFinishersDeathless_ShouldIgnorePlayersThatLeft(t *testing.T) {
+	players := []pgcr.PlayerInfo{
+		{MembershipId: 1, Completed: true, Deathless: true},
+		{MembershipId: 2, Completed: true, Deathless: true},
+		{MembershipId: 3, Completed: false, Deathless: false},
+	}
+
+	if !finishersDeathless(players) {
+		t.Fatal("Expected finishers to be flawless")
+	}
+	if everyoneDeathless(players) {
+		t.Fatal("Expected the strict rule to count the player that left")
+	}
+}
+
+func TestFinishersDeathless_ShouldRequireAFinisher(t *testing.T) {
+	players := []pgcr.PlayerInfo{
+		{MembershipId: 1, Completed: false, Deathless: true},
+	}
+
+	if finishersDeathless(players) {
+		t.Fatal("Expected an incomplete instance not to be flawless")
+	}
+}
+
+func TestEras_ShouldPickFlawlessRuleByEra(t *testing.T) {
+	players := []pgcr.PlayerInfo{
+		{MembershipId: 1, Completed: true, Deathless: true},
+		{MembershipId: 2, Completed: false, Deathless: false},
+	}
+
+	witchQueen := time.Date(2022, time.April, 19, 17, 0, 0, 0, time.UTC)
+	if defaultEras.eraFor(witchQueen).flawless(players) {
+		t.Fatal("Expected the strict rule before Haunted")
+	}
+	haunted := time.Date(2022, time.May, 24, 17, 0, 0, 0, time.UTC)
+	if !defaultEras.eraFor(haunted).flawless(players) {
+		t.Fatal("Expected the finishers rule starting with Haunted")
+	}
+}
+
+func TestExtractInfo_ShouldResolveFreshnessByEra(t *testing.T) {
+	mockCache := new(mockCacheService[manifest.ManifestEntry])
+	mockCache.On("Get", mock.Anything, mock.Anything, mock.Anything).
+		Return(manifest.ManifestEntry{DisplayProperties: manifest.DisplayProperties{Name: "Last Wish"}}, nil)
+
+	tests := []struct {
+		filename string
+		want     bool
+	}{
+		{filename: "pre_beyond_light_fresh_pgcr.json", want: true},
+		{filename: "pre_beyond_light_non_fresh_pgcr.json", want: false},
+		{filename: "beyond_light_pgcr.json", want: false},
+		{filename: "witch_queen_pgcr.json", want: false},
+		{filename: "duo_flawless_pgcr.json", want: true},
+		{filename: "various_character_pgcr.json", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			report := openPgcr(t, tt.filename)
+			res, err := New(mockCache).ExtractInfo(&report.Response)
+			if err != nil {
+				t.Fatalf("Unable to extract info: %v", err)
+			}
+			if res.FromBeginning != tt.want {
+				t.Fatalf("Expected fresh [%t], got [%t]", tt.want, res.FromBeginning)
+			}
+		})
+	}
+}
+
+func TestEras_ShouldApplyActivityStartingPhases(t *testing.T) {
+	const (
+		scourge   int64 = 548750096
+		leviathan int64 = 2693136600
+		crown     int64 = 3333172150
+	)
+
+	tests := []struct {
+		name  string
+		hash  int64
+		phase int
+		want  bool
+	}{
+		{name: "scourge from the start", hash: scourge, phase: 0, want: true},
+		{name: "scourge second phase", hash: scourge, phase: 1, want: true},
+		{name: "scourge checkpoint", hash: scourge, phase: 2, want: false},
+		{name: "leviathan from the start", hash: leviathan, phase: 0, want: true},
+		{name: "leviathan skipped intro", hash: leviathan, phase: 2, want: true},
+		{name: "leviathan checkpoint", hash: leviathan, phase: 1, want: false},
+		{name: "other raid from the start", hash: crown, phase: 0, want: true},
+		{name: "other raid checkpoint", hash: crown, phase: 1, want: false},
+	}
+
+	era := defaultEras.eraFor(time.Date(2020, time.September, 7, 1, 9, 9, 0, time.UTC))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := &pgcr.PostGameCarnageReport{StartingPhaseIndex: tt.phase}
+			report.ActivityDetails.ActivityHash = tt.hash
+			if got := era.fromBeginning(report); got != tt.want {
+				t.Fatalf("Expected fresh [%t], got [%t]", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLoadEras_ShouldOverrideRulesPerActivity(t *testing.T) {
+	eras, err := loadEras([]byte(`
+eras:
+  - name: Current
+    freshness: never
+    flawless: everyone
+    activities:
+      - name: New raid
+        freshness: reported
+        hashes: [1]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := &pgcr.PostGameCarnageReport{ActivityWasStartedFromBeginning: true}
+	report.ActivityDetails.ActivityHash = 1
+	if !eras.eraFor(time.Now()).fromBeginning(report) {
+		t.Fatal("Expected the activity rule to be used")
+	}
+
+	report.ActivityDetails.ActivityHash = 2
+	if eras.eraFor(time.Now()).fromBeginning(report) {
+		t.Fatal("Expected the era rule to be used")
+	}
+}
+
+func TestLoadEras_ShouldRejectInvalidCatalogs(t *testing.T) {
+	tests := map[string]string{
+		"empty":             `eras: []`,
+		"unknown freshness": "eras:\n  - {name: A, freshness: maybe, flawless: everyone}",
+		"unknown flawless":  "eras:\n  - {name: A, freshness: never, flawless: nobody}",
+		"missing phases":    "eras:\n  - {name: A, freshness: starting_phase, flawless: everyone}",
+		"unsorted": "eras:\n  - {name: A, from: 2022-01-01T00:00:00Z, freshness: never, flawless: everyone}\n" +
+			"  - {name: B, from: 2021-01-01T00:00:00Z, freshness: never, flawless: everyone}",
+		"duplicate hash": "eras:\n  - {name: A, freshness: never, flawless: everyone, activities: [" +
+			"{name: X, freshness: reported, hashes: [1]}, {name: Y, freshness: reported, hashes: [1]}]}",
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := loadEras([]byte(data)); err == nil {
+				t.Fatal("Expected an error loading the catalog")
+			}
+		})
+	}
+}
+
+func TestMarkFlawlessPlayers_ShouldAllowCharacterSwaps(t *testing.T) {
+	players := []pgcr.PlayerInfo{
+		{
+			MembershipId: 1,
+			Completed:    true,
+			Deathless:    true,
+			CharacterInfo: []pgcr.CharacterInfo{
+				{CharacterId: 1, StartSeconds: 0, Deathless: true, ActivityCompleted: false},
+				{CharacterId: 2, StartSeconds: 900, Deathless: true, ActivityCompleted: true},
+			},
+		},
+	}
+
+	markFlawlessPlayers(players, true)
+
+	if !players[0].Flawless {
+		t.Fatal("Expected the player to be flawless across both characters")
+	}
+	for _, c := range players[0].CharacterInfo {
+		if c.Flawless {
+			t.Fatalf("Expected character %d not to be flawless on its own", c.CharacterId)
+		}
+	}
+}
+
+// Other values of the completionReason stat found in the sample pgcrs
+const (
+	reasonObjectiveCompleted = 0
+	reasonUnknown            = 255
+)
+
+func TestExtractInfo_ShouldResolveCompletion(t *testing.T) {
+	tests := []struct {
+		filename  string
+		completed bool
+		reason    int
+		status    pgcr.CompletionStatus
+	}{
+		{filename: "solo_pgcr.json", completed: true, reason: reasonObjectiveCompleted, status: pgcr.FINISHED},
+		{filename: "witch_queen_pgcr.json", completed: true, reason: reasonObjectiveCompleted, status: pgcr.FINISHED},
+		{filename: "not_completed_pgcr.json", completed: false, reason: reasonUnknown, status: pgcr.ABANDONED},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			mockCache := new(mockCacheService[manifest.ManifestEntry])
+			mockCache.On("Get", mock.Anything, mock.Anything, mock.Anything).
+				Return(manifest.ManifestEntry{DisplayProperties: manifest.DisplayProperties{Name: "Last Wish"}}, nil)
+
+			report := openPgcr(t, tt.filename)
+			res, err := New(mockCache).ExtractInfo(&report.Response)
+			if err != nil {
+				t.Fatalf("Unable to extract info: %v", err)
+			}
+
+			if res.Completed != tt.completed || res.CompletionReason == nil || *res.CompletionReason != tt.reason || res.CompletionStatus != tt.status {
+				t.Fatalf("Expected completed=%v reason=%d status=%s, got completed=%v reason=%v status=%s",
+					tt.completed, tt.reason, tt.status, res.Completed, res.CompletionReason, res.CompletionStatus)
+			}
+		})
+	}
+}
+
+func TestResolveCompletion_ShouldDetectWipes(t *testing.T) {
+	entries := []pgcr.StatsEntry{
+		{Values: pgcr.StatValues{CompletionReason: &pgcr.StatValue{Value: reasonFailed}}},
+		{Values: pgcr.StatValues{CompletionReason: &pgcr.StatValue{Value: reasonFailed}}},
+	}
+
+	completed, reason, status := resolveCompletion(entries)
+	if completed || reason == nil || *reason != reasonFailed || status != pgcr.WIPED {
+		t.Fatalf("Expected a wipe, got completed=%v reason=%v status=%s", completed, reason, status)
+	}
+}
+
+func TestResolveCompletion_ShouldPreferFinishersReason(t *testing.T) {
+	entries := []pgcr.StatsEntry{
+		{Values: pgcr.StatValues{CompletionReason: &pgcr.StatValue{Value: reasonUnknown}}},
+		{Values: pgcr.StatValues{Completed: pgcr.StatValue{Value: 1}, CompletionReason: &pgcr.StatValue{Value: reasonObjectiveCompleted}}},
+	}
+
+	completed, reason, status := resolveCompletion(entries)
+	if !completed || reason == nil || *reason != reasonObjectiveCompleted || status != pgcr.FINISHED {
+		t.Fatalf("Expected a finished instance, got completed=%v reason=%v status=%s", completed, reason, status)
+	}
+}
+
+func TestResolveCompletion_ShouldLeaveMissingReasonUnset(t *testing.T) {
+	entries := []pgcr.StatsEntry{
+		{Values: pgcr.StatValues{Completed: pgcr.StatValue{Value: 1}}},
+	}
+
+	completed, reason, status := resolveCompletion(entries)
+	if !completed || reason != nil || status != pgcr.FINISHED {
+		t.Fatalf("Expected a finished instance without a reason, got completed=%v reason=%v status=%s", completed, reason, status)
+	}
+}
+
+func TestExtractInfo_ShouldOnlyMarkMalformedPgcrs(t *testing.T) {
+	mockCache := new(mockCacheService[manifest.ManifestEntry])
+	mockCache.On("Get", mock.Anything, mock.Anything, mock.Anything).
+		Return(manifest.ManifestEntry{}, errors.New("redis is down"))
+
+	report := openPgcr(t, "solo_pgcr.json")
+	_, err := New(mockCache).ExtractInfo(&report.Response)
+	if err == nil || errors.Is(err, ErrMalformedPgcr) {
+		t.Fatalf("Expected a manifest failure to be retryable, got %v", err)
+	}
+
+	report.Response.Period = "not a date"
+	_, err = New(mockCache).ExtractInfo(&report.Response)
+	if !errors.Is(err, ErrMalformedPgcr) {
+		t.Fatalf("Expected ErrMalformedPgcr, got %v", err)
+	}
+}
+
+func TestIsContest(t *testing.T) {
+	seLaunch := time.Date(2024, time.June, 7, 17, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		raid       pgcr.RaidName
+		difficulty pgcr.RaidDifficulty
+		start      time.Time
+		want       bool
+	}{
+		{name: "contest difficulty", raid: pgcr.SALVATIONS_EDGE, difficulty: pgcr.CONTEST, start: seLaunch.AddDate(1, 0, 0), want: true},
+		{name: "inside window", raid: pgcr.SALVATIONS_EDGE, difficulty: pgcr.NORMAL, start: seLaunch.Add(time.Hour), want: true},
+		{name: "window start", raid: pgcr.SALVATIONS_EDGE, difficulty: pgcr.NORMAL, start: seLaunch, want: true},
+		{name: "before window", raid: pgcr.SALVATIONS_EDGE, difficulty: pgcr.NORMAL, start: seLaunch.Add(-time.Minute), want: false},
+		{name: "after window", raid: pgcr.SALVATIONS_EDGE, difficulty: pgcr.NORMAL, start: seLaunch.Add(48 * time.Hour), want: false},
+		{name: "master inside window", raid: pgcr.SALVATIONS_EDGE, difficulty: pgcr.MASTER, start: seLaunch.Add(time.Hour), want: false},
+		{name: "raid without contest", raid: pgcr.LAST_WISH, difficulty: pgcr.NORMAL, start: seLaunch.Add(time.Hour), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isContest(tt.raid, tt.difficulty, tt.start); got != tt.want {
+				t.Fatalf("Expected contest to be %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestExtractInfo_ShouldTagContestDifficulty(t *testing.T) {
+	mockCache := new(mockCacheService[manifest.ManifestEntry])
+	mockCache.On("Get", mock.Anything, mock.Anything, mock.Anything).
+		Return(manifest.ManifestEntry{DisplayProperties: manifest.DisplayProperties{Name: "Salvation's Edge: Contest"}}, nil)
+
+	report := openPgcr(t, "solo_pgcr.json")
+	res, err := New(mockCache).ExtractInfo(&report.Response)
+	if err != nil {
+		t.Fatalf("Unable to extract info: %v", err)
+	}
+
+	if !res.Contest || res.RaidDifficulty != pgcr.CONTEST {
+		t.Fatalf("Expected a contest run, got contest=%v difficulty=%s", res.Contest, res.RaidDifficulty)
+	}
+}
+
 func openPgcr(t *testing.T, filename string) *pgcr.PostGameCarnageReportResponse {
 	t.Helper()
 	bytes, err := os.ReadFile(filepath.Join("./testdata/", filename))
@@ -64,6 +546,22 @@ func openPgcr(t *testing.T, filename string) *pgcr.PostGameCarnageReportResponse
 	return &pgcr
 }
 
+// Dataset dumps store the report itself, without the API response envelope
+func openDatasetPgcr(t *testing.T, filename string) *pgcr.PostGameCarnageReport {
+	t.Helper()
+	bytes, err := os.ReadFile(filepath.Join("./testdata/", filename))
+	if err != nil {
+		t.Fatalf("Error reading file %s: %v", filename, err)
+		return nil
+	}
+
+	var report pgcr.PostGameCarnageReport
+	if err = json.Unmarshal(bytes, &report); err != nil {
+		t.Fatalf("Error marshaling pgcr for file %s: %v", filename, err)
+	}
+	return &report
+}
+
 type mockCacheService[T any] struct {
 	mock.Mock
 }
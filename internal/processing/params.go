@@ -0,0 +1,115 @@
+package processing
+
+import (
+	"database/sql"
+	"strconv"
+
+	"pgcr-processing-service/internal/db"
+	"pgcr-processing-service/internal/types/pgcr"
+)
+
+// The functions in this file translate a processed pgcr into query parameters.
+// Every field of pgcr.PgcrInfo must end up in one of these, which is enforced
+// by the consistency test in params_test.go
+
+func instanceParams(info *pgcr.PgcrInfo) db.CreateInstanceParams {
+	return db.CreateInstanceParams{
+		ID:               info.InstanceId,
+		ActivityHash:     info.ActivityHash,
+		IsFresh:          info.FromBeginning,
+		Flawless:         info.Flawless,
+		Completed:        info.Completed,
+		PlayerCount:      int32(len(info.PlayerInfo)),
+		StartTime:        info.StartTime,
+		EndTime:          info.EndTime,
+		DurationSeconds:  int32(info.EndTime.Sub(info.StartTime).Seconds()),
+		ClearType:        sql.NullString{String: string(info.ClearType), Valid: info.ClearType != ""},
+		CompletionReason: nullInt32(info.CompletionReason),
+		CompletionStatus: sql.NullString{String: string(info.CompletionStatus), Valid: info.CompletionStatus != ""},
+		IsContest:        info.Contest,
+	}
+}
+
+func destinyPlayerParams(pi *pgcr.PlayerInfo) db.CreateDestinyPlayerParams {
+	player := db.CreateDestinyPlayerParams{
+		MembershipID:      pi.MembershipId,
+		MembershipType:    int32(pi.MembershipType),
+		IsPublic:          sql.NullBool{Bool: pi.IsPublic, Valid: true},
+		IconPath:          sql.NullString{String: pi.IconPath, Valid: pi.IconPath != ""},
+		GlobalDisplayName: sql.NullString{String: pi.GlobalDisplayName, Valid: pi.GlobalDisplayName != ""},
+		GlobalDisplayNameCode: sql.NullInt32{
+			Int32: int32(pi.GlobalDisplayNameCode),
+			Valid: pi.GlobalDisplayNameCode != 0,
+		},
+	}
+
+	if pi.GlobalDisplayName != "" {
+		player.DisplayName = sql.NullString{String: pi.GlobalDisplayName, Valid: pi.GlobalDisplayName != ""}
+	} else {
+		player.DisplayName = sql.NullString{String: pi.DisplayName, Valid: pi.DisplayName != ""}
+	}
+	return player
+}
+
+func instancePlayerParams(instanceId int64, pi *pgcr.PlayerInfo) db.CreateInstancePlayerParams {
+	return db.CreateInstancePlayerParams{
+		InstanceID:        instanceId,
+		MembershipID:      pi.MembershipId,
+		Completed:         sql.NullBool{Bool: pi.Completed, Valid: true},
+		TimePlayedSeconds: pi.TimePlayedSeconds,
+		Deathless:         pi.Deathless,
+		Flawless:          pi.Flawless,
+	}
+}
+
+func instanceCharacterParams(instanceId, membershipId int64, ci *pgcr.CharacterInfo) db.CreateInstanceCharacterParams {
+	return db.CreateInstanceCharacterParams{
+		InstanceID:        instanceId,
+		MembershipID:      membershipId,
+		CharacterID:       ci.CharacterId,
+		ClassHash:         ci.ClassHash,
+		CharacterClass:    sql.NullString{String: string(ci.CharacterClass), Valid: ci.CharacterClass != ""},
+		LightLevel:        int32(ci.LightLevel),
+		EmblemHash:        ci.CharacterEmblem,
+		Completed:         ci.ActivityCompleted,
+		Kills:             int32(ci.Kills),
+		Deaths:            int32(ci.Deaths),
+		Assists:           int32(ci.Assists),
+		Kda:               formatDecimal(ci.Kda),
+		Kdr:               formatDecimal(ci.Kdr),
+		Efficiency:        formatDecimal(ci.Efficiency),
+		PrecisionKills:    int32(ci.PrecisionKills),
+		SuperKills:        int32(ci.AbilityInformation.SuperKills),
+		GrenadeKills:      int32(ci.AbilityInformation.GrenadeKills),
+		MeleeKills:        int32(ci.AbilityInformation.MeleeKills),
+		ClassAbilityKills: int32(ci.AbilityInformation.ClassAbilityKills),
+		TimePlayedSeconds: int32(ci.TimePlayedSeconds),
+		StartSeconds:      int32(ci.StartSeconds),
+		Deathless:         ci.Deathless,
+		Flawless:          ci.Flawless,
+	}
+}
+
+func instanceCharacterWeaponParams(instanceId, membershipId, characterId int64, wi *pgcr.WeaponInfo) db.CreateInstanceCharacterWeaponParams {
+	return db.CreateInstanceCharacterWeaponParams{
+		InstanceID:         instanceId,
+		PlayerMembershipID: membershipId,
+		PlayerCharacterID:  characterId,
+		WeaponID:           wi.WeaponHash,
+		Kills:              int32(wi.Kills),
+		PrecisionKills:     int32(wi.PrecisionKills),
+		PrecisionRatio:     formatDecimal(wi.PrecisionRatio),
+	}
+}
+
+func nullInt32(i *int) sql.NullInt32 {
+	if i == nil {
+		return sql.NullInt32{}
+	}
+	return sql.NullInt32{Int32: int32(*i), Valid: true}
+}
+
+// Postgres decimals are sent as strings to avoid losing precision
+func formatDecimal(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
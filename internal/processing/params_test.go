@@ -0,0 +1,138 @@
+package processing
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"pgcr-processing-service/internal/types/pgcr"
+)
+
+// Fields that are intentionally not written by the processor, with the reason why
+var notPersisted = map[string]string{
+	"RaidName":       "derived from activity_hash through the activity table",
+	"RaidDifficulty": "derived from activity_hash through the activity table",
+}
+
+// Fails whenever a field is added to pgcr.PgcrInfo, or any of the types nested in
+// it, without being written to the database. Each leaf field is set to a non-zero
+// value in isolation and the resulting query parameters must change because of it
+func TestParams_ShouldPersistEveryMappedField(t *testing.T) {
+	baseline := persisted(newInfo())
+
+	for _, leaf := range leafFields(reflect.TypeOf(pgcr.PgcrInfo{}), nil, "") {
+		name := leaf.path[strings.LastIndex(leaf.path, ".")+1:]
+		if _, ok := notPersisted[name]; ok {
+			continue
+		}
+
+		t.Run(leaf.path, func(t *testing.T) {
+			info := newInfo()
+			setNonZero(t, resolve(reflect.ValueOf(info).Elem(), leaf.index))
+
+			if reflect.DeepEqual(baseline, persisted(info)) {
+				t.Fatalf("%s is mapped but never persisted, write it to the db or add it to notPersisted", leaf.path)
+			}
+		})
+	}
+}
+
+func TestParams_ShouldFormatDecimals(t *testing.T) {
+	params := instanceCharacterParams(1, 2, &pgcr.CharacterInfo{Kda: 17.16725978647687, Efficiency: 18.52})
+	if params.Kda != "17.16725978647687" {
+		t.Fatalf("Unexpected kda [%s]", params.Kda)
+	}
+	if params.Efficiency != "18.52" {
+		t.Fatalf("Unexpected efficiency [%s]", params.Efficiency)
+	}
+}
+
+// A pgcr with exactly one of every nested element so every field can be reached
+func newInfo() *pgcr.PgcrInfo {
+	return &pgcr.PgcrInfo{
+		PlayerInfo: []pgcr.PlayerInfo{{
+			CharacterInfo: []pgcr.CharacterInfo{{
+				WeaponInformation: []pgcr.WeaponInfo{{}},
+			}},
+		}},
+	}
+}
+
+// Collects every query parameter the processor would send for a pgcr
+func persisted(info *pgcr.PgcrInfo) []any {
+	params := []any{instanceParams(info)}
+	for _, pi := range info.PlayerInfo {
+		params = append(params, destinyPlayerParams(&pi), instancePlayerParams(info.InstanceId, &pi))
+		for _, ci := range pi.CharacterInfo {
+			params = append(params, instanceCharacterParams(info.InstanceId, pi.MembershipId, &ci))
+			for _, wi := range ci.WeaponInformation {
+				params = append(params, instanceCharacterWeaponParams(info.InstanceId, pi.MembershipId, ci.CharacterId, &wi))
+			}
+		}
+	}
+	return params
+}
+
+type leaf struct {
+	path  string
+	index []int // field indexes, slices are always entered at element 0
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func leafFields(typ reflect.Type, index []int, path string) []leaf {
+	switch {
+	case typ == timeType:
+		return []leaf{{path: path, index: index}}
+	case typ.Kind() == reflect.Slice:
+		return leafFields(typ.Elem(), index, path+"[0]")
+	case typ.Kind() == reflect.Struct:
+		leaves := []leaf{}
+		for i := range typ.NumField() {
+			field := typ.Field(i)
+			next := append(append([]int{}, index...), i)
+			name := field.Name
+			if path != "" {
+				name = path + "." + field.Name
+			}
+			leaves = append(leaves, leafFields(field.Type, next, name)...)
+		}
+		return leaves
+	default:
+		return []leaf{{path: path, index: index}}
+	}
+}
+
+func resolve(v reflect.Value, index []int) reflect.Value {
+	for _, i := range index {
+		for v.Kind() == reflect.Slice {
+			v = v.Index(0)
+		}
+		v = v.Field(i)
+	}
+	return v
+}
+
+func setNonZero(t *testing.T, v reflect.Value) {
+	t.Helper()
+	switch {
+	case v.Type() == timeType:
+		v.Set(reflect.ValueOf(time.Date(2024, time.June, 7, 17, 0, 0, 0, time.UTC)))
+	case v.Kind() == reflect.Pointer:
+		v.Set(reflect.New(v.Type().Elem()))
+		setNonZero(t, v.Elem())
+	case v.Kind() == reflect.Bool:
+		v.SetBool(true)
+	case v.CanInt():
+		v.SetInt(7)
+	case v.CanUint():
+		v.SetUint(7)
+	case v.CanFloat():
+		v.SetFloat(1.5)
+	case v.Kind() == reflect.String:
+		v.SetString("non-zero")
+	default:
+		t.Fatalf("Unsupported field kind %s, extend setNonZero", v.Kind())
+	}
+}
@@ -8,13 +8,13 @@ import (
 	"fmt"
 	"log/slog"
 	"strconv"
-	"time"
 
 	"pgcr-processing-service/internal/cache"
 	"pgcr-processing-service/internal/compress"
 	"pgcr-processing-service/internal/db"
 	"pgcr-processing-service/internal/mapper"
 	"pgcr-processing-service/internal/rabbitmq"
+	"pgcr-processing-service/internal/types/ledger"
 	"pgcr-processing-service/internal/types/manifest"
 	"pgcr-processing-service/internal/types/pgcr"
 	"pgcr-processing-service/internal/utils"
@@ -39,41 +39,44 @@ var reverseSources map[string]Source = map[string]Source{
 	"dataset": dataset,
 }
 
-type Status int
+// Failed attempts before an instance is marked dead and dropped from the queue
+const maxAttempts = 5
 
-const (
-	processing Status = iota + 1
-	errored
-	success
-)
+// Published pgcrs are decoded up to this size. Requeued oversized pgcrs are
+// let in over the crawler's limit, this only stops decompression bombs
+const maxDecodedSize = 1024 * 1024 * 8
 
-var statuses map[Status]string = map[Status]string{
-	processing: "processing",
-	errored:    "error",
-	success:    "success",
+// Failures that will happen again on every retry, e.g. a pgcr the mapper can't handle
+type permanentError struct {
+	err error
 }
 
-const staleThreshold = 5 * time.Minute
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
 
 type Processor interface {
 	DoPgcr(pgcr.PgcrInfo) error
 }
 
 type PgcrProcessor struct {
-	db       *sql.DB
-	queries  *db.Queries
-	rabbitmq *rabbitmq.RabbitMQ
-	mapper   *mapper.PgcrMapper
-	cache    cache.Service[manifest.ManifestEntry]
+	db         *sql.DB
+	queries    *db.Queries
+	rabbitmq   *rabbitmq.RabbitMQ
+	mapper     *mapper.PgcrMapper
+	cache      cache.Service[manifest.ManifestEntry]
+	compressor compress.PGCRCompressor
 }
 
-func NewProcessor(db *sql.DB, queries *db.Queries, rabbitmq *rabbitmq.RabbitMQ, mapper *mapper.PgcrMapper, redis cache.Service[manifest.ManifestEntry]) *PgcrProcessor {
+// The compressor is only needed to store new pgcrs, stored ones are read with
+// the codec they were written with
+func NewProcessor(db *sql.DB, queries *db.Queries, rabbitmq *rabbitmq.RabbitMQ, mapper *mapper.PgcrMapper, redis cache.Service[manifest.ManifestEntry], compressor compress.PGCRCompressor) *PgcrProcessor {
 	return &PgcrProcessor{
-		db:       db,
-		queries:  queries,
-		rabbitmq: rabbitmq,
-		mapper:   mapper,
-		cache:    redis,
+		db:         db,
+		queries:    queries,
+		rabbitmq:   rabbitmq,
+		mapper:     mapper,
+		cache:      redis,
+		compressor: compressor,
 	}
 }
 
@@ -101,20 +104,59 @@ func (p *PgcrProcessor) StartWork(ctx context.Context, id int) error {
 }
 
 func (p *PgcrProcessor) handleDelivery(ctx context.Context, delivery amqp091.Delivery) {
-	var pgcr pgcr.PostGameCarnageReportResponse
-	err := json.Unmarshal(delivery.Body, &pgcr)
+	source, err := extractSource(delivery.Headers)
 	if err != nil {
-		slog.Error("Error unmarshalling body from message", "Error", err)
+		slog.Warn("Unable to extract PGCR source from amqp headers", "error", err)
 		delivery.Nack(false, false)
+		return
+	}
+
+	// Best effort, only used to record undecodable messages in the ledger
+	instanceId, _ := strconv.ParseInt(delivery.MessageId, 10, 64)
+
+	// The crawler may publish pgcrs still compressed as they came from Bungie
+	body, err := compress.Decode(delivery.ContentEncoding, delivery.Body, maxDecodedSize)
+	if errors.Is(err, compress.ErrDecodedTooLarge) {
+		slog.Error("Message body decodes over the limit", "messageId", delivery.MessageId, "encoding", delivery.ContentEncoding, "error", err)
+		p.fail(ctx, delivery, instanceId, source, permanentError{err})
+		return
+	}
+	if err != nil {
+		slog.Error("Error decoding body from message", "messageId", delivery.MessageId, "encoding", delivery.ContentEncoding, "error", err)
+		p.recrawl(ctx, delivery, instanceId, source)
+		return
 	}
 
-	instanceId := pgcr.Response.ActivityDetails.InstanceId
-	instanceId64, _ := strconv.ParseInt(instanceId, 10, 64)
+	var pgcr pgcr.PostGameCarnageReportResponse
+	if err := json.Unmarshal(body, &pgcr); err != nil {
+		slog.Error("Error unmarshalling body from message", "messageId", delivery.MessageId, "error", err)
+		p.recrawl(ctx, delivery, instanceId, source)
+		return
+	}
+	if err := checkPgcr(&pgcr); err != nil {
+		slog.Error("Message is not a pgcr", "messageId", delivery.MessageId, "error", err)
+		p.recrawl(ctx, delivery, instanceId, source)
+		return
+	}
+
+	if id, err := strconv.ParseInt(pgcr.Response.ActivityDetails.InstanceId, 10, 64); err == nil {
+		instanceId = id
+	}
 	mode := pgcr.Response.ActivityDetails.Mode
 
 	// Only process raid activity
-	if pgcr.Response.ActivityDetails.Mode != 4 {
+	if mode != 4 {
 		slog.Info("Pgcr is not a raid", "pgcr", instanceId, "mode", mode)
+		if err := p.queries.RecordLogEntry(ctx, db.RecordLogEntryParams{
+			InstanceID:       instanceId,
+			Source:           sources[source],
+			Status:           string(ledger.SKIPPED_NON_RAID),
+			ProcessorVersion: sql.NullString{String: processorVersion(), Valid: true},
+		}); err != nil {
+			slog.Error("Failed to record skipped pgcr", "instanceId", instanceId, "error", err)
+			delivery.Nack(false, true)
+			return
+		}
 		delivery.Ack(false)
 		return
 	}
@@ -123,20 +165,20 @@ func (p *PgcrProcessor) handleDelivery(ctx context.Context, delivery amqp091.Del
 	processed, err := p.mapper.ExtractInfo(&pgcr.Response)
 	if err != nil {
 		slog.Error("Error mapping pgcr to a processed pgcr", "instanceId", instanceId, "error", err)
-		delivery.Nack(false, false)
+		// Manifest lookups can fail on a retry too, only malformed pgcrs are dead
+		if errors.Is(err, mapper.ErrMalformedPgcr) {
+			err = permanentError{err}
+		}
+		p.fail(ctx, delivery, instanceId, source, err)
 		return
 	}
 
-	compressed, err := compress.Gzip(&pgcr)
+	// The raw body is stored rather than the decoded pgcr, so fields the
+	// mapper doesn't model yet are kept for reprocessing
+	compressed, err := p.compressor.Compress(body)
 	if err != nil {
 		slog.Error("Unable to compress pgcr", "instanceId", instanceId, "error", err)
-		return
-	}
-
-	source, err := extractSource(delivery.Headers)
-	if err != nil {
-		slog.Warn("Unable to extract PGCR source from amqp headers", "error", err)
-		delivery.Nack(false, false)
+		p.fail(ctx, delivery, instanceId, source, permanentError{err})
 		return
 	}
 
@@ -149,144 +191,177 @@ func (p *PgcrProcessor) handleDelivery(ctx context.Context, delivery amqp091.Del
 	defer tx.Rollback()
 
 	qtx := p.queries.WithTx(tx)
-	err = p.Save(ctx, qtx, processed, source, compressed)
-	if err != nil {
-		if markErr := p.LedgerMarkError(ctx, instanceId64, err); markErr != nil {
-			slog.Error("Failed to mark ledger entry as failed", "instanceId", instanceId, "error", err)
-		}
+	if err := p.Save(ctx, qtx, processed, source, p.compressor.Codec(), compressed); err != nil {
 		slog.Error("Error processing pgcr into db", "instanceId", instanceId, "error", err)
-		delivery.Nack(false, true)
+		// The failure is recorded outside of the transaction, which has to be
+		// released first so it doesn't hold the ledger row
+		tx.Rollback()
+		p.fail(ctx, delivery, instanceId, source, err)
 		return
 	}
 
 	if err := tx.Commit(); err != nil {
-		if markErr := p.LedgerMarkError(ctx, instanceId64, err); markErr != nil {
-			slog.Error("Failed to mark ledger entry as failed", "instanceId", instanceId, "error", err)
-		}
 		slog.Error("Failed to commit transaction", "instanceId", instanceId, "error", err)
-		delivery.Nack(false, true)
+		p.fail(ctx, delivery, instanceId, source, err)
 		return
 	}
 
 	slog.Info("Finished processing pgcr", "InstanceId", instanceId)
-	if err := p.LedgerMarkSuccess(ctx, instanceId64); err != nil {
-		slog.Error("Failed to mark ledger entry as processed", "instanceId", instanceId)
-	}
-
 	delivery.Ack(false)
 }
 
-func (p *PgcrProcessor) LedgerMarkSuccess(ctx context.Context, instanceId int64) error {
-	return p.queries.UpdateLogEntryStatus(ctx, db.UpdateLogEntryStatusParams{
+// Records a failed attempt in the ledger and hands the message back to the
+// broker, requeueing it unless the instance is now dead
+// Bodies that aren't a pgcr, e.g. errors of Bungie or the proxy, say nothing
+// about the instance. Instead of being skipped or dead it's queued again, for
+// the backfill to crawl once it's stale
+func (p *PgcrProcessor) recrawl(ctx context.Context, delivery amqp091.Delivery, instanceId int64, source Source) {
+	if instanceId == 0 {
+		delivery.Nack(false, false)
+		return
+	}
+
+	if _, err := p.queries.QueueLogEntry(ctx, db.QueueLogEntryParams{
 		InstanceID: instanceId,
-		Status:     statuses[success],
-		Error:      sql.NullString{Valid: false},
-	})
+		Source:     sources[source],
+	}); err != nil {
+		slog.Error("Failed to queue instance for another crawl", "instanceId", instanceId, "error", err)
+		delivery.Nack(false, true)
+		return
+	}
+	delivery.Ack(false)
 }
 
-func (p *PgcrProcessor) LedgerMarkError(ctx context.Context, instanceId int64, cause error) error {
-	return p.queries.UpdateLogEntryStatus(ctx, db.UpdateLogEntryStatusParams{
-		InstanceID: instanceId,
-		Status:     statuses[errored],
-		Error:      sql.NullString{String: cause.Error(), Valid: cause.Error() != ""},
-	})
+// Only successful responses with activity details are pgcrs, anything else is
+// Bungie's envelope around an error
+func checkPgcr(report *pgcr.PostGameCarnageReportResponse) error {
+	if report.ErrorCode != pgcr.SUCCESS_ERROR_CODE {
+		return fmt.Errorf("bungie error %s (%d)", report.ErrorStatus, report.ErrorCode)
+	}
+	if report.Response.ActivityDetails.InstanceId == "" {
+		return errors.New("pgcr has no activity details")
+	}
+	return nil
 }
 
-// Saves a processed pgcr to the Postgres DB
-func (p *PgcrProcessor) Save(ctx context.Context, qtx *db.Queries, pgcr *pgcr.PgcrInfo, source Source, b []byte) error {
-	// If inserting to the ledger fails, skip inserting to the DB
-	entry, err := p.queries.UpsertLogEntry(ctx, db.UpsertLogEntryParams{
-		InstanceID: pgcr.InstanceId,
-		Source:     sources[source],
-		Status:     statuses[processing],
+func (p *PgcrProcessor) fail(ctx context.Context, delivery amqp091.Delivery, instanceId int64, source Source, cause error) {
+	if instanceId == 0 {
+		delivery.Nack(false, false)
+		return
+	}
+
+	status, err := p.queries.FailLogEntry(ctx, db.FailLogEntryParams{
+		InstanceID:       instanceId,
+		Source:           sources[source],
+		Permanent:        errors.As(cause, &permanentError{}),
+		Error:            sql.NullString{String: cause.Error(), Valid: cause.Error() != ""},
+		ProcessorVersion: sql.NullString{String: processorVersion(), Valid: true},
+		MaxAttempts:      maxAttempts,
 	})
-	if err != nil {
-		slog.Error("Failed to insert to ingestion log", "instanceId", pgcr.InstanceId, "error", err)
-		return err
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		slog.Info("Instance already handled, dropping failed attempt", "instanceId", instanceId)
+		delivery.Ack(false)
+	case err != nil:
+		slog.Error("Failed to mark ledger entry as failed", "instanceId", instanceId, "error", err)
+		delivery.Nack(false, true)
+	case ledger.Status(status) == ledger.DEAD:
+		slog.Warn("Instance is dead, not retrying", "instanceId", instanceId, "error", cause)
+		delivery.Nack(false, false)
+	default:
+		delivery.Nack(false, true)
 	}
+}
 
-	switch entry.Status {
-	case statuses[success]:
-		slog.Info("Instanced already processed successfully, skipping", "instanceId", pgcr.InstanceId)
-		return nil
-	case statuses[errored]:
-		slog.Warn("Retrying previously failed instance", "instanceId", pgcr.InstanceId)
-	case statuses[processing]:
-		if time.Since(entry.LastAttemptAt) > staleThreshold {
-			slog.Warn("Reclaiming stale processing entry", "instanceId", pgcr.InstanceId)
+// Saves a processed pgcr to the Postgres DB. Every write, including the ledger
+// transitions, goes through qtx so they're committed or rolled back together.
+// The claim locks the ledger entry, so another processor handling the same
+// instance waits for the transaction to end and then finds it handled.
+// Instances that are already handled are left untouched
+func (p *PgcrProcessor) Save(ctx context.Context, qtx *db.Queries, pgcr *pgcr.PgcrInfo, source Source, codec compress.Codec, b []byte) error {
+	_, err := qtx.ClaimLogEntry(ctx, db.ClaimLogEntryParams{
+		InstanceID:       pgcr.InstanceId,
+		Source:           sources[source],
+		ProcessorVersion: sql.NullString{String: processorVersion(), Valid: true},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		entry, err := qtx.GetLogEntry(ctx, pgcr.InstanceId)
+		if err != nil {
+			slog.Error("Failed to read ingestion log", "instanceId", pgcr.InstanceId, "error", err)
+			return err
+		}
+		if ledger.Status(entry.Status).Terminal() {
+			slog.Info("Instance already handled, skipping", "instanceId", pgcr.InstanceId, "status", entry.Status)
 		} else {
-			slog.Info("Instance actively being processed elsewhere, skipping", "instanceId", pgcr.InstanceId)
-			return nil
+			slog.Info("Instance can't be claimed, skipping", "instanceId", pgcr.InstanceId, "status", entry.Status)
 		}
+		return nil
+	}
+	if err != nil {
+		slog.Error("Failed to claim ingestion log entry", "instanceId", pgcr.InstanceId, "error", err)
+		return err
 	}
 
-	if err := p.queries.CreateInstance(ctx, db.CreateInstanceParams{
-		ID:              pgcr.InstanceId,
-		ActivityHash:    pgcr.ActivityHash,
-		IsFresh:         pgcr.FromBeginning,
-		Flawless:        pgcr.Flawless,
-		PlayerCount:     int32(len(pgcr.PlayerInfo)),
-		StartTime:       pgcr.StartTime,
-		EndTime:         pgcr.EndTime,
-		DurationSeconds: int32(pgcr.EndTime.Sub(pgcr.StartTime).Seconds()),
-	}); err != nil {
+	if err := qtx.CreateInstance(ctx, instanceParams(pgcr)); err != nil {
 		slog.Error("Failed to save instance to db", "instanceId", pgcr.InstanceId, "error", err)
 		return err
 	}
 
-	if err := p.queries.CreatePgcr(ctx, db.CreatePgcrParams{
+	// A late contest clear can still be processed before an earlier one, so
+	// the World's First flag is recomputed whenever a contest clear comes in.
+	// The lock makes concurrent clears of the raid take turns, each seeing the
+	// ones committed before it
+	if pgcr.Contest && pgcr.Completed {
+		if err := qtx.LockRaidWorldsFirst(ctx, pgcr.ActivityHash); err != nil {
+			slog.Error("Failed to lock World's First", "instanceId", pgcr.InstanceId, "error", err)
+			return err
+		}
+		if err := qtx.MarkWorldsFirst(ctx, pgcr.ActivityHash); err != nil {
+			slog.Error("Failed to mark World's First", "instanceId", pgcr.InstanceId, "error", err)
+			return err
+		}
+	}
+
+	if err := qtx.CreatePgcr(ctx, db.CreatePgcrParams{
 		InstanceID: pgcr.InstanceId,
 		Blob:       b,
+		Codec:      int16(codec),
 	}); err != nil {
 		slog.Error("Failed to save raw pgcr instance", "instanceId", pgcr.InstanceId, "error", err)
 		return err
 	}
 
-	// Player
-	for _, pi := range pgcr.PlayerInfo {
-		player := db.CreateDestinyPlayerParams{
-			MembershipID:   pi.MembershipId,
-			MembershipType: int32(pi.MembershipType),
-			IsPublic:       sql.NullBool{Bool: pi.IsPublic, Valid: true},
-			IconPath:       sql.NullString{String: pi.IconPath, Valid: pi.IconPath != ""},
-		}
-
-		if pi.GlobalDisplayName != "" {
-			player.DisplayName = sql.NullString{String: pi.GlobalDisplayName, Valid: pi.GlobalDisplayName != ""}
-		} else {
-			player.DisplayName = sql.NullString{String: pi.DisplayName, Valid: pi.DisplayName != ""}
-		}
+	if err := p.saveParticipants(ctx, qtx, pgcr); err != nil {
+		return err
+	}
 
-		if pi.GlobalDisplayNameCode != 0 {
-			player.GlobalDisplayNameCode = sql.NullInt32{
-				Int32: int32(pi.GlobalDisplayNameCode),
-				Valid: pi.GlobalDisplayNameCode != 0,
-			}
-		}
+	return qtx.UpdateLogEntryStatus(ctx, db.UpdateLogEntryStatusParams{
+		InstanceID: pgcr.InstanceId,
+		Status:     string(ledger.SUCCESS),
+		Error:      sql.NullString{Valid: false},
+	})
+}
 
-		_, err := p.queries.CreateDestinyPlayer(ctx, player)
+// Saves the players, characters and weapons of a processed pgcr and refreshes
+// the clear counts of every player recorded in it
+func (p *PgcrProcessor) saveParticipants(ctx context.Context, queries *db.Queries, pgcr *pgcr.PgcrInfo) error {
+	// Player
+	for _, pi := range pgcr.PlayerInfo {
+		player := destinyPlayerParams(&pi)
+		_, err := queries.CreateDestinyPlayer(ctx, player)
 		if err != nil {
 			slog.Error("Failed to save destiny player", "instanceId", pgcr.InstanceId, "membershipId", player.MembershipID, "membershipType", player.MembershipType)
 			return err
 		}
 
 		// InstancePlayer
-		err = p.queries.CreateInstancePlayer(ctx, db.CreateInstancePlayerParams{
-			InstanceID:        pgcr.InstanceId,
-			MembershipID:      pi.MembershipId,
-			Completed:         sql.NullBool{Bool: pi.Completed},
-			TimePlayedSeconds: pi.TimePlayedSeconds,
-		})
+		err = queries.CreateInstancePlayer(ctx, instancePlayerParams(pgcr.InstanceId, &pi))
 
 		switch {
 		case err == nil:
-			isFullClear := pgcr.FromBeginning && pi.Completed
-			if err := p.queries.IncrementPlayerCounts(ctx, db.IncrementPlayerCountsParams{
-				MembershipID: pi.MembershipId,
-				Column2:      pi.Completed,
-				Column3:      isFullClear,
-			}); err != nil {
-				slog.Error("Failed to increment clear counts", "membershipId", pi.MembershipId, "error", err)
+			// Derived from the recorded instances so retries can't count a clear twice
+			if err := queries.RecomputePlayerCounts(ctx, pi.MembershipId); err != nil {
+				slog.Error("Failed to recompute clear counts", "membershipId", pi.MembershipId, "error", err)
 				return err
 			}
 		case errors.Is(err, sql.ErrNoRows):
@@ -299,22 +374,7 @@ func (p *PgcrProcessor) Save(ctx context.Context, qtx *db.Queries, pgcr *pgcr.Pg
 
 		// InstanceCharacter
 		for _, ci := range pi.CharacterInfo {
-			if err := p.queries.CreateInstanceCharacter(ctx, db.CreateInstanceCharacterParams{
-				InstanceID:   pgcr.InstanceId,
-				MembershipID: pi.MembershipId,
-				CharacterID:  ci.CharacterId,
-				EmblemHash:   ci.CharacterEmblem,
-				Completed:    ci.ActivityCompleted,
-				Kills:        int32(ci.Kills),
-				Deaths:       int32(ci.Deaths),
-				Assists:      int32(ci.Assists),
-				Kda:          strconv.FormatFloat(float64(ci.Kda), 'f', -1, 64),
-				Kdr:          strconv.FormatFloat(float64(ci.Kdr), 'f', -1, 64),
-				Efficiency:   int32(ci.Efficiency),
-				SuperKills:   int32(ci.AbilityInformation.SuperKills),
-				GrenadeKills: int32(ci.AbilityInformation.GrenadeKills),
-				MeleeKills:   int32(ci.AbilityInformation.MeleeKills),
-			}); err != nil {
+			if err := queries.CreateInstanceCharacter(ctx, instanceCharacterParams(pgcr.InstanceId, pi.MembershipId, &ci)); err != nil {
 				slog.Error("Failed to save instance character", "instanceId", pgcr.InstanceId, "membershipId", player.MembershipID, "membershipType", player.MembershipType, "characterId", ci.CharacterId)
 				return err
 			}
@@ -324,11 +384,13 @@ func (p *PgcrProcessor) Save(ctx context.Context, qtx *db.Queries, pgcr *pgcr.Pg
 				strHash := strconv.FormatInt(ciw.WeaponHash, 10)
 				manifestEntity, err := p.cache.Get(ctx, "DestinyInventoryItemDefinition", strHash)
 				if err != nil {
+					// Skipping the weapon would lose its row for good, reprocess
+					// deletes the existing ones before saving them again
 					slog.Error("Unable to fetch manifest entity", "Hash", ciw.WeaponHash, "Error", err)
-					continue
+					return err
 				}
 
-				if err := p.queries.CreateWeapon(ctx, db.CreateWeaponParams{
+				if err := queries.CreateWeapon(ctx, db.CreateWeaponParams{
 					WeaponHash:    ciw.WeaponHash,
 					IconUrl:       manifestEntity.DisplayProperties.Icon,
 					WeaponName:    manifestEntity.DisplayProperties.Name,
@@ -340,15 +402,7 @@ func (p *PgcrProcessor) Save(ctx context.Context, qtx *db.Queries, pgcr *pgcr.Pg
 				}
 
 				// InstanceCharacterWeapons
-				if err := p.queries.CreateInstanceCharacterWeapon(ctx, db.CreateInstanceCharacterWeaponParams{
-					InstanceID:         pgcr.InstanceId,
-					PlayerMembershipID: pi.MembershipId,
-					PlayerCharacterID:  ci.CharacterId,
-					WeaponID:           ciw.WeaponHash,
-					Kills:              int32(ciw.Kills),
-					PrecisionKills:     int32(ciw.PrecisionKills),
-					PrecisionRatio:     strconv.FormatFloat(float64(ciw.PrecisionRatio), 'f', -1, 64),
-				}); err != nil {
+				if err := queries.CreateInstanceCharacterWeapon(ctx, instanceCharacterWeaponParams(pgcr.InstanceId, pi.MembershipId, ci.CharacterId, &ciw)); err != nil {
 
 					slog.Error("Failed to save instance character", "instanceId", pgcr.InstanceId, "membershipId", player.MembershipID, "membershipType", player.MembershipType, "characterId", ci.CharacterId, "weaponId", strHash)
 					return err
@@ -0,0 +1,50 @@
+package processing
+
+import (
+	"encoding/json"
+	"testing"
+
+	"pgcr-processing-service/internal/types/pgcr"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// The crawler tags its messages with crawling.crawlerSource, a mismatch with
+// the processor drops every message it publishes
+func TestExtractSource_ShouldAcceptPublishedSources(t *testing.T) {
+	for header, want := range map[string]Source{"crawler": crawler, "dataset": dataset} {
+		source, err := extractSource(amqp091.Table{"source": header})
+		if err != nil || source != want {
+			t.Fatalf("Expected %q to be source %d, got %d and %v", header, want, source, err)
+		}
+	}
+
+	if _, err := extractSource(amqp091.Table{"source": "Crawler"}); err == nil {
+		t.Fatal("Expected source headers to be case sensitive")
+	}
+	if _, err := extractSource(amqp091.Table{}); err == nil {
+		t.Fatal("Expected messages without a source to be rejected")
+	}
+}
+
+func TestCheckPgcr_ShouldRejectErrorEnvelopes(t *testing.T) {
+	tests := map[string]struct {
+		body string
+		ok   bool
+	}{
+		"pgcr":      {body: `{"Response": {"activityDetails": {"instanceId": "1", "mode": 2}}, "ErrorCode": 1}`, ok: true},
+		"throttled": {body: `{"ErrorCode": 37, "ErrorStatus": "ThrottleLimitExceededMomentarily", "ThrottleSeconds": 1}`},
+		"not found": {body: `{"ErrorCode": 1653, "ErrorStatus": "DestinyPGCRNotFound"}`},
+		"empty":     {body: `{"ErrorCode": 1}`},
+	}
+
+	for name, test := range tests {
+		var report pgcr.PostGameCarnageReportResponse
+		if err := json.Unmarshal([]byte(test.body), &report); err != nil {
+			t.Fatal(err)
+		}
+		if err := checkPgcr(&report); (err == nil) != test.ok {
+			t.Fatalf("Expected %s to be a pgcr: %v, got %v", name, test.ok, err)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package processing
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"pgcr-processing-service/internal/compress"
+	"pgcr-processing-service/internal/db"
+)
+
+// Every row derived from a single raw pgcr
+type instanceSnapshot struct {
+	Instance   db.Instance
+	Players    []db.InstancePlayer
+	Characters []db.InstanceCharacter
+	Weapons    []db.InstanceCharacterWeapon
+}
+
+// A named column value of a derived row
+type field struct {
+	name  string
+	value any
+}
+
+// Reprocess runs the current mapper over a stored raw pgcr, read with the codec
+// it was stored with, and replaces the rows derived from it in a single
+// transaction, recomputing the clear counts of its players and recording the
+// processor version in the ledger. Returns the difference between the old and
+// new rows, nothing is committed when dryRun is set
+func (p *PgcrProcessor) Reprocess(ctx context.Context, instanceId int64, codec compress.Codec, blob []byte, dryRun bool) (string, error) {
+	raw, err := compress.Unpack(codec, blob)
+	if err != nil {
+		slog.Error("Unable to decompress stored pgcr", "instanceId", instanceId, "codec", codec, "error", err)
+		return "", err
+	}
+
+	processed, err := p.mapper.ExtractInfo(&raw.Response)
+	if err != nil {
+		slog.Error("Error mapping stored pgcr", "instanceId", instanceId, "error", err)
+		return "", err
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("Failed to begin transaction", "error", err)
+		return "", err
+	}
+	defer tx.Rollback()
+
+	qtx := p.queries.WithTx(tx)
+	before, err := snapshot(ctx, qtx, instanceId)
+	if err != nil {
+		slog.Error("Failed to read derived rows", "instanceId", instanceId, "error", err)
+		return "", err
+	}
+
+	if err := qtx.DeleteInstanceCharacterWeapons(ctx, instanceId); err != nil {
+		slog.Error("Failed to delete instance character weapons", "instanceId", instanceId, "error", err)
+		return "", err
+	}
+	if err := qtx.DeleteInstanceCharacters(ctx, instanceId); err != nil {
+		slog.Error("Failed to delete instance characters", "instanceId", instanceId, "error", err)
+		return "", err
+	}
+	if err := qtx.DeleteInstancePlayers(ctx, instanceId); err != nil {
+		slog.Error("Failed to delete instance players", "instanceId", instanceId, "error", err)
+		return "", err
+	}
+
+	if err := qtx.UpdateInstance(ctx, db.UpdateInstanceParams(instanceParams(processed))); err != nil {
+		slog.Error("Failed to update instance", "instanceId", instanceId, "error", err)
+		return "", err
+	}
+
+	// Either the old or the new version of the instance may have been a contest clear
+	if before.Instance.IsContest || processed.Contest {
+		for _, hash := range []int64{before.Instance.ActivityHash, processed.ActivityHash} {
+			if err := qtx.MarkWorldsFirst(ctx, hash); err != nil {
+				slog.Error("Failed to mark World's First", "instanceId", instanceId, "error", err)
+				return "", err
+			}
+		}
+	}
+
+	if err := p.saveParticipants(ctx, qtx, processed); err != nil {
+		return "", err
+	}
+
+	// Players that are no longer part of the instance lose its clear
+	for _, player := range before.Players {
+		if err := qtx.RecomputePlayerCounts(ctx, player.MembershipID); err != nil {
+			slog.Error("Failed to recompute clear counts", "membershipId", player.MembershipID, "error", err)
+			return "", err
+		}
+	}
+
+	// Instances stored before the ledger existed were all crawled
+	if err := qtx.MarkLogEntryReprocessed(ctx, db.MarkLogEntryReprocessedParams{
+		InstanceID:       instanceId,
+		Source:           sources[crawler],
+		ProcessorVersion: sql.NullString{String: processorVersion(), Valid: true},
+	}); err != nil {
+		slog.Error("Failed to record reprocessed instance", "instanceId", instanceId, "error", err)
+		return "", err
+	}
+
+	after, err := snapshot(ctx, qtx, instanceId)
+	if err != nil {
+		slog.Error("Failed to read reprocessed rows", "instanceId", instanceId, "error", err)
+		return "", err
+	}
+	diff := diffSnapshots(before, after)
+
+	if dryRun {
+		return diff, nil
+	}
+	if err := tx.Commit(); err != nil {
+		slog.Error("Failed to commit transaction", "instanceId", instanceId, "error", err)
+		return "", err
+	}
+	return diff, nil
+}
+
+func snapshot(ctx context.Context, queries *db.Queries, instanceId int64) (*instanceSnapshot, error) {
+	var err error
+	s := &instanceSnapshot{}
+	if s.Instance, err = queries.GetInstance(ctx, instanceId); err != nil {
+		return nil, err
+	}
+	if s.Players, err = queries.ListInstancePlayers(ctx, instanceId); err != nil {
+		return nil, err
+	}
+	if s.Characters, err = queries.ListInstanceCharacters(ctx, instanceId); err != nil {
+		return nil, err
+	}
+	if s.Weapons, err = queries.ListInstanceCharacterWeapons(ctx, instanceId); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Lists every row and column that differs between two snapshots, one per line,
+// prefixed with - for the old value and + for the new one
+func diffSnapshots(before, after *instanceSnapshot) string {
+	var b strings.Builder
+	diffFields(&b, "instance", instanceFields(before.Instance), instanceFields(after.Instance))
+	diffRows(&b, "player", before.Players, after.Players, func(p db.InstancePlayer) string {
+		return fmt.Sprint(p.MembershipID)
+	}, playerFields)
+	diffRows(&b, "character", before.Characters, after.Characters, func(c db.InstanceCharacter) string {
+		return fmt.Sprintf("%d/%d", c.MembershipID, c.CharacterID)
+	}, characterFields)
+	diffRows(&b, "weapon", before.Weapons, after.Weapons, func(w db.InstanceCharacterWeapon) string {
+		return fmt.Sprintf("%d/%d/%d", w.PlayerMembershipID, w.PlayerCharacterID, w.WeaponID)
+	}, weaponFields)
+	return b.String()
+}
+
+// Matches rows by key, reporting removed and added rows whole and changed rows by column
+func diffRows[T any](b *strings.Builder, kind string, before, after []T, key func(T) string, fields func(T) []field) {
+	remaining := make(map[string]T, len(after))
+	for _, row := range after {
+		remaining[key(row)] = row
+	}
+
+	for _, old := range before {
+		k := key(old)
+		row, ok := remaining[k]
+		if !ok {
+			fmt.Fprintf(b, "-%s %s\n", kind, k)
+			continue
+		}
+		delete(remaining, k)
+		diffFields(b, kind+" "+k, fields(old), fields(row))
+	}
+
+	for _, row := range after {
+		if _, ok := remaining[key(row)]; ok {
+			fmt.Fprintf(b, "+%s %s\n", kind, key(row))
+		}
+	}
+}
+
+func diffFields(b *strings.Builder, label string, before, after []field) {
+	for i := range before {
+		if before[i].value != after[i].value {
+			fmt.Fprintf(b, "%s %s: -%v +%v\n", label, before[i].name, before[i].value, after[i].value)
+		}
+	}
+}
+
+// Derived rows are recreated on reprocess, so creation times are left out
+func instanceFields(i db.Instance) []field {
+	return []field{
+		{"activity_hash", i.ActivityHash},
+		{"is_fresh", i.IsFresh},
+		{"flawless", i.Flawless},
+		{"completed", i.Completed},
+		{"player_count", i.PlayerCount},
+		{"duration_seconds", i.DurationSeconds},
+		{"start_time", i.StartTime.UTC().Format(time.RFC3339)},
+		{"end_time", i.EndTime.UTC().Format(time.RFC3339)},
+		{"clear_type", i.ClearType},
+		{"completion_reason", i.CompletionReason},
+		{"completion_status", i.CompletionStatus},
+		{"is_contest", i.IsContest},
+		{"is_worlds_first", i.IsWorldsFirst},
+	}
+}
+
+func playerFields(p db.InstancePlayer) []field {
+	return []field{
+		{"completed", p.Completed},
+		{"time_played_seconds", p.TimePlayedSeconds},
+		{"deathless", p.Deathless},
+		{"flawless", p.Flawless},
+	}
+}
+
+func characterFields(c db.InstanceCharacter) []field {
+	return []field{
+		{"class_hash", c.ClassHash},
+		{"emblem_hash", c.EmblemHash},
+		{"completed", c.Completed},
+		{"kills", c.Kills},
+		{"deaths", c.Deaths},
+		{"assists", c.Assists},
+		{"kda", c.Kda},
+		{"kdr", c.Kdr},
+		{"super_kills", c.SuperKills},
+		{"melee_kills", c.MeleeKills},
+		{"grenade_kills", c.GrenadeKills},
+		{"precision_kills", c.PrecisionKills},
+		{"class_ability_kills", c.ClassAbilityKills},
+		{"efficiency", c.Efficiency},
+		{"time_played_seconds", c.TimePlayedSeconds},
+		{"start_seconds", c.StartSeconds},
+		{"deathless", c.Deathless},
+		{"flawless", c.Flawless},
+		{"character_class", c.CharacterClass},
+		{"light_level", c.LightLevel},
+	}
+}
+
+func weaponFields(w db.InstanceCharacterWeapon) []field {
+	return []field{
+		{"kills", w.Kills},
+		{"precision_kills", w.PrecisionKills},
+		{"precision_ratio", w.PrecisionRatio},
+	}
+}
@@ -0,0 +1,39 @@
+package processing
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"pgcr-processing-service/internal/db"
+)
+
+func TestDiffSnapshots_ShouldReportChangedRowsOnly(t *testing.T) {
+	before := &instanceSnapshot{
+		Instance: db.Instance{ID: 1, Completed: false, CreatedAt: time.Unix(0, 0)},
+		Players: []db.InstancePlayer{
+			{MembershipID: 10, TimePlayedSeconds: 60, CreatedAt: time.Unix(0, 0)},
+			{MembershipID: 11},
+		},
+	}
+	after := &instanceSnapshot{
+		Instance: db.Instance{ID: 1, Completed: true, CreatedAt: time.Unix(100, 0)},
+		Players: []db.InstancePlayer{
+			{MembershipID: 10, TimePlayedSeconds: 60, CreatedAt: time.Unix(100, 0)},
+			{MembershipID: 12},
+		},
+	}
+
+	want := strings.Join([]string{
+		"instance completed: -false +true",
+		"-player 11",
+		"+player 12",
+	}, "\n") + "\n"
+	if diff := diffSnapshots(before, after); diff != want {
+		t.Fatalf("Expected diff\n%s\ngot\n%s", want, diff)
+	}
+
+	if diff := diffSnapshots(after, after); diff != "" {
+		t.Fatalf("Expected identical snapshots to have no diff, got\n%s", diff)
+	}
+}
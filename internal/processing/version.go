@@ -0,0 +1,22 @@
+package processing
+
+import "runtime/debug"
+
+// Version of the processor recorded on every ledger entry it handles. Set it at
+// build time with -ldflags "-X pgcr-processing-service/internal/processing.Version=..."
+var Version string
+
+// Falls back to the vcs revision the binary was built from when no version was set
+func processorVersion() string {
+	if Version != "" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+	return "dev"
+}
@@ -0,0 +1,206 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	apiKeyHeader = "X-API-Key"
+	tokenHeader  = "X-Proxy-Token"
+)
+
+// ClientConfig is a caller allowed to use the proxy, authenticated by its own
+// token and limited to its own quota
+type ClientConfig struct {
+	Name  string `yaml:"name"`
+	Token string `yaml:"token"`
+	// Read into token when set, e.g. to keep it in a docker secret
+	TokenFile string `yaml:"token_file"`
+	// Requests per second, unlimited when unset
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+	// Rejected until enabled again in the config or on the admin endpoint
+	Disabled bool `yaml:"disabled"`
+}
+
+func validateClients(clients []ClientConfig) error {
+	names := map[string]bool{}
+	tokens := map[string]bool{}
+	for i, c := range clients {
+		switch {
+		case c.Name == "":
+			return fmt.Errorf("client #%d: name is required", i)
+		case names[c.Name]:
+			return fmt.Errorf("client %s: duplicate name", c.Name)
+		case c.Token == "":
+			return fmt.Errorf("client %s: token is required", c.Name)
+		case tokens[c.Token]:
+			return fmt.Errorf("client %s: token already used by another client", c.Name)
+		case c.Rate < 0 || c.Burst < 0:
+			return fmt.Errorf("client %s: rate and burst can't be negative", c.Name)
+		}
+		names[c.Name] = true
+		tokens[c.Token] = true
+	}
+	return nil
+}
+
+// ClientStatus is the usage of a client as served on the admin endpoint
+type ClientStatus struct {
+	Name     string  `json:"name"`
+	Disabled bool    `json:"disabled"`
+	Rate     float64 `json:"rate,omitempty"`
+	Requests int64   `json:"requests"`
+	// Requests over the client's quota
+	Rejected int64 `json:"rejected"`
+}
+
+type client struct {
+	name string
+	// Nil when the client is unlimited
+	limiter  *rate.Limiter
+	disabled atomic.Bool
+
+	requests atomic.Int64
+	rejected atomic.Int64
+}
+
+// Auth authenticates callers by their token and injects the proxy's Bungie api
+// keys, so the keys never leave the proxy
+type Auth struct {
+	keys    []string
+	next    atomic.Int64
+	clients map[string]*client
+	// In config order, for the admin endpoint
+	ordered []*client
+}
+
+// NewAuth lets anyone in when no clients are configured and keeps the callers'
+// own api key when no keys are configured
+func NewAuth(keys []string, clients []ClientConfig) *Auth {
+	a := &Auth{keys: keys, clients: map[string]*client{}}
+	for _, c := range clients {
+		cl := &client{name: c.Name}
+		if c.Rate > 0 {
+			cl.limiter = rate.NewLimiter(rate.Limit(c.Rate), max(c.Burst, 1))
+		}
+		cl.disabled.Store(c.Disabled)
+		a.clients[c.Token] = cl
+		a.ordered = append(a.ordered, cl)
+	}
+	return a
+}
+
+func (a *Auth) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(a.clients) > 0 {
+			cl, ok := a.clients[token(r)]
+			switch {
+			case !ok:
+				http.Error(w, "unknown proxy token", http.StatusUnauthorized)
+				return
+			case cl.disabled.Load():
+				http.Error(w, "client disabled", http.StatusForbidden)
+				return
+			}
+
+			cl.requests.Add(1)
+			if wait, ok := cl.allow(); !ok {
+				cl.rejected.Add(1)
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				http.Error(w, "client quota exceeded", http.StatusTooManyRequests)
+				return
+			}
+		}
+
+		r.Header.Del(tokenHeader)
+		r.Header.Del("Authorization")
+		if len(a.keys) > 0 {
+			r.Header.Set(apiKeyHeader, a.keys[a.next.Add(1)%int64(len(a.keys))])
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Callers pass their token either on its own header or as a bearer token
+func token(r *http.Request) string {
+	if t := r.Header.Get(tokenHeader); t != "" {
+		return t
+	}
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+// Takes a request from the quota, or tells how long until there's room
+func (c *client) allow() (time.Duration, bool) {
+	if c.limiter == nil {
+		return 0, true
+	}
+	res := c.limiter.Reserve()
+	if delay := res.Delay(); delay > 0 {
+		res.Cancel()
+		return delay, false
+	}
+	return 0, true
+}
+
+// ErrUnknownClient is returned when disabling a client that isn't configured
+var ErrUnknownClient = errors.New("unknown client")
+
+// SetDisabled cuts a client off, or lets it back in, until the proxy restarts
+func (a *Auth) SetDisabled(name string, disabled bool) error {
+	i := slices.IndexFunc(a.ordered, func(c *client) bool { return c.name == name })
+	if i < 0 {
+		return ErrUnknownClient
+	}
+	a.ordered[i].disabled.Store(disabled)
+	return nil
+}
+
+func (a *Auth) Clients() []ClientStatus {
+	statuses := make([]ClientStatus, 0, len(a.ordered))
+	for _, c := range a.ordered {
+		status := ClientStatus{
+			Name:     c.name,
+			Disabled: c.disabled.Load(),
+			Requests: c.requests.Load(),
+			Rejected: c.rejected.Load(),
+		}
+		if c.limiter != nil {
+			status.Rate = float64(c.limiter.Limit())
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// ClientsHandler serves the usage of every client as json. Posting a name and
+// disabled=true|false cuts the client off or lets it back in
+func ClientsHandler(a *Auth) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			disabled, err := strconv.ParseBool(r.FormValue("disabled"))
+			if err != nil {
+				http.Error(w, "disabled must be true or false", http.StatusBadRequest)
+				return
+			}
+			if err := a.SetDisabled(r.FormValue("name"), disabled); err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(a.Clients())
+	})
+}
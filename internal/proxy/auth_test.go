@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuth_ShouldInjectKeysForKnownClients(t *testing.T) {
+	var keys []string
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(tokenHeader) != "" || r.Header.Get("Authorization") != "" {
+			t.Errorf("Expected the proxy token to be stripped, got %v", r.Header)
+		}
+		keys = append(keys, r.Header.Get(apiKeyHeader))
+	})
+
+	auth := NewAuth([]string{"key-a", "key-b"}, []ClientConfig{{Name: "crawler", Token: "secret"}})
+	handler := auth.Handler(upstream)
+
+	for _, header := range []string{tokenHeader, "Authorization"} {
+		req := httptest.NewRequest(http.MethodGet, "/Platform/Settings/", nil)
+		req.Header.Set(apiKeyHeader, "caller-key")
+		if header == tokenHeader {
+			req.Header.Set(header, "secret")
+		} else {
+			req.Header.Set(header, "Bearer secret")
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", rec.Code)
+		}
+	}
+
+	if len(keys) != 2 || keys[0] == keys[1] || keys[0] == "caller-key" || keys[1] == "caller-key" {
+		t.Fatalf("Expected both proxy keys round robin, got %v", keys)
+	}
+}
+
+func TestAuth_ShouldRejectUnknownDisabledAndOverQuotaClients(t *testing.T) {
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	auth := NewAuth([]string{"key"}, []ClientConfig{
+		{Name: "crawler", Token: "crawler-token", Rate: 0.001, Burst: 1},
+		{Name: "abuser", Token: "abuser-token"},
+	})
+	handler := auth.Handler(upstream)
+
+	send := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/Platform/Settings/", nil)
+		req.Header.Set(tokenHeader, token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := send("guess"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 for an unknown token, got %d", rec.Code)
+	}
+
+	if rec := send("crawler-token"); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 within the quota, got %d", rec.Code)
+	}
+	rec := send("crawler-token")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("Expected 429 with Retry-After over the quota, got %d %v", rec.Code, rec.Header())
+	}
+
+	if rec := send("abuser-token"); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 before being cut off, got %d", rec.Code)
+	}
+	if err := auth.SetDisabled("abuser", true); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if rec := send("abuser-token"); rec.Code != http.StatusForbidden {
+		t.Fatalf("Expected 403 once cut off, got %d", rec.Code)
+	}
+
+	statuses := auth.Clients()
+	if statuses[0].Requests != 2 || statuses[0].Rejected != 1 || !statuses[1].Disabled {
+		t.Fatalf("Unexpected client statuses: %+v", statuses)
+	}
+}
@@ -0,0 +1,350 @@
+package proxy
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"pgcr-processing-service/internal/compress"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
+)
+
+// Where cached responses are kept
+type CacheBackend string
+
+const (
+	CACHE_DISK  CacheBackend = "disk"
+	CACHE_REDIS CacheBackend = "redis"
+)
+
+// CacheConfig caches the responses of whitelisted paths that never change, e.g.
+// manifest definitions and pgcrs
+type CacheConfig struct {
+	Backend   CacheBackend `yaml:"backend"`
+	Dir       string       `yaml:"dir"`
+	RedisAddr string       `yaml:"redis_addr"`
+	Rules     []CacheRule  `yaml:"rules"`
+}
+
+type CacheRule struct {
+	// Regular expression matched against the request path
+	Pattern string        `yaml:"pattern"`
+	TTL     time.Duration `yaml:"ttl"`
+}
+
+func (c *CacheConfig) validate() error {
+	switch c.Backend {
+	case CACHE_DISK:
+		if c.Dir == "" {
+			return errors.New("dir is required for the disk cache")
+		}
+	case CACHE_REDIS:
+		if c.RedisAddr == "" {
+			return errors.New("redis_addr is required for the redis cache")
+		}
+	default:
+		return fmt.Errorf("unknown cache backend %q", c.Backend)
+	}
+
+	if len(c.Rules) == 0 {
+		return errors.New("at least one cache rule is required")
+	}
+	for _, rule := range c.Rules {
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			return fmt.Errorf("cache rule %q: %w", rule.Pattern, err)
+		}
+		if rule.TTL <= 0 {
+			return fmt.Errorf("cache rule %q: ttl is required", rule.Pattern)
+		}
+	}
+	return nil
+}
+
+// CacheStore keeps encoded responses until their ttl ends
+type CacheStore interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+func NewCacheStore(c *CacheConfig) (CacheStore, error) {
+	switch c.Backend {
+	case CACHE_DISK:
+		if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+			return nil, err
+		}
+		return &DiskStore{Dir: c.Dir}, nil
+	case CACHE_REDIS:
+		return &RedisStore{Client: redis.NewClient(&redis.Options{Addr: c.RedisAddr})}, nil
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q", c.Backend)
+	}
+}
+
+// CacheStats is the hit ratio as served on the admin endpoint
+type CacheStats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+	// Misses that waited on an identical request in flight instead of going upstream
+	Coalesced int64   `json:"coalesced"`
+	HitRatio  float64 `json:"hit_ratio"`
+}
+
+type compiledRule struct {
+	pattern *regexp.Regexp
+	ttl     time.Duration
+}
+
+// Cache serves whitelisted GET requests from the store, only going upstream
+// once for concurrent identical requests
+type Cache struct {
+	store CacheStore
+	rules []compiledRule
+	group singleflight.Group
+
+	hits      atomic.Int64
+	misses    atomic.Int64
+	coalesced atomic.Int64
+}
+
+func NewCache(c *CacheConfig, store CacheStore) (*Cache, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	cache := &Cache{store: store}
+	for _, rule := range c.Rules {
+		cache.rules = append(cache.rules, compiledRule{
+			pattern: regexp.MustCompile(rule.Pattern),
+			ttl:     rule.TTL,
+		})
+	}
+	return cache, nil
+}
+
+type cachedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// Only successful Bungie responses are cached, throttles come back as a 200
+var successErrorCode = regexp.MustCompile(`"ErrorCode"\s*:\s*1\b`)
+
+// Compressed responses decoding to more than this aren't cached
+const maxDecodedSize = 64 << 20
+
+func (c *Cache) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ttl, ok := c.ttlFor(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Responses are cached as sent, compressed or not, so callers asking
+		// for another encoding don't share them
+		key := r.URL.RequestURI() + "|" + cmp.Or(r.Header.Get("Accept-Encoding"), "identity")
+		if raw, found, err := c.store.Get(r.Context(), key); err != nil {
+			slog.Warn("Unable to read cached response", "key", key, "error", err)
+		} else if found {
+			var res cachedResponse
+			if err := json.Unmarshal(raw, &res); err == nil {
+				c.hits.Add(1)
+				res.write(w, "HIT")
+				return
+			}
+		}
+
+		c.misses.Add(1)
+		// Detached from the caller so the other waiters don't fail if it leaves
+		ctx := context.WithoutCancel(r.Context())
+		leader := false
+		v, _, _ := c.group.Do(key, func() (any, error) {
+			leader = true
+			recorder := &responseRecorder{header: http.Header{}, status: http.StatusOK}
+			next.ServeHTTP(recorder, r.Clone(ctx))
+
+			res := &cachedResponse{Status: recorder.status, Header: recorder.header, Body: recorder.body.Bytes()}
+			if res.Status == http.StatusOK && res.succeeded() {
+				c.save(ctx, key, res, ttl)
+			}
+			return res, nil
+		})
+		if !leader {
+			c.coalesced.Add(1)
+		}
+		v.(*cachedResponse).write(w, "MISS")
+	})
+}
+
+func (c *Cache) ttlFor(r *http.Request) (time.Duration, bool) {
+	if r.Method != http.MethodGet {
+		return 0, false
+	}
+	for _, rule := range c.rules {
+		if rule.pattern.MatchString(r.URL.Path) {
+			return rule.ttl, true
+		}
+	}
+	return 0, false
+}
+
+func (c *Cache) save(ctx context.Context, key string, res *cachedResponse, ttl time.Duration) {
+	raw, err := json.Marshal(res)
+	if err != nil {
+		return
+	}
+	if err := c.store.Set(ctx, key, raw, ttl); err != nil {
+		slog.Warn("Unable to cache response", "key", key, "error", err)
+	}
+}
+
+func (c *Cache) Stats() CacheStats {
+	stats := CacheStats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Coalesced: c.coalesced.Load(),
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
+
+// StatsHandler serves the cache hit ratio as json
+func StatsHandler(c *Cache) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c.Stats())
+	})
+}
+
+func (res *cachedResponse) succeeded() bool {
+	body, err := compress.Decode(res.Header.Get("Content-Encoding"), res.Body, maxDecodedSize)
+	return err == nil && successErrorCode.Match(body)
+}
+
+func (res *cachedResponse) write(w http.ResponseWriter, cacheStatus string) {
+	for name, values := range res.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("X-Cache", cacheStatus)
+	w.Header().Set("Content-Length", strconv.Itoa(len(res.Body)))
+	w.WriteHeader(res.Status)
+	w.Write(res.Body)
+}
+
+type responseRecorder struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return r.body.Write(b)
+}
+
+// DiskStore keeps every response in its own file, named after the hash of its key
+type DiskStore struct {
+	Dir string
+}
+
+type diskEntry struct {
+	ExpiresAt time.Time `json:"expires_at"`
+	Value     []byte    `json:"value"`
+}
+
+func (s *DiskStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.Dir, hex.EncodeToString(sum[:]))
+}
+
+func (s *DiskStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	raw, err := os.ReadFile(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	var entry diskEntry
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return nil, false, err
+	}
+	if time.Now().After(entry.ExpiresAt) {
+		os.Remove(s.path(key))
+		return nil, false, nil
+	}
+	return entry.Value, true, nil
+}
+
+// Writes through a temporary file so readers never see a partial entry
+func (s *DiskStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	raw, err := json.Marshal(diskEntry{ExpiresAt: time.Now().Add(ttl), Value: value})
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.Dir, "entry-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(key))
+}
+
+type RedisStore struct {
+	Client *redis.Client
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	raw, err := s.Client.Get(ctx, "proxy:"+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return raw, true, nil
+}
+
+func (s *RedisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.Client.Set(ctx, "proxy:"+key, value, ttl).Err()
+}
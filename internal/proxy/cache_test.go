@@ -0,0 +1,179 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCache_ShouldCoalesceMissesAndServeHits(t *testing.T) {
+	var upstreamCalls atomic.Int64
+	release := make(chan struct{})
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls.Add(1)
+		<-release
+		io.WriteString(w, `{"Response": {"hash": 1}, "ErrorCode": 1}`)
+	})
+
+	config := &CacheConfig{
+		Backend: CACHE_DISK,
+		Dir:     t.TempDir(),
+		Rules:   []CacheRule{{Pattern: "^/Platform/Destiny2/Manifest/", TTL: time.Hour}},
+	}
+	cache, err := NewCache(config, &DiskStore{Dir: config.Dir})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	srv := httptest.NewServer(cache.Handler(upstream))
+	defer srv.Close()
+
+	url := srv.URL + "/Platform/Destiny2/Manifest/DestinyActivityDefinition/1/"
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Go(func() {
+			res, err := http.Get(url)
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+			res.Body.Close()
+		})
+	}
+
+	// Every request is waiting on the first one before it's released
+	for cache.Stats().Misses < 5 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+
+	if res.Header.Get("X-Cache") != "HIT" || len(body) == 0 {
+		t.Fatalf("Expected a cached response, got %s %q", res.Header.Get("X-Cache"), body)
+	}
+	if calls := upstreamCalls.Load(); calls != 1 {
+		t.Fatalf("Expected a single upstream request, got %d", calls)
+	}
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Coalesced != 4 {
+		t.Fatalf("Expected 1 hit and 4 coalesced misses, got %+v", stats)
+	}
+}
+
+func TestCache_ShouldNotCacheThrottledResponses(t *testing.T) {
+	var upstreamCalls atomic.Int64
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls.Add(1)
+		io.WriteString(w, `{"ErrorCode": 37, "ThrottleSeconds": 1}`)
+	})
+
+	config := &CacheConfig{
+		Backend: CACHE_DISK,
+		Dir:     t.TempDir(),
+		Rules:   []CacheRule{{Pattern: "^/", TTL: time.Hour}},
+	}
+	cache, err := NewCache(config, &DiskStore{Dir: config.Dir})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	srv := httptest.NewServer(cache.Handler(upstream))
+	defer srv.Close()
+
+	for range 2 {
+		res, err := http.Get(srv.URL + "/Platform/Settings/")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		res.Body.Close()
+	}
+	if calls := upstreamCalls.Load(); calls != 2 {
+		t.Fatalf("Expected throttled responses to go upstream every time, got %d calls", calls)
+	}
+}
+
+func TestLoadConfig_ShouldParseCacheRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "proxy.yaml")
+	config := `
+pools:
+  - addresses: [127.0.0.1]
+cache:
+  backend: disk
+  dir: /tmp/proxy-cache
+  rules:
+    - pattern: ^/Platform/Destiny2/Manifest/
+      ttl: 24h
+`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if loaded.Cache == nil || loaded.Cache.Rules[0].TTL != 24*time.Hour {
+		t.Fatalf("Expected a 24h cache rule, got %+v", loaded.Cache)
+	}
+}
+
+func TestCache_ShouldKeepEncodingsApart(t *testing.T) {
+	plain := `{"Response": {"hash": 1}, "ErrorCode": 1}`
+	encoded := gzipped(t, plain)
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") == "gzip" {
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(encoded)
+			return
+		}
+		io.WriteString(w, plain)
+	})
+
+	config := &CacheConfig{
+		Backend: CACHE_DISK,
+		Dir:     t.TempDir(),
+		Rules:   []CacheRule{{Pattern: "^/", TTL: time.Hour}},
+	}
+	cache, err := NewCache(config, &DiskStore{Dir: config.Dir})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	srv := httptest.NewServer(cache.Handler(upstream))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	get := func(encoding string) (string, []byte) {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/Platform/Destiny2/Manifest/DestinyActivityDefinition/1/", nil)
+		if encoding != "" {
+			req.Header.Set("Accept-Encoding", encoding)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		return res.Header.Get("X-Cache"), body
+	}
+
+	for _, want := range []string{"MISS", "HIT"} {
+		if status, body := get("gzip"); status != want || !bytes.Equal(body, encoded) {
+			t.Fatalf("Expected a compressed %s, got %s %q", want, status, body)
+		}
+		if status, body := get(""); status != want || string(body) != plain {
+			t.Fatalf("Expected a plain %s, got %s %q", want, status, body)
+		}
+	}
+}
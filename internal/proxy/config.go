@@ -0,0 +1,248 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// How source addresses are added to the network interface
+type PlumbMode string
+
+const (
+	// Addresses are already assigned to the host, e.g. loopback or static config
+	PLUMB_NONE PlumbMode = "none"
+	// Only prints the ip commands that would assign the addresses
+	PLUMB_DRY_RUN PlumbMode = "dry-run"
+	// Assigns the addresses to the interface through netlink, requires NET_ADMIN
+	PLUMB_NETLINK PlumbMode = "netlink"
+)
+
+type Config struct {
+	Port int `yaml:"port"`
+	// Serves metrics and the admin endpoints, kept off the proxied port so
+	// clients can't reach them
+	AdminPort int          `yaml:"admin_port"`
+	Interface string       `yaml:"interface"`
+	Plumb     PlumbMode    `yaml:"plumb"`
+	Verbose   bool         `yaml:"verbose"`
+	Pools     []PoolConfig `yaml:"pools"`
+	// Starting rate limits of each source address per upstream domain, domains
+	// and fields left out use the defaults
+	Limits Limits `yaml:"limits"`
+	// Optional, nothing is cached when unset
+	Cache *CacheConfig `yaml:"cache"`
+	// Bungie api keys injected round robin into every request in place of the
+	// callers' own. Keys in api_keys_file, one per line, are appended, e.g. to
+	// keep them in a docker secret
+	ApiKeys     []string `yaml:"api_keys"`
+	ApiKeysFile string   `yaml:"api_keys_file"`
+	// Callers allowed to use the proxy, anyone can when unset
+	Clients []ClientConfig `yaml:"clients"`
+	// Lets anyone spend the api keys without a client token. Only meant for
+	// proxies nobody else can reach, clients are required with api keys otherwise
+	AllowUnauthenticated bool `yaml:"allow_unauthenticated"`
+}
+
+// PoolConfig lists outgoing source addresses, either explicitly or as count
+// sequential addresses of a CIDR starting at start
+type PoolConfig struct {
+	Name string `yaml:"name"`
+	// Plain addresses are plumbed as a single host, use addr/bits to plumb them
+	// with a wider prefix
+	Addresses []string `yaml:"addresses"`
+	Cidr      string   `yaml:"cidr"`
+	// Defaults to the first address after the network address of the cidr
+	Start string `yaml:"start"`
+	Count int    `yaml:"count"`
+}
+
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := Config{
+		Port:      8081,
+		AdminPort: 8082,
+		Plumb:     PLUMB_NONE,
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parsing proxy config %s: %w", path, err)
+	}
+
+	if config.ApiKeysFile != "" {
+		keys, err := os.ReadFile(config.ApiKeysFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading api keys: %w", err)
+		}
+		for _, key := range strings.Split(string(keys), "\n") {
+			if key = strings.TrimSpace(key); key != "" {
+				config.ApiKeys = append(config.ApiKeys, key)
+			}
+		}
+	}
+
+	for i, c := range config.Clients {
+		if c.TokenFile == "" {
+			continue
+		}
+		token, err := os.ReadFile(c.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading token of client %s: %w", c.Name, err)
+		}
+		config.Clients[i].Token = strings.TrimSpace(string(token))
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("proxy config %s: %w", path, err)
+	}
+	return &config, nil
+}
+
+func (c *Config) Validate() error {
+	if c.AdminPort != 0 && c.AdminPort == c.Port {
+		return fmt.Errorf("admin_port and port must differ, both are %d", c.Port)
+	}
+
+	switch c.Plumb {
+	case PLUMB_NONE, PLUMB_DRY_RUN:
+	case PLUMB_NETLINK:
+		if c.Interface == "" {
+			return errors.New("interface is required to plumb addresses")
+		}
+	default:
+		return fmt.Errorf("unknown plumb mode %q", c.Plumb)
+	}
+
+	for domain, limit := range c.Limits.withDefaults() {
+		if err := limit.validate(); err != nil {
+			return fmt.Errorf("limits of %s: %w", domain, err)
+		}
+	}
+
+	if c.Cache != nil {
+		if err := c.Cache.validate(); err != nil {
+			return fmt.Errorf("cache: %w", err)
+		}
+	}
+
+	if err := validateClients(c.Clients); err != nil {
+		return err
+	}
+	// Authenticated callers no longer carry a key of their own
+	if len(c.Clients) > 0 && len(c.ApiKeys) == 0 {
+		return errors.New("api keys are required with clients")
+	}
+	// Anyone reaching the proxy would spend the keys
+	if len(c.ApiKeys) > 0 && len(c.Clients) == 0 && !c.AllowUnauthenticated {
+		return errors.New("clients are required with api keys, set allow_unauthenticated to let anyone use them")
+	}
+
+	addrs, err := c.Addresses()
+	if err != nil {
+		return err
+	}
+	if len(addrs) == 0 {
+		return errors.New("no source addresses configured")
+	}
+	return nil
+}
+
+// Addresses of every pool, each with the prefix length it's plumbed with
+func (c *Config) Addresses() ([]netip.Prefix, error) {
+	seen := map[netip.Addr]string{}
+	all := []netip.Prefix{}
+	for i, pool := range c.Pools {
+		name := pool.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i)
+		}
+
+		addrs, err := pool.addresses()
+		if err != nil {
+			return nil, fmt.Errorf("pool %s: %w", name, err)
+		}
+		for _, addr := range addrs {
+			if other, ok := seen[addr.Addr()]; ok {
+				return nil, fmt.Errorf("pool %s: address %s already in pool %s", name, addr.Addr(), other)
+			}
+			seen[addr.Addr()] = name
+		}
+		all = append(all, addrs...)
+	}
+	return all, nil
+}
+
+func (p PoolConfig) addresses() ([]netip.Prefix, error) {
+	if len(p.Addresses) > 0 && p.Cidr != "" {
+		return nil, errors.New("addresses and cidr are mutually exclusive")
+	}
+
+	if p.Cidr == "" {
+		addrs := make([]netip.Prefix, 0, len(p.Addresses))
+		for _, raw := range p.Addresses {
+			addr, err := parseAddress(raw)
+			if err != nil {
+				return nil, err
+			}
+			addrs = append(addrs, addr)
+		}
+		return addrs, nil
+	}
+
+	prefix, err := netip.ParsePrefix(p.Cidr)
+	if err != nil {
+		return nil, err
+	}
+	if p.Count < 1 {
+		return nil, errors.New("count is required with a cidr")
+	}
+
+	next := prefix.Masked().Addr().Next()
+	if p.Start != "" {
+		if next, err = netip.ParseAddr(p.Start); err != nil {
+			return nil, err
+		}
+	}
+
+	start := next
+	addrs := make([]netip.Prefix, 0, p.Count)
+	for range p.Count {
+		if !next.IsValid() || !prefix.Contains(next) {
+			return nil, fmt.Errorf("%d addresses from %s don't fit in %s", p.Count, start, prefix)
+		}
+		addrs = append(addrs, netip.PrefixFrom(next, prefix.Bits()))
+		next = next.Next()
+	}
+	return addrs, nil
+}
+
+func parseAddress(raw string) (netip.Prefix, error) {
+	if prefix, err := netip.ParsePrefix(raw); err == nil {
+		return prefix, nil
+	}
+	addr, err := netip.ParseAddr(raw)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// LoopbackConfig is a pool of n loopback addresses that are already assigned on
+// linux hosts, for tests and local development
+func LoopbackConfig(n int) *Config {
+	return &Config{
+		Plumb: PLUMB_NONE,
+		Pools: []PoolConfig{{
+			Name:  "loopback",
+			Cidr:  "127.0.0.0/8",
+			Count: n,
+		}},
+	}
+}
@@ -0,0 +1,126 @@
+package proxy
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfig_ShouldExpandPools(t *testing.T) {
+	config := &Config{
+		Plumb: PLUMB_NONE,
+		Pools: []PoolConfig{
+			{Name: "block", Cidr: "2001:db8::/64", Start: "2001:db8::ff", Count: 2},
+			{Name: "explicit", Addresses: []string{"192.0.2.1", "2001:db8:1::1/64"}},
+		},
+	}
+
+	addrs, err := config.Addresses()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []netip.Prefix{
+		netip.MustParsePrefix("2001:db8::ff/64"),
+		netip.MustParsePrefix("2001:db8::100/64"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+		netip.MustParsePrefix("2001:db8:1::1/64"),
+	}
+	if len(addrs) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, addrs)
+	}
+	for i := range expected {
+		if addrs[i] != expected[i] {
+			t.Fatalf("Expected %v, got %v", expected[i], addrs[i])
+		}
+	}
+}
+
+func TestConfig_ShouldRejectInvalidPools(t *testing.T) {
+	tests := map[string]struct {
+		config *Config
+		err    string
+	}{
+		"overflowing cidr": {
+			config: &Config{Plumb: PLUMB_NONE, Pools: []PoolConfig{{Cidr: "192.0.2.0/30", Count: 4}}},
+			err:    "don't fit",
+		},
+		"duplicate address": {
+			config: &Config{Plumb: PLUMB_NONE, Pools: []PoolConfig{
+				{Name: "a", Addresses: []string{"192.0.2.1"}},
+				{Name: "b", Cidr: "192.0.2.0/24", Count: 1},
+			}},
+			err: "already in pool a",
+		},
+		"netlink without interface": {
+			config: &Config{Plumb: PLUMB_NETLINK, Pools: []PoolConfig{{Addresses: []string{"192.0.2.1"}}}},
+			err:    "interface is required",
+		},
+		"clients without api keys": {
+			config: &Config{Plumb: PLUMB_NONE, Clients: []ClientConfig{{Name: "crawler", Token: "secret"}}},
+			err:    "api keys are required",
+		},
+		"api keys without clients": {
+			config: &Config{Plumb: PLUMB_NONE, ApiKeys: []string{"key"}, Pools: []PoolConfig{{Addresses: []string{"192.0.2.1"}}}},
+			err:    "clients are required",
+		},
+		"shared client token": {
+			config: &Config{Plumb: PLUMB_NONE, ApiKeys: []string{"key"}, Clients: []ClientConfig{
+				{Name: "crawler", Token: "secret"},
+				{Name: "processor", Token: "secret"},
+			}},
+			err: "token already used",
+		},
+		"no addresses": {
+			config: &Config{Plumb: PLUMB_NONE},
+			err:    "no source addresses",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := test.config.Validate()
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("Expected error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_ShouldOnlyServeKeysUnauthenticatedWhenAllowed(t *testing.T) {
+	dir := t.TempDir()
+	tokenPath := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenPath, []byte("secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(config string) string {
+		path := filepath.Join(dir, "proxy.yaml")
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	base := `
+pools:
+  - addresses: [192.0.2.1]
+api_keys: [key]
+`
+
+	if _, err := LoadConfig(write(base)); err == nil || !strings.Contains(err.Error(), "clients are required") {
+		t.Fatalf("Expected api keys without clients to be rejected, got %v", err)
+	}
+	if _, err := LoadConfig(write(base + "allow_unauthenticated: true\n")); err != nil {
+		t.Fatalf("Expected allow_unauthenticated to allow api keys without clients, got %v", err)
+	}
+
+	loaded, err := LoadConfig(write(base + "clients:\n  - name: services\n    token_file: " + tokenPath + "\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if loaded.Clients[0].Token != "secret" {
+		t.Fatalf("Expected the token to be read from its file, got %q", loaded.Clients[0].Token)
+	}
+}
@@ -0,0 +1,321 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"pgcr-processing-service/internal/compress"
+)
+
+// Whether a source address is used for requests
+type SourceState string
+
+const (
+	HEALTHY SourceState = "healthy"
+	// Out of rotation until its cooldown ends and a probe succeeds
+	EVICTED SourceState = "evicted"
+	// Cooldown ended, a probe request is in flight
+	PROBING SourceState = "probing"
+	// Taken out of rotation on the admin endpoint until enabled again
+	DRAINED SourceState = "drained"
+)
+
+// Outcome of a single request sent from a source address
+type outcome int
+
+const (
+	outcomeOk outcome = iota
+	// 429 or one of Bungie's throttle error codes
+	outcomeThrottled
+	outcomeServerError
+	// The request never got a response, e.g. dial errors and timeouts
+	outcomeFailed
+)
+
+// Bungie's platform error codes for throttled requests
+var throttleErrorCodes = map[int]bool{
+	36: true, // ThrottleLimitExceededMinutes
+	37: true, // ThrottleLimitExceededMomentarily
+	38: true, // ThrottleLimitExceededSeconds
+	51: true, // PerApplicationThrottleExceeded
+	52: true, // PerApplicationAnonymousThrottleExceeded
+	53: true, // PerApplicationAuthenticatedThrottleExceeded
+	54: true, // PerUserThrottleExceeded
+}
+
+var (
+	errorCodePattern       = regexp.MustCompile(`"ErrorCode"\s*:\s*(\d+)`)
+	throttleSecondsPattern = regexp.MustCompile(`"ThrottleSeconds"\s*:\s*(\d+)`)
+)
+
+// Error responses are tiny, a successful response never has its ErrorCode
+// within the first bytes since Response comes first
+const peekSize = 512
+
+type HealthPolicy struct {
+	// Consecutive failed or server error responses before a source is evicted,
+	// throttled sources are evicted right away
+	FailureThreshold int
+	// Cooldown of the first eviction, doubled on every eviction in a row
+	Cooldown    time.Duration
+	MaxCooldown time.Duration
+	// Requested through an evicted source once its cooldown ends
+	ProbeUrl      string
+	ProbeInterval time.Duration
+}
+
+func DefaultHealthPolicy() HealthPolicy {
+	return HealthPolicy{
+		FailureThreshold: 3,
+		Cooldown:         30 * time.Second,
+		MaxCooldown:      10 * time.Minute,
+		ProbeUrl:         "https://www.bungie.net/Platform/Settings/",
+		ProbeInterval:    5 * time.Second,
+	}
+}
+
+// SourceStatus is the health of a source address as served on the admin endpoint
+type SourceStatus struct {
+	Address             string      `json:"address"`
+	State               SourceState `json:"state"`
+	Requests            int64       `json:"requests"`
+	Successes           int64       `json:"successes"`
+	Throttled           int64       `json:"throttled"`
+	ServerErrors        int64       `json:"server_errors"`
+	Failures            int64       `json:"failures"`
+	ConsecutiveFailures int         `json:"consecutive_failures"`
+	Evictions           int         `json:"evictions"`
+	LatencyMs           float64     `json:"latency_ms"`
+	// Limiter and responses per upstream domain
+	Domains      map[string]DomainStatus `json:"domains"`
+	EvictedUntil *time.Time              `json:"evicted_until,omitempty"`
+	LastError    string                  `json:"last_error,omitempty"`
+}
+
+type health struct {
+	mu sync.Mutex
+
+	state SourceState
+	// Evictions in a row without a healthy period in between
+	evictions           int
+	consecutiveFailures int
+	evictedUntil        time.Time
+	lastError           string
+
+	requests     int64
+	successes    int64
+	throttled    int64
+	serverErrors int64
+	failures     int64
+	// Exponentially weighted moving average of responses
+	latency time.Duration
+}
+
+func newHealth() *health {
+	return &health{state: HEALTHY}
+}
+
+func (h *health) available() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.state == HEALTHY
+}
+
+// Records the outcome of a request and evicts the source when it's sick
+func (h *health) record(policy HealthPolicy, o outcome, latency time.Duration, throttleFor time.Duration, errMsg string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.requests++
+	if o != outcomeFailed {
+		if h.latency == 0 {
+			h.latency = latency
+		} else {
+			h.latency = (h.latency*4 + latency) / 5
+		}
+	}
+
+	switch o {
+	case outcomeOk:
+		h.successes++
+		h.consecutiveFailures = 0
+		if h.state == HEALTHY {
+			h.evictions = 0
+		}
+		return
+	case outcomeThrottled:
+		h.throttled++
+	case outcomeServerError:
+		h.serverErrors++
+	case outcomeFailed:
+		h.failures++
+	}
+
+	h.consecutiveFailures++
+	h.lastError = errMsg
+	if o == outcomeThrottled || h.consecutiveFailures >= policy.FailureThreshold {
+		h.evict(policy, throttleFor)
+	}
+}
+
+// Takes a source out of rotation. Requests still in flight when it was evicted,
+// put to probing or drained don't extend its cooldown nor count as evictions
+func (h *health) evict(policy HealthPolicy, atLeast time.Duration) {
+	if h.state != HEALTHY {
+		return
+	}
+	h.cooldown(policy, atLeast)
+}
+
+// Evicts the source for a cooldown doubled on every eviction in a row
+func (h *health) cooldown(policy HealthPolicy, atLeast time.Duration) {
+	cooldown := policy.Cooldown << min(h.evictions, 16)
+	cooldown = max(min(cooldown, policy.MaxCooldown), atLeast)
+
+	h.state = EVICTED
+	h.evictions++
+	h.evictedUntil = time.Now().Add(cooldown)
+}
+
+// Moves an evicted source whose cooldown ended to probing, only one caller
+// gets to probe it
+func (h *health) startProbe(now time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.state != EVICTED || now.Before(h.evictedUntil) {
+		return false
+	}
+	h.state = PROBING
+	return true
+}
+
+func (h *health) finishProbe(policy HealthPolicy, o outcome, throttleFor time.Duration, errMsg string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Drained while probing
+	if h.state != PROBING {
+		return
+	}
+	if o == outcomeOk {
+		h.state = HEALTHY
+		h.consecutiveFailures = 0
+		return
+	}
+	h.lastError = errMsg
+	// Still sick, back to a longer cooldown
+	h.cooldown(policy, throttleFor)
+}
+
+// Drained sources stay out of rotation, neither probed nor evicted, until
+// enabled again. Enabling a source forgets its failures
+func (h *health) setDrained(drained bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if drained {
+		h.state = DRAINED
+		return
+	}
+	h.state = HEALTHY
+	h.consecutiveFailures = 0
+	h.evictions = 0
+}
+
+func (h *health) status() SourceStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := SourceStatus{
+		State:               h.state,
+		Requests:            h.requests,
+		Successes:           h.successes,
+		Throttled:           h.throttled,
+		ServerErrors:        h.serverErrors,
+		Failures:            h.failures,
+		ConsecutiveFailures: h.consecutiveFailures,
+		Evictions:           h.evictions,
+		LatencyMs:           float64(h.latency) / float64(time.Millisecond),
+		LastError:           h.lastError,
+	}
+	if h.state == EVICTED || h.state == PROBING {
+		until := h.evictedUntil
+		s.EvictedUntil = &until
+	}
+	return s
+}
+
+// Classifies a response, peeking at the start of the body for Bungie's throttle
+// error codes without consuming it
+func classify(res *http.Response, err error) (outcome, time.Duration, string) {
+	if err != nil {
+		return outcomeFailed, 0, err.Error()
+	}
+
+	body := bufio.NewReaderSize(res.Body, peekSize)
+	res.Body = struct {
+		io.Reader
+		io.Closer
+	}{body, res.Body}
+	head, _ := body.Peek(peekSize)
+	head = decodeHead(res.Header.Get("Content-Encoding"), head)
+
+	throttleFor := throttleHeaders(res.Header)
+	if m := throttleSecondsPattern.FindSubmatch(head); m != nil {
+		seconds, _ := strconv.Atoi(string(m[1]))
+		throttleFor = max(throttleFor, time.Duration(seconds)*time.Second)
+	}
+
+	if res.StatusCode == http.StatusTooManyRequests {
+		return outcomeThrottled, throttleFor, res.Status
+	}
+	if m := errorCodePattern.FindSubmatch(head); m != nil {
+		code, _ := strconv.Atoi(string(m[1]))
+		if throttleErrorCodes[code] {
+			return outcomeThrottled, throttleFor, "bungie error code " + string(m[1])
+		}
+	}
+	// Still worth backing off when asked to, even without being throttled yet
+	if res.StatusCode >= 500 {
+		return outcomeServerError, throttleFor, res.Status
+	}
+	return outcomeOk, throttleFor, ""
+}
+
+// Decodes as much of the start of a compressed body as it holds, up to peekSize
+// bytes. Error responses are small enough to be whole in it
+func decodeHead(encoding string, head []byte) []byte {
+	if encoding == "" {
+		return head
+	}
+	decoder, err := compress.NewDecoder(encoding, bytes.NewReader(head))
+	if err != nil {
+		return nil
+	}
+	defer decoder.Close()
+
+	// Truncated streams still decode up to where they were cut
+	decoded, _ := io.ReadAll(io.LimitReader(decoder, peekSize))
+	return decoded
+}
+
+// Headers asking to back off for a number of seconds
+var throttleHeaderNames = []string{"Retry-After", "X-Throttle-Seconds", "X-Throttle"}
+
+func throttleHeaders(header http.Header) time.Duration {
+	var longest time.Duration
+	for _, name := range throttleHeaderNames {
+		seconds, err := strconv.Atoi(header.Get(name))
+		if err == nil && seconds > 0 {
+			longest = max(longest, time.Duration(seconds)*time.Second)
+		}
+	}
+	return longest
+}
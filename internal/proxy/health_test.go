@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTransport_ShouldEvictThrottledSourcesUntilProbed(t *testing.T) {
+	var throttling atomic.Bool
+	throttling.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		if host == "127.0.0.1" && throttling.Load() {
+			// Bungie throttles with a 200 and an error code
+			fmt.Fprint(w, `{"ErrorCode": 37, "ThrottleSeconds": 0, "ErrorStatus": "ThrottleLimitExceededMomentarily"}`)
+			return
+		}
+		fmt.Fprint(w, `{"Response": {}, "ErrorCode": 1}`)
+	}))
+	defer srv.Close()
+
+	addrs, err := LoopbackConfig(2).Addresses()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	transport := NewTransport(addrs, nil)
+	transport.Policy.Cooldown = time.Millisecond
+	transport.Policy.ProbeUrl = srv.URL + "/Platform/Settings/"
+	client := &http.Client{Transport: transport}
+
+	for range 4 {
+		res, err := client.Get(srv.URL + "/Platform/Destiny2/Stats/PostGameCarnageReport/1/")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if len(body) == 0 {
+			t.Fatal("Expected the peeked body to still be readable")
+		}
+	}
+
+	status := transport.Status()
+	if status[0].State != EVICTED || status[0].Throttled != 1 {
+		t.Fatalf("Expected the throttled source to be evicted after one request, got %+v", status[0])
+	}
+	if status[1].State != HEALTHY || status[1].Successes != 3 {
+		t.Fatalf("Expected the healthy source to take the rest, got %+v", status[1])
+	}
+
+	// Still throttled, the probe puts it back in cooldown
+	time.Sleep(2 * time.Millisecond)
+	probe(t, transport, 0)
+	if state := transport.Status()[0].State; state != EVICTED {
+		t.Fatalf("Expected a failed probe to keep the source evicted, got %s", state)
+	}
+
+	throttling.Store(false)
+	time.Sleep(5 * time.Millisecond)
+	probe(t, transport, 0)
+	if state := transport.Status()[0].State; state != HEALTHY {
+		t.Fatalf("Expected a successful probe to re-admit the source, got %s", state)
+	}
+}
+
+func probe(t *testing.T, transport *Transport, i int) {
+	s := transport.sources[i]
+	if !s.health.startProbe(time.Now()) {
+		t.Fatalf("Expected source %s to be ready for a probe", s.addr)
+	}
+	transport.probe(context.Background(), s)
+}
+
+func TestHealth_ShouldOnlyEvictHealthySources(t *testing.T) {
+	policy := DefaultHealthPolicy()
+	policy.FailureThreshold = 1
+	h := newHealth()
+
+	h.record(policy, outcomeFailed, 0, 0, "dial error")
+	evictedUntil := h.evictedUntil
+	if h.state != EVICTED || h.evictions != 1 {
+		t.Fatalf("Expected the failed source to be evicted once, got %s after %d evictions", h.state, h.evictions)
+	}
+
+	// Requests that were in flight when it was evicted
+	h.record(policy, outcomeThrottled, 0, time.Hour, "bungie error code 37")
+	if h.evictions != 1 || !h.evictedUntil.Equal(evictedUntil) {
+		t.Fatalf("Expected late failures to leave the eviction alone, got %d evictions until %s", h.evictions, h.evictedUntil)
+	}
+
+	if !h.startProbe(evictedUntil) {
+		t.Fatal("Expected the source to be probed once its cooldown ended")
+	}
+	h.record(policy, outcomeFailed, 0, 0, "dial error")
+	if h.state != PROBING || h.evictions != 1 {
+		t.Fatalf("Expected late failures to leave the probe alone, got %s after %d evictions", h.state, h.evictions)
+	}
+
+	h.finishProbe(policy, outcomeFailed, 0, "dial error")
+	if h.state != EVICTED || h.evictions != 2 {
+		t.Fatalf("Expected a failed probe to evict it again, got %s after %d evictions", h.state, h.evictions)
+	}
+}
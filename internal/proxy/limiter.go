@@ -0,0 +1,157 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// LimitConfig is the starting rate of every source address towards an upstream
+// domain and how it adapts, additive increase and multiplicative decrease
+type LimitConfig struct {
+	// Requests per second
+	Rate    float64 `yaml:"rate"`
+	Burst   int     `yaml:"burst"`
+	MinRate float64 `yaml:"min_rate"`
+	MaxRate float64 `yaml:"max_rate"`
+	// Requests per second added after every second without throttling
+	Increase float64 `yaml:"increase"`
+	// Factor the rate is multiplied by when throttled
+	Decrease float64 `yaml:"decrease"`
+}
+
+// Limits per upstream domain
+type Limits map[string]LimitConfig
+
+func DefaultLimits() Limits {
+	limit := LimitConfig{
+		Rate:     40,
+		Burst:    90,
+		MinRate:  1,
+		MaxRate:  40,
+		Increase: 1,
+		Decrease: 0.5,
+	}
+	return Limits{
+		statsDomain: limit,
+		baseDomain:  limit,
+	}
+}
+
+// Fills every domain and field left out with the defaults
+func (l Limits) withDefaults() Limits {
+	merged := DefaultLimits()
+	for domain, limit := range l {
+		base, ok := merged[domain]
+		if !ok {
+			base = DefaultLimits()[baseDomain]
+		}
+		if limit.Rate > 0 {
+			base.Rate = limit.Rate
+			base.MaxRate = max(base.MaxRate, limit.Rate)
+		}
+		if limit.Burst > 0 {
+			base.Burst = limit.Burst
+		}
+		if limit.MinRate > 0 {
+			base.MinRate = limit.MinRate
+		}
+		if limit.MaxRate > 0 {
+			base.MaxRate = limit.MaxRate
+		}
+		if limit.Increase > 0 {
+			base.Increase = limit.Increase
+		}
+		if limit.Decrease > 0 {
+			base.Decrease = limit.Decrease
+		}
+		merged[domain] = base
+	}
+	return merged
+}
+
+func (l LimitConfig) validate() error {
+	switch {
+	case l.MinRate > l.Rate || l.Rate > l.MaxRate:
+		return fmt.Errorf("rate %v must be between min_rate %v and max_rate %v", l.Rate, l.MinRate, l.MaxRate)
+	case l.Decrease >= 1:
+		return fmt.Errorf("decrease %v must be below 1", l.Decrease)
+	}
+	return nil
+}
+
+type adaptiveLimiter struct {
+	cfg     LimitConfig
+	limiter *rate.Limiter
+
+	mu           sync.Mutex
+	current      float64
+	pausedUntil  time.Time
+	lastIncrease time.Time
+	lastDecrease time.Time
+}
+
+func newAdaptiveLimiter(cfg LimitConfig) *adaptiveLimiter {
+	return &adaptiveLimiter{
+		cfg:          cfg,
+		limiter:      rate.NewLimiter(rate.Limit(cfg.Rate), cfg.Burst),
+		current:      cfg.Rate,
+		lastIncrease: time.Now(),
+	}
+}
+
+// Wait blocks until a request may be sent, failing once the context ends first
+func (l *adaptiveLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	pause := time.Until(l.pausedUntil)
+	l.mu.Unlock()
+
+	if pause > 0 {
+		timer := time.NewTimer(pause)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return l.limiter.Wait(ctx)
+}
+
+// Adapts the rate to the outcome of a request. Bungie asking to back off for a
+// while pauses the limiter on top of the decrease. The requests in flight when
+// the first one got throttled are usually throttled too, so the rate is only
+// decreased once per second or pause
+func (l *adaptiveLimiter) observe(o outcome, throttleFor time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if o == outcomeThrottled || throttleFor > 0 {
+		if now.After(l.lastDecrease.Add(time.Second)) && now.After(l.pausedUntil) {
+			l.current = max(l.cfg.MinRate, l.current*l.cfg.Decrease)
+			l.limiter.SetLimitAt(now, rate.Limit(l.current))
+			l.lastDecrease = now
+		}
+		l.lastIncrease = now
+		if until := now.Add(throttleFor); until.After(l.pausedUntil) {
+			l.pausedUntil = until
+		}
+		return
+	}
+
+	if o == outcomeOk && now.Sub(l.lastIncrease) >= time.Second && l.current < l.cfg.MaxRate {
+		l.current = min(l.cfg.MaxRate, l.current+l.cfg.Increase)
+		l.limiter.SetLimitAt(now, rate.Limit(l.current))
+		l.lastIncrease = now
+	}
+}
+
+func (l *adaptiveLimiter) rate() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.current
+}
@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveLimiter_ShouldDecreaseOnThrottleAndRecover(t *testing.T) {
+	limiter := newAdaptiveLimiter(LimitConfig{Rate: 40, Burst: 1, MinRate: 5, MaxRate: 40, Increase: 2, Decrease: 0.5})
+
+	for range 4 {
+		limiter.observe(outcomeThrottled, 0)
+		limiter.lastDecrease = time.Now().Add(-time.Second)
+	}
+	if rate := limiter.rate(); rate != 5 {
+		t.Fatalf("Expected the rate to bottom out at 5, got %v", rate)
+	}
+
+	// Increases at most once per second without throttling
+	limiter.observe(outcomeOk, 0)
+	if rate := limiter.rate(); rate != 5 {
+		t.Fatalf("Expected no increase right after a throttle, got %v", rate)
+	}
+	limiter.lastIncrease = time.Now().Add(-time.Second)
+	limiter.observe(outcomeOk, 0)
+	if rate := limiter.rate(); rate != 7 {
+		t.Fatalf("Expected an additive increase to 7, got %v", rate)
+	}
+}
+
+func TestAdaptiveLimiter_ShouldDecreaseOncePerWindow(t *testing.T) {
+	limiter := newAdaptiveLimiter(LimitConfig{Rate: 40, Burst: 1, MinRate: 1, MaxRate: 40, Increase: 2, Decrease: 0.5})
+
+	// Every request in flight comes back throttled at once
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Go(func() {
+			limiter.observe(outcomeThrottled, 0)
+		})
+	}
+	wg.Wait()
+	if rate := limiter.rate(); rate != 20 {
+		t.Fatalf("Expected a single decrease to 20, got %v", rate)
+	}
+
+	// Throttled again past the window, but still within the pause it asked for
+	limiter.lastDecrease = time.Now().Add(-2 * time.Second)
+	limiter.observe(outcomeThrottled, time.Minute)
+	limiter.observe(outcomeThrottled, 0)
+	if rate := limiter.rate(); rate != 10 {
+		t.Fatalf("Expected no decrease within the pause, got %v", rate)
+	}
+}
+
+func TestAdaptiveLimiter_ShouldFailWaitsThatOutliveTheContext(t *testing.T) {
+	limiter := newAdaptiveLimiter(DefaultLimits()[statsDomain])
+	limiter.observe(outcomeThrottled, time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := limiter.Wait(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the wait to fail with the context, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("Expected the wait to end with the context instead of the pause")
+	}
+}
+
+func TestLoadConfig_ShouldMergeLimitsWithDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "proxy.yaml")
+	config := `
+pools:
+  - addresses: [127.0.0.1]
+limits:
+  stats.bungie.net:
+    rate: 20
+    max_rate: 30
+`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	limits := loaded.Limits.withDefaults()
+	stats := limits[statsDomain]
+	if stats.Rate != 20 || stats.MaxRate != 30 || stats.Burst != 90 {
+		t.Fatalf("Expected overridden stats limits merged with defaults, got %+v", stats)
+	}
+	if limits[baseDomain] != DefaultLimits()[baseDomain] {
+		t.Fatalf("Expected default www limits, got %+v", limits[baseDomain])
+	}
+}
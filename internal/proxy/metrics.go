@@ -0,0 +1,212 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Upper bounds in seconds of the limiter wait histogram
+var waitBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30}
+
+// DomainStatus is what a source address sent to an upstream domain, as served
+// on the admin endpoint
+type DomainStatus struct {
+	// Current requests per second
+	Rate     float64 `json:"rate"`
+	InFlight int64   `json:"in_flight"`
+	// Responses by status code, requests that never got one are counted as error
+	Codes map[string]int64 `json:"codes"`
+	// Time spent waiting on the rate limiter
+	Waits       int64   `json:"waits"`
+	WaitSeconds float64 `json:"wait_seconds"`
+
+	// Cumulative counts of waits up to each of waitBuckets
+	waitCounts []int64
+}
+
+type domainStats struct {
+	inFlight atomic.Int64
+
+	mu         sync.Mutex
+	codes      map[string]int64
+	waitCounts []int64
+	waits      int64
+	waitSum    time.Duration
+}
+
+func newDomainStats() *domainStats {
+	return &domainStats{
+		codes:      map[string]int64{},
+		waitCounts: make([]int64, len(waitBuckets)),
+	}
+}
+
+func (d *domainStats) observeWait(wait time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.waits++
+	d.waitSum += wait
+	for i, bound := range waitBuckets {
+		if wait.Seconds() <= bound {
+			d.waitCounts[i]++
+		}
+	}
+}
+
+func (d *domainStats) observeResponse(res *http.Response, err error) {
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(res.StatusCode)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.codes[code]++
+}
+
+func (d *domainStats) status() DomainStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return DomainStatus{
+		InFlight:    d.inFlight.Load(),
+		Codes:       maps.Clone(d.codes),
+		Waits:       d.waits,
+		WaitSeconds: d.waitSum.Seconds(),
+		waitCounts:  slices.Clone(d.waitCounts),
+	}
+}
+
+// Counts a request in flight until its body is closed
+type inFlightBody struct {
+	io.ReadCloser
+	once  sync.Once
+	stats *domainStats
+}
+
+func (b *inFlightBody) Close() error {
+	b.once.Do(func() {
+		b.stats.inFlight.Add(-1)
+	})
+	return b.ReadCloser.Close()
+}
+
+// MetricsHandler serves the state of the sources, and of the cache and clients
+// when given, in the Prometheus text format
+func MetricsHandler(t *Transport, cache *Cache, auth *Auth) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		m := &promWriter{w: w}
+
+		statuses := t.Status()
+		states := []SourceState{HEALTHY, EVICTED, PROBING, DRAINED}
+		m.family("proxy_source_state", "gauge", "Whether a source address is in each state")
+		for _, s := range statuses {
+			for _, state := range states {
+				m.sample("proxy_source_state", labels("source", s.Address, "state", string(state)), boolValue(s.State == state))
+			}
+		}
+
+		m.family("proxy_source_latency_seconds", "gauge", "Moving average of upstream response times")
+		for _, s := range statuses {
+			m.sample("proxy_source_latency_seconds", labels("source", s.Address), s.LatencyMs/1000)
+		}
+
+		m.family("proxy_limiter_rate", "gauge", "Current requests per second allowed per source and domain")
+		t.eachDomain(func(source, domain string, d DomainStatus) {
+			m.sample("proxy_limiter_rate", labels("source", source, "domain", domain), d.Rate)
+		})
+
+		m.family("proxy_upstream_in_flight", "gauge", "Requests sent upstream whose body isn't closed yet")
+		t.eachDomain(func(source, domain string, d DomainStatus) {
+			m.sample("proxy_upstream_in_flight", labels("source", source, "domain", domain), float64(d.InFlight))
+		})
+
+		m.family("proxy_upstream_requests_total", "counter", "Upstream responses by status code, error when none came back")
+		t.eachDomain(func(source, domain string, d DomainStatus) {
+			for _, code := range slices.Sorted(maps.Keys(d.Codes)) {
+				m.sample("proxy_upstream_requests_total", labels("source", source, "domain", domain, "code", code), float64(d.Codes[code]))
+			}
+		})
+
+		m.family("proxy_limiter_wait_seconds", "histogram", "Time requests waited on the rate limiter")
+		t.eachDomain(func(source, domain string, d DomainStatus) {
+			for i, bound := range waitBuckets {
+				le := strconv.FormatFloat(bound, 'f', -1, 64)
+				m.sample("proxy_limiter_wait_seconds_bucket", labels("source", source, "domain", domain, "le", le), float64(d.waitCounts[i]))
+			}
+			m.sample("proxy_limiter_wait_seconds_bucket", labels("source", source, "domain", domain, "le", "+Inf"), float64(d.Waits))
+			m.sample("proxy_limiter_wait_seconds_sum", labels("source", source, "domain", domain), d.WaitSeconds)
+			m.sample("proxy_limiter_wait_seconds_count", labels("source", source, "domain", domain), float64(d.Waits))
+		})
+
+		if cache != nil {
+			stats := cache.Stats()
+			m.family("proxy_cache_requests_total", "counter", "Cacheable requests by result")
+			m.sample("proxy_cache_requests_total", labels("result", "hit"), float64(stats.Hits))
+			m.sample("proxy_cache_requests_total", labels("result", "miss"), float64(stats.Misses))
+			m.sample("proxy_cache_requests_total", labels("result", "coalesced"), float64(stats.Coalesced))
+		}
+
+		if auth != nil {
+			clients := auth.Clients()
+			m.family("proxy_client_requests_total", "counter", "Requests of each authenticated client")
+			for _, c := range clients {
+				m.sample("proxy_client_requests_total", labels("client", c.Name), float64(c.Requests))
+			}
+			m.family("proxy_client_rejected_total", "counter", "Requests of each client over its quota")
+			for _, c := range clients {
+				m.sample("proxy_client_rejected_total", labels("client", c.Name), float64(c.Rejected))
+			}
+		}
+	})
+}
+
+// Calls fn for every source and domain in a stable order
+func (t *Transport) eachDomain(fn func(source, domain string, d DomainStatus)) {
+	for _, s := range t.sources {
+		for _, domain := range slices.Sorted(maps.Keys(s.stats)) {
+			fn(s.addr.String(), domain, s.domainStatus(domain))
+		}
+	}
+}
+
+type promWriter struct {
+	w io.Writer
+}
+
+func (p *promWriter) family(name, kind, help string) {
+	fmt.Fprintf(p.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func (p *promWriter) sample(name, labels string, value float64) {
+	fmt.Fprintf(p.w, "%s{%s} %s\n", name, labels, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// Formats name and value pairs as prometheus labels
+func labels(pairs ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=%q", pairs[i], pairs[i+1])
+	}
+	return b.String()
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
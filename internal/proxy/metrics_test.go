@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics_ShouldCountRequestsPerSourceAndDomain(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"Response": {}, "ErrorCode": 1}`)
+	}))
+	defer srv.Close()
+
+	addrs, err := LoopbackConfig(1).Addresses()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	transport := NewTransport(addrs, nil)
+	client := &http.Client{Transport: transport}
+
+	res, err := client.Get(srv.URL + "/Platform/Destiny2/Stats/PostGameCarnageReport/1/")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if inFlight := transport.Status()[0].Domains[statsDomain].InFlight; inFlight != 1 {
+		t.Fatalf("Expected the request to be in flight until its body is closed, got %d", inFlight)
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+
+	rec := httptest.NewRecorder()
+	MetricsHandler(transport, nil, nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	metrics := rec.Body.String()
+
+	for _, expected := range []string{
+		`proxy_upstream_requests_total{source="127.0.0.1",domain="stats.bungie.net",code="200"} 1`,
+		`proxy_upstream_in_flight{source="127.0.0.1",domain="stats.bungie.net"} 0`,
+		`proxy_limiter_wait_seconds_count{source="127.0.0.1",domain="stats.bungie.net"} 1`,
+		`proxy_limiter_wait_seconds_bucket{source="127.0.0.1",domain="www.bungie.net",le="+Inf"} 0`,
+		`proxy_source_state{source="127.0.0.1",state="healthy"} 1`,
+	} {
+		if !strings.Contains(metrics, expected) {
+			t.Fatalf("Expected metrics to contain %q, got:\n%s", expected, metrics)
+		}
+	}
+}
+
+func TestTransport_ShouldSkipDrainedSources(t *testing.T) {
+	addrs, err := LoopbackConfig(2).Addresses()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	transport := NewTransport(addrs, nil)
+
+	if err := transport.SetDrained("127.0.0.1", true); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := transport.SetDrained("192.0.2.1", true); err == nil {
+		t.Fatal("Expected an error draining an address outside the pools")
+	}
+
+	for range 4 {
+		s, err := transport.pick(&transport.nW)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if s.addr.String() != "127.0.0.2" {
+			t.Fatalf("Expected the drained source to be skipped, got %s", s.addr)
+		}
+	}
+
+	// Failures of requests still in flight don't evict it back into probing
+	s := transport.sources[0]
+	s.health.record(transport.Policy, outcomeThrottled, 0, 0, "throttled")
+	if state := transport.Status()[0].State; state != DRAINED {
+		t.Fatalf("Expected the source to stay drained, got %s", state)
+	}
+
+	transport.SetDrained("127.0.0.1", false)
+	if state := transport.Status()[0].State; state != HEALTHY {
+		t.Fatalf("Expected the source back in rotation, got %s", state)
+	}
+}
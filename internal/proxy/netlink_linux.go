@@ -0,0 +1,90 @@
+//go:build linux
+
+package proxy
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"syscall"
+)
+
+// Sends a RTM_NEWADDR request over a netlink route socket, the equivalent of
+// ip addr add. Addresses that are already assigned aren't an error
+func addAddress(iface string, addr netip.Prefix) error {
+	link, err := net.InterfaceByName(iface)
+	if err != nil {
+		return err
+	}
+
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return err
+	}
+
+	family := syscall.AF_INET
+	if addr.Addr().Is6() {
+		family = syscall.AF_INET6
+	}
+	ip := addr.Addr().AsSlice()
+
+	body := make([]byte, syscall.SizeofIfAddrmsg)
+	body[0] = byte(family)
+	body[1] = byte(addr.Bits())
+	binary.NativeEndian.PutUint32(body[4:], uint32(link.Index))
+	body = appendAttr(body, syscall.IFA_LOCAL, ip)
+	body = appendAttr(body, syscall.IFA_ADDRESS, ip)
+
+	msg := make([]byte, syscall.SizeofNlMsghdr, syscall.SizeofNlMsghdr+len(body))
+	binary.NativeEndian.PutUint32(msg[0:], uint32(syscall.SizeofNlMsghdr+len(body)))
+	binary.NativeEndian.PutUint16(msg[4:], syscall.RTM_NEWADDR)
+	binary.NativeEndian.PutUint16(msg[6:], syscall.NLM_F_REQUEST|syscall.NLM_F_ACK|syscall.NLM_F_CREATE|syscall.NLM_F_EXCL)
+	binary.NativeEndian.PutUint32(msg[8:], 1)
+	msg = append(msg, body...)
+
+	if err := syscall.Sendto(fd, msg, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return err
+	}
+
+	buf := make([]byte, syscall.Getpagesize())
+	n, _, err := syscall.Recvfrom(fd, buf, 0)
+	if err != nil {
+		return err
+	}
+
+	replies, err := syscall.ParseNetlinkMessage(buf[:n])
+	if err != nil {
+		return err
+	}
+	for _, reply := range replies {
+		if reply.Header.Type != syscall.NLMSG_ERROR {
+			continue
+		}
+		if len(reply.Data) < 4 {
+			return errors.New("truncated netlink ack")
+		}
+
+		errno := syscall.Errno(-int32(binary.NativeEndian.Uint32(reply.Data)))
+		if errno == 0 || errno == syscall.EEXIST {
+			return nil
+		}
+		return errno
+	}
+	return fmt.Errorf("no netlink ack for %s", addr)
+}
+
+func appendAttr(b []byte, attrType uint16, data []byte) []byte {
+	length := syscall.SizeofRtAttr + len(data)
+	attr := make([]byte, (length+syscall.RTA_ALIGNTO-1) & ^(syscall.RTA_ALIGNTO-1))
+	binary.NativeEndian.PutUint16(attr[0:], uint16(length))
+	binary.NativeEndian.PutUint16(attr[2:], attrType)
+	copy(attr[syscall.SizeofRtAttr:], data)
+	return append(b, attr...)
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package proxy
+
+import (
+	"errors"
+	"net/netip"
+)
+
+func addAddress(string, netip.Prefix) error {
+	return errors.New("netlink plumbing is only supported on linux")
+}
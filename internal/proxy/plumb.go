@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+)
+
+// Plumber assigns source addresses to the network interface
+type Plumber interface {
+	Plumb(addr netip.Prefix) error
+}
+
+func NewPlumber(mode PlumbMode, iface string) Plumber {
+	switch mode {
+	case PLUMB_DRY_RUN:
+		return dryRunPlumber{iface: iface}
+	case PLUMB_NETLINK:
+		return netlinkPlumber{iface: iface}
+	default:
+		return nonePlumber{}
+	}
+}
+
+// PlumbAll assigns every address of the config, addresses that fail are
+// reported but don't stop the others
+func PlumbAll(config *Config) error {
+	addrs, err := config.Addresses()
+	if err != nil {
+		return err
+	}
+
+	plumber := NewPlumber(config.Plumb, config.Interface)
+	var errs []error
+	for _, addr := range addrs {
+		if err := plumber.Plumb(addr); err != nil {
+			errs = append(errs, fmt.Errorf("plumbing %s: %w", addr, err))
+			continue
+		}
+		slog.Debug("Plumbed source address", "address", addr, "interface", config.Interface, "mode", config.Plumb)
+	}
+	return errors.Join(errs...)
+}
+
+type nonePlumber struct{}
+
+func (nonePlumber) Plumb(netip.Prefix) error {
+	return nil
+}
+
+type dryRunPlumber struct {
+	iface string
+}
+
+func (p dryRunPlumber) Plumb(addr netip.Prefix) error {
+	family := "-4"
+	if addr.Addr().Is6() {
+		family = "-6"
+	}
+	fmt.Printf("sudo ip %s addr add %s dev %s\n", family, addr, p.iface)
+	return nil
+}
+
+type netlinkPlumber struct {
+	iface string
+}
+
+func (p netlinkPlumber) Plumb(addr netip.Prefix) error {
+	return addAddress(p.iface, addr)
+}
@@ -0,0 +1,290 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	statsDomain = "stats.bungie.net"
+	baseDomain  = "www.bungie.net"
+	statsPath   = "Destiny2/Stats/PostGameCarnageReport"
+	// Idle keep-alive connections every source keeps to each upstream domain
+	idleConnsPerHost = 32
+)
+
+var (
+	// ErrNoHealthySource is returned while every source address is evicted
+	ErrNoHealthySource = errors.New("no healthy source address")
+	// ErrUnknownSource is returned when draining an address that isn't in a pool
+	ErrUnknownSource = errors.New("unknown source address")
+)
+
+// Transport spreads requests round robin over one transport per source
+// address, each rate limited separately per upstream domain. Limits back off
+// when Bungie throttles and recover while it doesn't. Sources that get
+// throttled or keep failing are taken out of rotation
+type Transport struct {
+	Verbose bool
+	Policy  HealthPolicy
+
+	nW      atomic.Int64
+	nS      atomic.Int64
+	sources []*source
+}
+
+type source struct {
+	addr     netip.Addr
+	rt       http.RoundTripper
+	limiters map[string]*adaptiveLimiter
+	stats    map[string]*domainStats
+	health   *health
+}
+
+func NewTransport(addrs []netip.Prefix, limits Limits) *Transport {
+	limits = limits.withDefaults()
+	t := &Transport{Policy: DefaultHealthPolicy()}
+	for _, addr := range addrs {
+		limiters := map[string]*adaptiveLimiter{}
+		stats := map[string]*domainStats{}
+		for domain, limit := range limits {
+			limiters[domain] = newAdaptiveLimiter(limit)
+			stats[domain] = newDomainStats()
+		}
+
+		t.sources = append(t.sources, &source{
+			addr:     addr.Addr(),
+			rt:       sourceTransport(addr.Addr()),
+			limiters: limiters,
+			stats:    stats,
+			health:   newHealth(),
+		})
+	}
+	return t
+}
+
+// Dials every connection from the given source address. Dial failures are
+// returned to the caller, the proxy turns them into a bad gateway
+func sourceTransport(addr netip.Addr) http.RoundTripper {
+	d := &net.Dialer{
+		LocalAddr: &net.TCPAddr{
+			IP: net.IP(addr.AsSlice()),
+		},
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	rt := http.DefaultTransport.(*http.Transport).Clone()
+	// Every source sends dozens of requests per second to the same two hosts,
+	// the default of 2 idle connections per host keeps redialing
+	rt.MaxIdleConns = 2 * idleConnsPerHost
+	rt.MaxIdleConnsPerHost = idleConnsPerHost
+	rt.DialContext = func(ctx context.Context, network, target string) (net.Conn, error) {
+		conn, err := d.DialContext(ctx, network, target)
+		if err != nil {
+			return nil, fmt.Errorf("dialing %s from %s: %w", target, addr, err)
+		}
+		return conn, nil
+	}
+	return rt
+}
+
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	stats := strings.Contains(r.URL.Path, statsPath)
+	counter := &t.nW
+	r.Host = baseDomain
+	if stats {
+		counter = &t.nS
+		r.Host = statsDomain
+	}
+
+	s, err := t.pick(counter)
+	if err != nil {
+		return nil, err
+	}
+
+	rl := s.limiters[r.Host]
+	counts := s.stats[r.Host]
+	waitStart := time.Now()
+	if err := rl.Wait(r.Context()); err != nil {
+		// Never sent, the source isn't to blame
+		return nil, fmt.Errorf("waiting for rate limit of %s: %w", s.addr, err)
+	}
+	counts.observeWait(time.Since(waitStart))
+
+	if t.Verbose {
+		slog.Info("Sending request", "url", r.URL.String(), "headers", r.Header, "source", s.addr)
+	}
+
+	start := time.Now()
+	counts.inFlight.Add(1)
+	res, err := s.rt.RoundTrip(r)
+	counts.observeResponse(res, err)
+	if err != nil {
+		counts.inFlight.Add(-1)
+	} else {
+		res.Body = &inFlightBody{ReadCloser: res.Body, stats: counts}
+	}
+	if r.Context().Err() != nil {
+		// The caller went away, that says nothing about the source
+		return res, err
+	}
+
+	o, throttleFor, msg := classify(res, err)
+	rl.observe(o, throttleFor)
+	s.health.record(t.Policy, o, time.Since(start), throttleFor, msg)
+	if o != outcomeOk {
+		slog.Warn("Source address request failed", "source", s.addr, "url", r.URL.String(), "error", msg)
+	}
+	return res, err
+}
+
+// Next source in rotation, skipping evicted ones
+func (t *Transport) pick(counter *atomic.Int64) (*source, error) {
+	for range t.sources {
+		n := counter.Add(1)
+		s := t.sources[n%int64(len(t.sources))]
+		if s.health.available() {
+			return s, nil
+		}
+	}
+	return nil, ErrNoHealthySource
+}
+
+// RunProbes sends a probe through every evicted source once its cooldown ends
+// and puts it back in rotation when the probe succeeds
+func (t *Transport) RunProbes(ctx context.Context) {
+	tick := time.NewTicker(t.Policy.ProbeInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-tick.C:
+			for _, s := range t.sources {
+				if s.health.startProbe(now) {
+					go t.probe(ctx, s)
+				}
+			}
+		}
+	}
+}
+
+func (t *Transport) probe(ctx context.Context, s *source) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.Policy.ProbeUrl, nil)
+	if err != nil {
+		s.health.finishProbe(t.Policy, outcomeFailed, 0, err.Error())
+		return
+	}
+	req.Header.Set("User-Agent", "rivenbot")
+
+	res, err := s.rt.RoundTrip(req)
+	o, throttleFor, msg := classify(res, err)
+	if err == nil {
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+	}
+	s.health.finishProbe(t.Policy, o, throttleFor, msg)
+
+	if o == outcomeOk {
+		slog.Info("Source address back in rotation", "source", s.addr)
+	} else {
+		slog.Warn("Source address probe failed", "source", s.addr, "error", msg)
+	}
+}
+
+// Status of every source address in rotation order
+func (t *Transport) Status() []SourceStatus {
+	statuses := make([]SourceStatus, 0, len(t.sources))
+	for _, s := range t.sources {
+		status := s.health.status()
+		status.Address = s.addr.String()
+		status.Domains = map[string]DomainStatus{}
+		for domain := range s.stats {
+			status.Domains[domain] = s.domainStatus(domain)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+func (s *source) domainStatus(domain string) DomainStatus {
+	status := s.stats[domain].status()
+	status.Rate = s.limiters[domain].rate()
+	return status
+}
+
+// SetDrained takes a source address out of rotation, or puts it back, until the
+// proxy restarts. Requests in flight through it are left to finish
+func (t *Transport) SetDrained(addr string, drained bool) error {
+	parsed, err := netip.ParseAddr(addr)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUnknownSource, err)
+	}
+	for _, s := range t.sources {
+		if s.addr == parsed {
+			s.health.setDrained(drained)
+			return nil
+		}
+	}
+	return ErrUnknownSource
+}
+
+// StatusHandler serves the health of every source address as json. Posting an
+// address and drained=true|false drains it or puts it back in rotation
+func StatusHandler(t *Transport) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			drained, err := strconv.ParseBool(r.FormValue("drained"))
+			if err != nil {
+				http.Error(w, "drained must be true or false", http.StatusBadRequest)
+				return
+			}
+			if err := t.SetDrained(r.FormValue("address"), drained); err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(t.Status())
+	})
+}
+
+// NewReverseProxy forwards requests to stats.bungie.net for pgcrs and to
+// www.bungie.net for everything else
+func NewReverseProxy(transport http.RoundTripper) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Director: func(r *http.Request) {
+			if strings.Contains(r.URL.Path, statsPath) {
+				r.URL.Host = statsDomain
+			} else {
+				r.URL.Host = baseDomain
+			}
+			r.URL.Scheme = "https"
+			r.Header.Set("User-Agent", "rivenbot")
+			r.Header.Del("x-forwarded-for")
+			// Callers asking for compressed responses get them as Bungie sent
+			// them, throttle detection and the cache decode what they inspect.
+			// The others get them decoded by the upstream transport
+		},
+		Transport: transport,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			slog.Error("Proxied request failed", "url", r.URL.String(), "error", err)
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+}
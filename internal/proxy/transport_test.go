@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTransport_ShouldRoundRobinSourceAddresses(t *testing.T) {
+	var mu sync.Mutex
+	sources := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		mu.Lock()
+		sources[host]++
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	addrs, err := LoopbackConfig(2).Addresses()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	client := &http.Client{Transport: NewTransport(addrs, nil)}
+
+	for range 4 {
+		res, err := client.Get(srv.URL + "/Platform/Destiny2/Stats/PostGameCarnageReport/1/")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		res.Body.Close()
+	}
+
+	if sources["127.0.0.1"] != 2 || sources["127.0.0.2"] != 2 {
+		t.Fatalf("Expected requests spread over both loopback addresses, got %v", sources)
+	}
+}
+
+func TestTransport_ShouldReturnDialErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	// Documentation range, never assigned to the host
+	transport := NewTransport([]netip.Prefix{netip.MustParsePrefix("192.0.2.1/32")}, nil)
+	_, err := (&http.Client{Transport: transport}).Get(srv.URL)
+	if err == nil || !strings.Contains(err.Error(), "from 192.0.2.1") {
+		t.Fatalf("Expected the dial error to be returned, got %v", err)
+	}
+}
+
+// Sends the requests rewritten to Bungie to a test server instead
+type redirectTransport struct {
+	target *url.URL
+	base   http.RoundTripper
+}
+
+func (t *redirectTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r.URL.Scheme = t.target.Scheme
+	r.URL.Host = t.target.Host
+	return t.base.RoundTrip(r)
+}
+
+func gzipped(t *testing.T, data string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := io.WriteString(w, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReverseProxy_ShouldPassCompressedResponsesThrough(t *testing.T) {
+	success := gzipped(t, `{"Response": {}, "ErrorCode": 1}`)
+	throttled := gzipped(t, `{"ErrorCode": 37, "ThrottleSeconds": 0, "ErrorStatus": "ThrottleLimitExceededMomentarily"}`)
+	var acceptEncoding string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEncoding = r.Header.Get("Accept-Encoding")
+		w.Header().Set("Content-Encoding", "gzip")
+		if r.URL.Query().Has("throttled") {
+			w.Write(throttled)
+			return
+		}
+		w.Write(success)
+	}))
+	defer upstream.Close()
+
+	addrs, err := LoopbackConfig(1).Addresses()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	transport := NewTransport(addrs, nil)
+	target, _ := url.Parse(upstream.URL)
+	srv := httptest.NewServer(NewReverseProxy(&redirectTransport{target: target, base: transport}))
+	defer srv.Close()
+
+	// Keeps the client from decoding the response on its own
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	get := func(path string) []byte {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		req.Header.Set("Accept-Encoding", "gzip, br")
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer res.Body.Close()
+		if res.Header.Get("Content-Encoding") != "gzip" {
+			t.Fatalf("Expected the gzip encoding to be kept, got %q", res.Header.Get("Content-Encoding"))
+		}
+		body, _ := io.ReadAll(res.Body)
+		return body
+	}
+
+	if body := get("/Platform/Destiny2/Stats/PostGameCarnageReport/1/"); !bytes.Equal(body, success) {
+		t.Fatalf("Expected the body as compressed by the upstream, got %q", body)
+	}
+	if acceptEncoding != "gzip, br" {
+		t.Fatalf("Expected the caller's Accept-Encoding to be forwarded, got %q", acceptEncoding)
+	}
+
+	get("/Platform/Settings/?throttled")
+	if status := transport.Status()[0]; status.Throttled != 1 || status.State != EVICTED {
+		t.Fatalf("Expected the compressed throttle to be detected, got %+v", status)
+	}
+}
@@ -0,0 +1,98 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"pgcr-processing-service/internal/compress"
+)
+
+// DecodingTransport asks for gzip or brotli compressed responses and decodes
+// them, failing with ErrResponseTooLarge once either the bytes on the wire or
+// the decoded ones are over MaxSize
+type DecodingTransport struct {
+	MaxSize int64
+	Base    http.RoundTripper
+}
+
+// EncodedBody collects a response body as it came over the wire, e.g. to pass
+// it on still compressed. Requests carry it in their context since clients
+// wrap the bodies returned by their transport
+type EncodedBody struct {
+	// Empty for plain bodies
+	Encoding string
+	bytes.Buffer
+}
+
+type encodedBodyKey struct{}
+
+// WithEncodedBody has DecodingTransport also write the body of the response to
+// the request as it came over the wire to body
+func WithEncodedBody(ctx context.Context, body *EncodedBody) context.Context {
+	return context.WithValue(ctx, encodedBodyKey{}, body)
+}
+
+func (t *DecodingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Accept-Encoding", compress.ENCODING_GZIP+", "+compress.ENCODING_BROTLI)
+
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.ContentLength > t.MaxSize {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: content length of %d bytes is over the limit of %d", ErrResponseTooLarge, resp.ContentLength, t.MaxSize)
+	}
+
+	encoding := resp.Header.Get("Content-Encoding")
+	body := &decodedBody{
+		wire: &limitedReadCloser{
+			r:   io.LimitReader(resp.Body, t.MaxSize+1),
+			c:   resp.Body,
+			max: t.MaxSize,
+		},
+	}
+
+	var wire io.Reader = body.wire
+	if sink, ok := req.Context().Value(encodedBodyKey{}).(*EncodedBody); ok {
+		sink.Encoding = encoding
+		sink.Reset()
+		wire = io.TeeReader(body.wire, sink)
+	}
+	decoder, err := compress.NewDecoder(encoding, wire)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	body.decoded = &limitedReadCloser{
+		r:   io.LimitReader(decoder, t.MaxSize+1),
+		c:   decoder,
+		max: t.MaxSize,
+	}
+
+	resp.Body = body
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+type decodedBody struct {
+	wire    *limitedReadCloser
+	decoded *limitedReadCloser
+}
+
+func (b *decodedBody) Read(p []byte) (int, error) {
+	return b.decoded.Read(p)
+}
+
+func (b *decodedBody) Close() error {
+	b.decoded.Close()
+	return b.wire.Close()
+}
@@ -0,0 +1,106 @@
+package transport
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func encode(t *testing.T, encoding string, data string) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "br":
+		w = brotli.NewWriter(&buf)
+	default:
+		return []byte(data)
+	}
+	if _, err := io.WriteString(w, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodingTransport_ShouldDecodeResponses(t *testing.T) {
+	plain := `{"ErrorCode":1,"Response":{}}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "gzip, br" {
+			t.Errorf("Expected compressed responses to be asked for, got %q", r.Header.Get("Accept-Encoding"))
+		}
+		encoding := r.URL.Query().Get("encoding")
+		if encoding != "" {
+			w.Header().Set("Content-Encoding", encoding)
+		}
+		w.Write(encode(t, encoding, plain))
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &DecodingTransport{MaxSize: 1000, Base: http.DefaultTransport}}
+
+	for _, encoding := range []string{"", "gzip", "br"} {
+		var encoded EncodedBody
+		req, _ := http.NewRequestWithContext(WithEncodedBody(t.Context(), &encoded), http.MethodGet, srv.URL+"?encoding="+encoding, nil)
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Unexpected error for %q: %v", encoding, err)
+		}
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil || string(body) != plain {
+			t.Fatalf("Expected the decoded body for %q, got %q and %v", encoding, body, err)
+		}
+		if res.Header.Get("Content-Encoding") != "" {
+			t.Fatalf("Expected the Content-Encoding to be dropped for %q", encoding)
+		}
+		if encoded.Encoding != encoding || !bytes.Equal(encoded.Bytes(), encode(t, encoding, plain)) {
+			t.Fatalf("Expected the body as it came over the wire for %q, got %q", encoding, encoded.Encoding)
+		}
+	}
+}
+
+func TestDecodingTransport_ShouldFailOversizedResponses(t *testing.T) {
+	// Compresses down to a handful of bytes, only the decoded body is over the limit
+	bomb := encode(t, "gzip", strings.Repeat("x", 1000))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		if r.URL.Query().Has("wire") {
+			w.Write(encode(t, "gzip", strings.Repeat("x", 10)))
+			w.Write(bytes.Repeat([]byte{0}, 200))
+			return
+		}
+		w.Write(bomb)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &DecodingTransport{MaxSize: 100, Base: http.DefaultTransport}}
+
+	_, err := client.Get(srv.URL + "?wire")
+	if !errors.Is(err, ErrResponseTooLarge) {
+		t.Fatalf("Expected ErrResponseTooLarge from the content length, got %v", err)
+	}
+
+	res, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if !errors.Is(err, ErrResponseTooLarge) {
+		t.Fatalf("Expected ErrResponseTooLarge while decoding, got %v", err)
+	}
+	if len(body) != 100 {
+		t.Fatalf("Expected reads to stop at the limit, got %d bytes", len(body))
+	}
+}
@@ -1,10 +1,16 @@
 package transport
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 )
 
+// ErrResponseTooLarge is returned once a response body is known to be over
+// the limit, either up front from its Content-Length or while reading it
+var ErrResponseTooLarge = errors.New("response too large")
+
 type MaxSizeTransport struct {
 	MaxSize int64
 	Base    http.RoundTripper
@@ -16,21 +22,44 @@ func (t *MaxSizeTransport) RoundTrip(req *http.Request) (*http.Response, error)
 		return nil, err
 	}
 
+	if resp.ContentLength > t.MaxSize {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: content length of %d bytes is over the limit of %d", ErrResponseTooLarge, resp.ContentLength, t.MaxSize)
+	}
+
 	resp.Body = &limitedReadCloser{
-		r: io.LimitReader(resp.Body, t.MaxSize+1),
-		c: resp.Body,
+		r:   io.LimitReader(resp.Body, t.MaxSize+1),
+		c:   resp.Body,
+		max: t.MaxSize,
 	}
 
 	return resp, nil
 }
 
+// Fails reads as soon as more than max bytes were read, instead of silently
+// stopping at the limit. Every read after that fails the same way
 type limitedReadCloser struct {
-	r io.Reader
-	c io.Closer
+	r    io.Reader
+	c    io.Closer
+	max  int64
+	read int64
+	err  error
 }
 
 func (l *limitedReadCloser) Read(p []byte) (int, error) {
-	return l.r.Read(p)
+	if l.err != nil {
+		return 0, l.err
+	}
+
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.max {
+		over := int(l.read - l.max)
+		l.read = l.max
+		l.err = fmt.Errorf("%w: over the limit of %d bytes", ErrResponseTooLarge, l.max)
+		return n - over, l.err
+	}
+	return n, err
 }
 
 func (l *limitedReadCloser) Close() error {
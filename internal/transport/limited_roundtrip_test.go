@@ -0,0 +1,66 @@
+package transport
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMaxSizeTransport_ShouldFailOversizedResponses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := strings.Repeat("x", 20)
+		if r.URL.Query().Has("small") {
+			body = body[:10]
+		}
+		if r.URL.Query().Has("chunked") {
+			// Flushing before writing the body leaves out the Content-Length
+			w.(http.Flusher).Flush()
+		}
+		io.WriteString(w, body)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &MaxSizeTransport{MaxSize: 10, Base: http.DefaultTransport}}
+
+	res, err := client.Get(srv.URL + "?small")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil || len(body) != 10 {
+		t.Fatalf("Expected the whole body at the limit, got %d bytes and %v", len(body), err)
+	}
+
+	_, err = client.Get(srv.URL)
+	if !errors.Is(err, ErrResponseTooLarge) {
+		t.Fatalf("Expected ErrResponseTooLarge from the content length, got %v", err)
+	}
+
+	res, err = client.Get(srv.URL + "?chunked")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+	if res.ContentLength != -1 {
+		t.Fatalf("Expected a body of unknown length, got %d", res.ContentLength)
+	}
+	body, err = io.ReadAll(res.Body)
+	if !errors.Is(err, ErrResponseTooLarge) {
+		t.Fatalf("Expected ErrResponseTooLarge while reading, got %v", err)
+	}
+	if len(body) != 10 {
+		t.Fatalf("Expected reads to stop at the limit, got %d bytes", len(body))
+	}
+
+	// Callers that keep reading, e.g. to drain the body, get the same error
+	for range 2 {
+		n, err := res.Body.Read(make([]byte, 8))
+		if n != 0 || !errors.Is(err, ErrResponseTooLarge) {
+			t.Fatalf("Expected reads after the limit to keep failing, got %d bytes and %v", n, err)
+		}
+	}
+}
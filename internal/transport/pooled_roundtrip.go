@@ -0,0 +1,34 @@
+package transport
+
+import (
+	"net/http"
+	"time"
+)
+
+// NewPooledTransport keeps up to conns idle connections to every host. The
+// default transport only keeps 2, so concurrent workers all going through the
+// proxy keep dialing new connections
+func NewPooledTransport(conns int) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConns = conns
+	t.MaxIdleConnsPerHost = conns
+	t.IdleConnTimeout = 90 * time.Second
+	return t
+}
+
+// TokenTransport authenticates every request to the proxy with the client's
+// token, requests are sent as is without one
+type TokenTransport struct {
+	Token string
+	Base  http.RoundTripper
+}
+
+func (t *TokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.Token == "" {
+		return t.Base.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("X-Proxy-Token", t.Token)
+	return t.Base.RoundTrip(req)
+}
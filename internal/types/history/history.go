@@ -0,0 +1,49 @@
+package history
+
+import "time"
+
+// Bungie's platform error code for a successful response
+const SUCCESS_ERROR_CODE = 1
+
+type ProfileResponse struct {
+	Response        Profile `json:"Response"`
+	ErrorCode       int     `json:"ErrorCode"`
+	ErrorStatus     string  `json:"ErrorStatus"`
+	ThrottleSeconds int     `json:"ThrottleSeconds"`
+}
+
+// Only the Profiles component (100) is requested
+type Profile struct {
+	Profile ProfileComponent `json:"profile"`
+}
+
+type ProfileComponent struct {
+	Data ProfileData `json:"data"`
+}
+
+type ProfileData struct {
+	CharacterIds []string `json:"characterIds"`
+}
+
+type ActivityHistoryResponse struct {
+	Response        ActivityHistory `json:"Response"`
+	ErrorCode       int             `json:"ErrorCode"`
+	ErrorStatus     string          `json:"ErrorStatus"`
+	ThrottleSeconds int             `json:"ThrottleSeconds"`
+}
+
+// A page of activities, most recent first. Empty once paged past the oldest one
+type ActivityHistory struct {
+	Activities []Activity `json:"activities"`
+}
+
+type Activity struct {
+	Period          time.Time       `json:"period"`
+	ActivityDetails ActivityDetails `json:"activityDetails"`
+}
+
+type ActivityDetails struct {
+	ActivityHash int64  `json:"directorActivityHash"`
+	InstanceId   string `json:"instanceId"`
+	Mode         int    `json:"mode"`
+}
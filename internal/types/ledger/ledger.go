@@ -0,0 +1,36 @@
+package ledger
+
+// Status of an instance in the ingestion_log
+//
+//	queued -> fetched -> processing -> success
+//	   |         |           |
+//	   |         |           +-> error -> processing (retry) ... -> dead
+//	   +---------+-----------+-> skipped-non-raid
+//	   +-> oversized
+//
+// success, skipped-non-raid and dead are terminal, an instance only leaves
+// them through an explicit reset
+type Status string
+
+const (
+	// Published by the crawler, waiting to be fetched
+	QUEUED Status = "queued"
+	// Fetched from Bungie and waiting in the processing queue
+	FETCHED Status = "fetched"
+	// Claimed by a processor, data is being written in the same transaction
+	PROCESSING Status = "processing"
+	SUCCESS    Status = "success"
+	// Failed processing and will be retried
+	ERROR Status = "error"
+	// Not a raid, nothing was written
+	SKIPPED_NON_RAID Status = "skipped-non-raid"
+	// Failed permanently or ran out of retries
+	DEAD Status = "dead"
+	// Over the crawler's size limit, waits to be requeued with a higher one
+	OVERSIZED Status = "oversized"
+)
+
+// Whether no further processing will happen without an explicit reset
+func (s Status) Terminal() bool {
+	return s == SUCCESS || s == SKIPPED_NON_RAID || s == DEAD
+}
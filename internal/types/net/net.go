@@ -1,6 +1,19 @@
 package net
 
 const (
-	// Max size of 20KB before PGCR is dropped
+	// Max size of 20KB before a PGCR is parked as oversized instead of processed
 	MAX_REQUEST_SIZE_KB = 1024 * 20
 )
+
+const (
+	BUNGIE_URL = "https://www.bungie.net"
+	// Pgcrs are only served from the stats domain
+	BUNGIE_STATS_URL = "https://stats.bungie.net"
+	// Base url of the proxy, e.g. http://proxy:8081, which routes every request
+	// to the right Bungie domain by its path. Bungie is called directly when unset
+	UPSTREAM_URL_ENV = "BUNGIE_UPSTREAM_URL"
+	// Token the proxy authenticates its clients with
+	PROXY_TOKEN_ENV = "PROXY_TOKEN"
+	// Bungie api key of callers calling Bungie directly, the proxy injects its own
+	BUNGIE_API_KEY_ENV = "BUNGIE_API_KEY"
+)
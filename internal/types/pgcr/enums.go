@@ -35,6 +35,7 @@ const (
 	MASTER         RaidDifficulty = "Master"
 	GUIDED_GAMES   RaidDifficulty = "Guided Games"
 	CHALLENGE_MODE RaidDifficulty = "Challenge Mode"
+	CONTEST        RaidDifficulty = "Contest"
 )
 
 type DamageType string
@@ -66,3 +67,11 @@ const (
 	DUO_FLAWLESS  ClearType = "Duo Flawless"
 	TRIO_FLAWLESS ClearType = "Trio Flawless"
 )
+
+type CompletionStatus string
+
+const (
+	FINISHED  CompletionStatus = "Finished"
+	WIPED     CompletionStatus = "Wiped"
+	ABANDONED CompletionStatus = "Abandoned"
+)
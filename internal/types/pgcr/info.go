@@ -5,18 +5,20 @@ import (
 )
 
 type PgcrInfo struct {
-	StartTime      time.Time      `json:"startTime"`
-	EndTime        time.Time      `json:"endTime"`
-	FromBeginning  bool           `json:"fromBeginning"`
-	InstanceId     int64          `json:"instanceId"`
-	RaidName       RaidName       `json:"raidName"`
-	RaidDifficulty RaidDifficulty `json:"raidDifficulty"`
-	ActivityHash   int64          `json:"activityHash"`
-	Flawless       bool           `json:"flawless"`
-	Solo           bool           `json:"solo"`
-	Duo            bool           `json:"duo"`
-	Trio           bool           `json:"trio"`
-	PlayerInfo     []PlayerInfo   `json:"playerInformation"`
+	StartTime        time.Time        `json:"startTime"`
+	EndTime          time.Time        `json:"endTime"`
+	FromBeginning    bool             `json:"fromBeginning"`
+	InstanceId       int64            `json:"instanceId"`
+	RaidName         RaidName         `json:"raidName"`
+	RaidDifficulty   RaidDifficulty   `json:"raidDifficulty"`
+	ActivityHash     int64            `json:"activityHash"`
+	Flawless         bool             `json:"flawless"`
+	ClearType        ClearType        `json:"clearType,omitempty"`
+	Completed        bool             `json:"completed"`
+	CompletionReason *int             `json:"completionReason"`
+	CompletionStatus CompletionStatus `json:"completionStatus"`
+	Contest          bool             `json:"contest"`
+	PlayerInfo       []PlayerInfo     `json:"playerInformation"`
 }
 
 type PlayerInfo struct {
@@ -29,6 +31,8 @@ type PlayerInfo struct {
 	TimePlayedSeconds     int32           `json:"timePlayedSeconds"`
 	IconPath              string          `json:"iconPath"`
 	IsPublic              bool            `json:"isPrivate"`
+	Deathless             bool            `json:"deathless"`
+	Flawless              bool            `json:"flawless"`
 	CharacterInfo         []CharacterInfo `json:"characterInformation"`
 }
 
@@ -36,6 +40,7 @@ type CharacterInfo struct {
 	CharacterId        int64          `json:"characterId"`
 	LightLevel         int            `json:"lightLevel"`
 	CharacterClass     CharacterClass `json:"characterClass"`
+	ClassHash          int64          `json:"classHash"`
 	CharacterEmblem    int64          `json:"characterEmblem"`
 	ActivityCompleted  bool           `json:"activityCompleted"`
 	Kills              int            `json:"kills"`
@@ -43,8 +48,12 @@ type CharacterInfo struct {
 	Deaths             int            `json:"deaths"`
 	Kda                float64        `json:"kda"`
 	Kdr                float64        `json:"kdr"`
-	Efficiency         int            `json:"efficiency"`
+	Efficiency         float64        `json:"efficiency"`
+	PrecisionKills     int            `json:"precisionKills"`
 	TimePlayedSeconds  int            `json:"timePlayedSeconds"`
+	StartSeconds       int            `json:"startSeconds"`
+	Deathless          bool           `json:"deathless"`
+	Flawless           bool           `json:"flawless"`
 	WeaponInformation  []WeaponInfo   `json:"weaponInformation"`
 	AbilityInformation AbilityInfo    `json:"abilityInformation"`
 }
@@ -57,7 +66,8 @@ type WeaponInfo struct {
 }
 
 type AbilityInfo struct {
-	GrenadeKills int `json:"grenadeKills"`
-	MeleeKills   int `json:"meleeKills"`
-	SuperKills   int `json:"superKills"`
+	GrenadeKills      int `json:"grenadeKills"`
+	MeleeKills        int `json:"meleeKills"`
+	SuperKills        int `json:"superKills"`
+	ClassAbilityKills int `json:"classAbilityKills"`
 }
@@ -1,10 +1,14 @@
 package pgcr
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 )
 
+// Bungie's platform error code for a successful response
+const SUCCESS_ERROR_CODE = 1
+
 type PostGameCarnageReportResponse struct {
 	Response        PostGameCarnageReport `json:"Response"`
 	ErrorCode       int                   `json:"ErrorCode"`
@@ -48,31 +52,72 @@ type StatValues struct {
 	Kdr                     StatValue `json:"killsDeathsRatio"`
 	TimePlayedSeconds       StatValue `json:"timePlayedSeconds"`
 	ActivityDurationSeconds StatValue `json:"activityDurationSeconds"`
+	StartSeconds            StatValue `json:"startSeconds"`
+	// Nil when not reported, its zero value means the objective was completed
+	CompletionReason *StatValue `json:"completionReason"`
 }
 
-type StatValue float64
+// StatValue is a single stat reported by Bungie. The API nests every stat as
+// {"basic":{"value":..,"displayValue":..}}, while dataset dumps flatten them
+// down to plain numbers, so both shapes are accepted when decoding
+type StatValue struct {
+	Value        float64
+	DisplayValue string
+}
 
-func (s *StatValue) UnmarshalJSON(data []byte) error {
-	var f float64
+type basicStatValue struct {
+	Basic *basicValue `json:"basic"`
+}
 
-	if err := json.Unmarshal(data, &f); err != nil {
-		*s = StatValue(f)
-	}
+type basicValue struct {
+	Value        float64 `json:"value"`
+	DisplayValue string  `json:"displayValue"`
+}
 
-	var nested struct {
-		Basic struct {
-			Value float64 `json:"value"`
-		} `json:"basic"`
+func (s *StatValue) UnmarshalJSON(data []byte) error {
+	trimmed := bytes.TrimSpace(data)
+
+	switch {
+	case len(trimmed) == 0:
+		return fmt.Errorf("StatValue: empty input")
+	case bytes.Equal(trimmed, []byte("null")):
+		*s = StatValue{}
+		return nil
+	case trimmed[0] == '{':
+		var nested basicStatValue
+		if err := json.Unmarshal(trimmed, &nested); err != nil {
+			return fmt.Errorf("StatValue: unrecognized shape: %w", err)
+		}
+
+		*s = StatValue{}
+		if nested.Basic != nil {
+			s.Value = nested.Basic.Value
+			s.DisplayValue = nested.Basic.DisplayValue
+		}
+		return nil
 	}
 
-	if err := json.Unmarshal(data, &nested); err != nil {
-		return fmt.Errorf("StatValue: unrecognized shape: %v", err)
+	var f float64
+	if err := json.Unmarshal(trimmed, &f); err != nil {
+		return fmt.Errorf("StatValue: unrecognized shape: %w", err)
 	}
 
-	*s = StatValue(nested.Basic.Value)
+	*s = StatValue{Value: f}
 	return nil
 }
 
+// MarshalJSON writes the nested API shape when a display value is present
+// and a plain number otherwise, so that either input shape round-trips
+func (s StatValue) MarshalJSON() ([]byte, error) {
+	if s.DisplayValue == "" {
+		return json.Marshal(s.Value)
+	}
+
+	return json.Marshal(basicStatValue{
+		Basic: &basicValue{Value: s.Value, DisplayValue: s.DisplayValue},
+	})
+}
+
 type PlayerEntry struct {
 	DestinyUserInfo DestinyUserEntry `json:"destinyUserInfo"`
 	CharacterClass  string           `json:"characterClass"`
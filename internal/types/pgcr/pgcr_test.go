@@ -0,0 +1,230 @@
+package pgcr
+
+import (
+	"encoding/json"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/quick"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStatValue_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  StatValue
+	}{
+		{name: "plain integer", input: `42`, want: StatValue{Value: 42}},
+		{name: "plain float", input: `18.523131672597867`, want: StatValue{Value: 18.523131672597867}},
+		{name: "negative", input: `-4.1464340033305185e+18`, want: StatValue{Value: -4.1464340033305185e+18}},
+		{name: "nested", input: `{"basic":{"value":1.0,"displayValue":"Yes"}}`, want: StatValue{Value: 1, DisplayValue: "Yes"}},
+		{name: "nested without display value", input: `{"basic":{"value":281.0}}`, want: StatValue{Value: 281}},
+		{name: "nested with extra fields", input: `{"statId":"kills","basic":{"value":3,"displayValue":"3"},"pga":{"value":1}}`, want: StatValue{Value: 3, DisplayValue: "3"}},
+		{name: "null", input: `null`, want: StatValue{}},
+		{name: "missing basic", input: `{}`, want: StatValue{}},
+		{name: "null basic", input: `{"basic":null}`, want: StatValue{}},
+		{name: "surrounding whitespace", input: " \n 7 \t", want: StatValue{Value: 7}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got StatValue
+			if err := json.Unmarshal([]byte(tt.input), &got); err != nil {
+				t.Fatalf("Unexpected error decoding %q: %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Fatalf("Decoding %q: got %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatValue_UnmarshalJSON_RejectsUnknownShapes(t *testing.T) {
+	for _, input := range []string{`"12"`, `true`, `[1]`, `{"basic":{"value":"1"}}`, `{"basic":1}`} {
+		var got StatValue
+		if err := json.Unmarshal([]byte(input), &got); err == nil {
+			t.Fatalf("Expected an error decoding %q, got %+v", input, got)
+		}
+	}
+}
+
+func TestStatValue_ShouldKeepShapeOnMarshal(t *testing.T) {
+	plain, err := json.Marshal(StatValue{Value: 12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plain) != `12` {
+		t.Fatalf("Expected a plain number, got %s", plain)
+	}
+
+	nested, err := json.Marshal(StatValue{Value: 1, DisplayValue: "Yes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(nested) != `{"basic":{"value":1,"displayValue":"Yes"}}` {
+		t.Fatalf("Expected the nested API shape, got %s", nested)
+	}
+}
+
+func TestStatValue_RoundTripProperty(t *testing.T) {
+	const letters = "abcdefghijklmnopqrstuvwxyz0123456789 %:."
+	config := &quick.Config{
+		MaxCount: 2000,
+		Values: func(values []reflect.Value, r *rand.Rand) {
+			display := make([]byte, r.Intn(8))
+			for i := range display {
+				display[i] = letters[r.Intn(len(letters))]
+			}
+			value := r.NormFloat64() * float64(r.Int63n(1<<40))
+			values[0] = reflect.ValueOf(StatValue{Value: value, DisplayValue: string(display)})
+		},
+	}
+
+	property := func(s StatValue) bool {
+		data, err := json.Marshal(s)
+		if err != nil {
+			return false
+		}
+		var decoded StatValue
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			return false
+		}
+		return decoded == s
+	}
+
+	if err := quick.Check(property, config); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPostGameCarnageReport_RoundTripProperty(t *testing.T) {
+	tests := []struct {
+		filename string
+		decode   func(t *testing.T, data []byte) any
+	}{
+		{
+			filename: "dataset_pgcr.json",
+			decode: func(t *testing.T, data []byte) any {
+				var report PostGameCarnageReport
+				if err := json.Unmarshal(data, &report); err != nil {
+					t.Fatalf("Error decoding dataset pgcr: %v", err)
+				}
+				return report
+			},
+		},
+		{
+			filename: "solo_pgcr.json",
+			decode: func(t *testing.T, data []byte) any {
+				var response PostGameCarnageReportResponse
+				if err := json.Unmarshal(data, &response); err != nil {
+					t.Fatalf("Error decoding API pgcr: %v", err)
+				}
+				return response
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			first := tt.decode(t, readFixture(t, tt.filename))
+
+			encoded, err := json.Marshal(first)
+			if err != nil {
+				t.Fatalf("Error re-encoding pgcr: %v", err)
+			}
+
+			second := tt.decode(t, encoded)
+			if diff := cmp.Diff(first, second); diff != "" {
+				t.Fatalf("Pgcr changed after a round trip (-first +second):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPostGameCarnageReport_DatasetShapeDecodes(t *testing.T) {
+	var report PostGameCarnageReport
+	if err := json.Unmarshal(readFixture(t, "dataset_pgcr.json"), &report); err != nil {
+		t.Fatalf("Error decoding dataset pgcr: %v", err)
+	}
+
+	if len(report.Entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(report.Entries))
+	}
+
+	values := report.Entries[0].Values
+	if values.ActivityDurationSeconds.Value != 59 || values.TimePlayedSeconds.Value != 23 {
+		t.Fatalf("Plain number stats were not decoded: %+v", values)
+	}
+}
+
+func FuzzStatValue(f *testing.F) {
+	for _, seed := range []string{
+		`0`, `1`, `-3.5`, `1e10`, `null`, `{}`, `{"basic":null}`,
+		`{"basic":{"value":1.0,"displayValue":"Yes"}}`,
+		`{"basic":{"value":0.2614227877385772,"displayValue":"26%"}}`,
+		`{"basic":{"value":77731}}`,
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var first StatValue
+		if err := json.Unmarshal(data, &first); err != nil {
+			return
+		}
+
+		encoded, err := json.Marshal(first)
+		if err != nil {
+			t.Fatalf("Decoded %q into %+v but failed to re-encode: %v", data, first, err)
+		}
+
+		var second StatValue
+		if err := json.Unmarshal(encoded, &second); err != nil {
+			t.Fatalf("Failed to decode re-encoded %s: %v", encoded, err)
+		}
+
+		if first != second {
+			t.Fatalf("Round trip mismatch for %q: %+v != %+v", data, first, second)
+		}
+	})
+}
+
+func FuzzPostGameCarnageReport(f *testing.F) {
+	f.Add(readFixture(f, "dataset_pgcr.json"))
+	f.Add([]byte(`{"period":"2024-12-24T07:42:52.000Z","entries":[{"values":{"kills":3,"deaths":{"basic":{"value":1}}}}]}`))
+	f.Add([]byte(`{"entries":[{"values":null,"extended":{"weapons":[{"values":{"uniqueWeaponKills":null}}]}}]}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var first PostGameCarnageReport
+		if err := json.Unmarshal(data, &first); err != nil {
+			return
+		}
+
+		encoded, err := json.Marshal(first)
+		if err != nil {
+			t.Fatalf("Failed to re-encode decoded pgcr: %v", err)
+		}
+
+		var second PostGameCarnageReport
+		if err := json.Unmarshal(encoded, &second); err != nil {
+			t.Fatalf("Failed to decode re-encoded pgcr: %v", err)
+		}
+
+		if diff := cmp.Diff(first, second); diff != "" {
+			t.Fatalf("Pgcr changed after a round trip (-first +second):\n%s", diff)
+		}
+	})
+}
+
+func readFixture(tb testing.TB, filename string) []byte {
+	tb.Helper()
+	data, err := os.ReadFile(filepath.Join("./testdata/", filename))
+	if err != nil {
+		tb.Fatalf("Error reading file %s: %v", filename, err)
+	}
+	return data
+}
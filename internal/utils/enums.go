@@ -63,6 +63,7 @@ var (
 		pgcr.MASTER:         "Master",
 		pgcr.GUIDED_GAMES:   "Guided Games",
 		pgcr.CHALLENGE_MODE: "Challenge Mode",
+		pgcr.CONTEST:        "Contest",
 	}
 )
 